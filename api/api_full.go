@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"math/big"
+	"time"
 )
 
 type IGateway interface {
@@ -15,6 +16,34 @@ type IGateway interface {
 	// GetObjectInfo(context.Context, string) (ObjectInfo, error)
 }
 
+// IPinner is implemented by the gateways keeping content by cid only, their
+// objects are released by unpinning the cid once no file refers to it
+type IPinner interface {
+	Pin(context.Context, string) error
+	Unpin(context.Context, string) error
+	Pins(context.Context) (map[string]bool, error)
+}
+
+// IWrapper is implemented by the gateways storing through another one, e.g.
+// replication, Unwrap returns the gateway their objects are listed on
+type IWrapper interface {
+	Unwrap() IGateway
+}
+
+// Pinner returns the pinner of g, the gateway wrapped by g pins for it
+func Pinner(g IGateway) (IPinner, bool) {
+	for {
+		if p, ok := g.(IPinner); ok {
+			return p, true
+		}
+		w, ok := g.(IWrapper)
+		if !ok {
+			return nil, false
+		}
+		g = w.Unwrap()
+	}
+}
+
 type IContract interface {
 	Call(ctx context.Context, name, method string, args ...interface{}) ([]interface{}, error)
 	Send(ctx context.Context, sender, name, method string, args ...interface{}) (string, error)
@@ -25,6 +54,7 @@ type IContract interface {
 
 	BuySpace(ctx context.Context, buyer string, size uint64) (Transaction, error)
 	BuyTraffic(ctx context.Context, buyer string, size uint64) (Transaction, error)
+	GetPurchase(ctx context.Context, hash string) (Purchase, error)
 	ApproveTsHash(ctx context.Context, pt PayType, sender string, buyValue *big.Int) (Transaction, error)
 	Allowance(ctx context.Context, pt PayType, buyer string) (*big.Int, error)
 	CashTrafficCheck(context.Context, CheckInfo) (string, error)
@@ -37,12 +67,72 @@ type IDataBase interface {
 	GetObjectInfoById(context.Context, int) (interface{}, error)
 	PutObject(context.Context, FileInfo) error
 	DeleteObject(context.Context, int) error
+	CountObjectsByMid(context.Context, StorageType, string) (int64, error)
+	CountObjectsByKey(context.Context, string, StorageType, string) (int64, error)
+	CountObjectsByName(context.Context, string, StorageType, string, string) (int64, error)
+	UpdateUserDefine(context.Context, int, string) error
+	RenameObject(context.Context, int, string, string) error
+	CopyObject(context.Context, int, FileInfo) (FileInfo, error)
+	WithTransaction(context.Context, func(IDataBase) error) error
+
+	GetContent(context.Context, StorageType, string) (Content, error)
+	PutObjectContent(context.Context, FileInfo, []ObjectReplica, Content) error
+	DeleteObjectRef(context.Context, FileInfo) (Content, bool, error)
+	ListObjectsByPath(context.Context, string, StorageType, string) ([]FileInfo, error)
+	ListObjectsPage(context.Context, string, StorageType, ListOptions) ([]FileInfo, int64, error)
+	ListCommonPrefixes(context.Context, string, StorageType, string, string) ([]string, error)
+
+	CreateFolders(context.Context, []Folder) error
+	ListFolders(context.Context, string, StorageType, string) ([]Folder, error)
+	MoveFolder(context.Context, string, StorageType, string, string) error
+	DeleteFolders(context.Context, string, StorageType, string) error
+
+	TrashObject(context.Context, int) error
+	GetTrashedObject(context.Context, int) (FileInfo, error)
+	FindTrashedObject(context.Context, FileInfo) (FileInfo, error)
+	RestoreObject(context.Context, FileInfo) error
+	ListTrash(context.Context, string, StorageType, int, int) ([]FileInfo, int64, error)
+	ListExpiredTrash(context.Context, time.Time, int, int) ([]FileInfo, error)
+	ListTrashedVersions(context.Context, FileInfo) ([]FileInfo, error)
+
+	GetCurrentObject(context.Context, string, StorageType, string, string) (FileInfo, error)
+	NextVersion(context.Context, string, StorageType, string, string) (int, error)
+	ArchiveObject(context.Context, int, bool) error
+	ListVersions(context.Context, string, StorageType, string, string) ([]FileInfo, error)
+	SetCurrentVersion(context.Context, int) error
+
+	QueueDerivatives(context.Context, []Derivative) error
+	ListQueuedDerivatives(context.Context, int, int) ([]Derivative, error)
+	UpdateDerivative(context.Context, Derivative) error
+	GetDerivative(context.Context, int, string) (Derivative, error)
+	ListDerivatives(context.Context, []int) ([]Derivative, error)
+	DeleteDerivatives(context.Context, int) ([]Derivative, error)
+	CountDerivativesByMid(context.Context, StorageType, string) (int64, error)
+
+	ListUsage(context.Context, string) ([]Usage, error)
+	RebuildUsage(context.Context) error
+	AppendLedger(context.Context, LedgerEntry) error
+	SumLedger(context.Context, LedgerQuery) ([]LedgerSum, error)
+	AppendBilling(context.Context, BillingEntry) error
+	ListBilling(context.Context, string, time.Time, time.Time) ([]BillingEntry, error)
+
+	PutObjectReplicas(context.Context, FileInfo, []ObjectReplica) error
+	ListObjectReplicas(context.Context, []int) ([]ObjectReplica, error)
+	ListObjectReplicasByMid(context.Context, StorageType, string) ([]ObjectReplica, error)
+	UpdateObjectReplica(context.Context, ObjectReplica) error
 
 	AddUser(context.Context, USerInfo) error
 	SelectUser(context.Context, string) (USerInfo, error)
 	DeleteUser(context.Context, int) error
 	ListUsers(context.Context, string) ([]USerInfo, error)
 	GetUser(context.Context, int) (USerInfo, error)
+
+	CreateUploadSession(context.Context, UploadSession) error
+	GetUploadSession(context.Context, string) (UploadSession, error)
+	DeleteUploadSession(context.Context, string) error
+	ListExpiredUploadSessions(context.Context, time.Time) ([]UploadSession, error)
+	PutUploadPart(context.Context, UploadPart) error
+	ListUploadParts(context.Context, string) ([]UploadPart, error)
 }
 
 type IDataStore interface {
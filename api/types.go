@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	com "github.com/memoio/contractsv2/common"
 	"github.com/memoio/middleware/response"
+	"gorm.io/gorm"
 )
 
 type ObjectInfo struct {
@@ -22,6 +23,8 @@ type ObjectInfo struct {
 	ModTime     time.Time
 	CType       string
 	UserDefined map[string]string
+	// Replicas are the copies a replicating gateway made of the object
+	Replicas []ObjectReplica
 }
 
 type ObjectOptions struct {
@@ -31,6 +34,18 @@ type ObjectOptions struct {
 	MTime        time.Time
 	DeleteMarker bool
 	UserDefined  map[string]string
+	// Offset and Length select part of the object on reads,
+	// a zero Length reads to the end
+	Offset int64
+	Length int64
+	// Path is the folder an object is put in
+	Path string
+	// Tags are only recorded with the file, the storage never sees them
+	Tags map[string]string
+	// Encrypt stores the object encrypted, its key wrapped to OwnerKey,
+	// the public key of the owner in hex
+	Encrypt  bool
+	OwnerKey string
 }
 
 type SignMessage struct {
@@ -61,6 +76,7 @@ const (
 	MEFS StorageType = iota
 	IPFS
 	QINIU
+	LOCAL
 )
 
 func (s StorageType) String() string {
@@ -71,11 +87,29 @@ func (s StorageType) String() string {
 		return "ipfs"
 	case QINIU:
 		return "qiniu"
+	case LOCAL:
+		return "local"
 	default:
 		return "unknow storage"
 	}
 }
 
+// ParseStorageType is the inverse of StorageType.String
+func ParseStorageType(s string) (StorageType, bool) {
+	switch s {
+	case "mefs":
+		return MEFS, true
+	case "ipfs":
+		return IPFS, true
+	case "qiniu":
+		return QINIU, true
+	case "local":
+		return LOCAL, true
+	default:
+		return MEFS, false
+	}
+}
+
 func StringToStorageType(s string) StorageType {
 	storage := new(big.Int)
 	storage.SetString(s, 10)
@@ -94,23 +128,140 @@ type BuyPackage struct {
 }
 
 type FileInfo struct {
-	ID         int         `gorm:"primarykey"`
-	ChainID    int         `gorm:"uniqueIndex:file_composite;column:chainid"`
-	Address    string      `gorm:"uniqueIndex:file_composite;column:address"`
-	SType      StorageType `gorm:"uniqueIndex:file_composite;column:stype"`
-	Mid        string      `gorm:"uniqueIndex:file_composite;column:mid"`
-	Name       string      `gorm:"uniqueIndex:file_composite;column:name"`
+	ID      int         `gorm:"primarykey"`
+	ChainID int         `gorm:"uniqueIndex:file_version;column:chainid"`
+	Address string      `gorm:"uniqueIndex:file_version;column:address"`
+	SType   StorageType `gorm:"uniqueIndex:file_version;column:stype"`
+	Mid     string      `gorm:"uniqueIndex:file_version;column:mid"`
+	Name    string      `gorm:"uniqueIndex:file_version;column:name"`
+	// Path is the folder holding the file, "/" is the root
+	Path       string `gorm:"uniqueIndex:file_version;column:path;default:/"`
 	Size       int64
 	ModTime    time.Time `gorm:"column:modtime"`
 	Public     bool
 	UserDefine string `gorm:"column:userdefine"`
 	UserID     int    `gorm:"column:userid"`
+	// ContentType is empty for the files stored before it was recorded
+	ContentType string `gorm:"column:ctype"`
+	// ObjectKey is the name of the object on its storage, it stays the
+	// same when the file is moved to another folder
+	ObjectKey string `gorm:"column:objectkey"`
+	// Hash is the sha256 of a file sharing its content with other files
+	Hash string `gorm:"index;column:hash"`
+	// Deleted is set while the file is in the trash, the queries of gorm
+	// skip such files unless they are unscoped
+	Deleted gorm.DeletedAt `gorm:"index;column:deleted"`
+	// Version counts the puts of the name in its folder, only the current
+	// version is listed, the older ones are Archived
+	Version  int  `gorm:"uniqueIndex:file_version;column:version;default:1"`
+	Archived bool `gorm:"index;column:archived"`
+	// DataKey is set for an encrypted file, the key of its content sealed
+	// by the master key, OwnerKey is the same key wrapped to the owner
+	DataKey  string `gorm:"column:datakey"`
+	OwnerKey string `gorm:"column:ownerkey"`
+	// Width and Height are the size of an image in pixels, Taken is the
+	// exif date of a photo, Duration is the length of an audio in seconds
+	Width    int       `gorm:"column:width"`
+	Height   int       `gorm:"column:height"`
+	Taken    time.Time `gorm:"index;column:taken"`
+	Duration float64   `gorm:"column:duration"`
+}
+
+// Key is the name the object is stored as, older files only have a name
+func (f FileInfo) Key() string {
+	if f.ObjectKey != "" {
+		return f.ObjectKey
+	}
+	return f.Name
 }
 
 func (FileInfo) TableName() string {
 	return "fileinfo"
 }
 
+// TagPrefix marks the tags among the user defined values of a file
+const TagPrefix = "tag:"
+
+// ListOptions select a page of the files of an address, the zero value
+// lists every file by id
+type ListOptions struct {
+	// Prefix matches the start of the path and name of a file, the path
+	// taken without its leading slash
+	Prefix string
+	// Delimiter leaves out the files having it after the prefix
+	Delimiter string
+	// NameContains matches a part of the name
+	NameContains string
+	// ContentType is a whole type, or its first part ending with a slash
+	ContentType string
+	Public      *bool
+	MinSize     int64
+	// MaxSize is not checked when 0
+	MaxSize int64
+	// MinWidth and MinHeight match images, MinDuration and MaxDuration
+	// audios, in seconds, they are not checked when 0
+	MinWidth    int64
+	MinHeight   int64
+	MinDuration int64
+	MaxDuration int64
+	// TakenAfter and TakenBefore match photos, they are not checked when
+	// zero
+	TakenAfter  time.Time
+	TakenBefore time.Time
+	// Tags are all set on a file, an empty value matches any value
+	Tags map[string]string
+	// Sort is one of name, size and modtime, the id otherwise
+	Sort string
+	Desc bool
+	// After is the last file of the previous page
+	After *Cursor
+	// Limit is not checked when 0
+	Limit int
+}
+
+// Cursor is where a page of files ends
+type Cursor struct {
+	ID      int
+	Name    string    `json:",omitempty"`
+	Size    int64     `json:",omitempty"`
+	ModTime time.Time `json:",omitempty"`
+}
+
+// Content is an object stored once for the files of every address having
+// the same content, it is deleted with its last reference
+type Content struct {
+	ID    int         `gorm:"primarykey"`
+	SType StorageType `gorm:"uniqueIndex:content_composite;column:stype"`
+	Hash  string      `gorm:"uniqueIndex:content_composite;column:hash"`
+	Area  string      `gorm:"column:area"`
+	Mid   string      `gorm:"column:mid"`
+	// Address and ObjectKey locate the object on the storage
+	Address   string `gorm:"column:address"`
+	ObjectKey string `gorm:"column:objectkey"`
+	Size      int64
+	Refs      int64 `gorm:"column:refs"`
+	Created   time.Time
+}
+
+func (Content) TableName() string {
+	return "content"
+}
+
+// Folder is a folder made by a user, the folders holding files exist
+// without being recorded
+type Folder struct {
+	ID      int         `gorm:"primarykey"`
+	Address string      `gorm:"uniqueIndex:folder_composite;column:address"`
+	SType   StorageType `gorm:"uniqueIndex:folder_composite;column:stype"`
+	// Path starts and ends with a slash
+	Path    string `gorm:"uniqueIndex:folder_composite;column:path"`
+	Created time.Time
+}
+
+func (Folder) TableName() string {
+	return "folder"
+}
+
 type USerInfo struct {
 	ID    int    `gorm:"primarykey"`
 	Area  string `gorm:"uniqueIndex:user_composite;column:area"`
@@ -122,6 +273,227 @@ func (USerInfo) TableName() string {
 	return "userinfo"
 }
 
+// UploadSession is an upload sent in numbered parts, its space check is
+// signed for the declared size when it completes
+type UploadSession struct {
+	ID         string      `gorm:"primarykey"`
+	Address    string      `gorm:"index;column:address"`
+	SType      StorageType `gorm:"column:stype"`
+	Name       string
+	Path       string
+	Size       int64
+	Area       string
+	UserDefine string `gorm:"column:userdefine"`
+	Encrypt    bool
+	OwnerKey   string `gorm:"column:ownerkey"`
+	Created    time.Time
+	Expire     time.Time
+}
+
+func (UploadSession) TableName() string {
+	return "uploadsession"
+}
+
+type UploadPart struct {
+	SessionID string `gorm:"primarykey;column:sessionid"`
+	Number    int    `gorm:"primarykey"`
+	Size      int64
+	MD5       string    `gorm:"column:md5"`
+	ModTime   time.Time `gorm:"column:modtime"`
+}
+
+func (UploadPart) TableName() string {
+	return "uploadpart"
+}
+
+type ReplicaStatus string
+
+const (
+	ReplicaOK     ReplicaStatus = "ok"
+	ReplicaFailed ReplicaStatus = "failed"
+	// ReplicaMissing is a replica its backend no longer has
+	ReplicaMissing ReplicaStatus = "missing"
+)
+
+// ObjectReplica is one copy of a file, Backend names the gateway holding it
+// and Mid is the id of the content there
+type ObjectReplica struct {
+	ID      int           `gorm:"primarykey"`
+	FileID  int           `gorm:"index;column:fileid"`
+	Backend string        `gorm:"column:backend"`
+	SType   StorageType   `gorm:"column:stype"`
+	Area    string        `gorm:"column:area"`
+	Mid     string        `gorm:"column:mid"`
+	Primary bool          `gorm:"column:isprimary"`
+	Status  ReplicaStatus `gorm:"column:status"`
+	Message string        `gorm:"column:message"`
+	ModTime time.Time     `gorm:"column:modtime"`
+	// CheckTime is when the repair worker last probed the replica
+	CheckTime time.Time `gorm:"column:checktime"`
+}
+
+func (ObjectReplica) TableName() string {
+	return "objectreplica"
+}
+
+// RemotePin is the pin of a cid on a remote pinning service, RequestID is
+// the id the service gave to the request
+type RemotePin struct {
+	ID        int       `gorm:"primarykey"`
+	Pinner    string    `gorm:"uniqueIndex:remotepin_composite;column:pinner"`
+	Cid       string    `gorm:"uniqueIndex:remotepin_composite;column:cid"`
+	Name      string    `gorm:"column:name"`
+	RequestID string    `gorm:"column:requestid"`
+	Status    string    `gorm:"index;column:status"`
+	Attempts  int       `gorm:"column:attempts"`
+	Error     string    `gorm:"column:error"`
+	NextTry   time.Time `gorm:"column:nexttry"`
+	Created   time.Time `gorm:"column:created"`
+	Updated   time.Time `gorm:"column:updated"`
+}
+
+func (RemotePin) TableName() string {
+	return "remotepin"
+}
+
+type DerivativeStatus string
+
+const (
+	DerivativeQueued DerivativeStatus = "queued"
+	DerivativeDone   DerivativeStatus = "done"
+	DerivativeFailed DerivativeStatus = "failed"
+	// DerivativeSkipped is a file no derivative can be made of
+	DerivativeSkipped DerivativeStatus = "skipped"
+)
+
+// Derivative is an object made from a file, such as its thumbnail. It is
+// stored next to the file under ObjectKey and goes away with it.
+type Derivative struct {
+	ID          int              `gorm:"primarykey"`
+	FileID      int              `gorm:"uniqueIndex:derivative_kind;column:fileid"`
+	Kind        string           `gorm:"uniqueIndex:derivative_kind;column:kind"`
+	Address     string           `gorm:"column:address"`
+	SType       StorageType      `gorm:"column:stype"`
+	Mid         string           `gorm:"index;column:mid"`
+	ObjectKey   string           `gorm:"column:objectkey"`
+	ContentType string           `gorm:"column:ctype"`
+	Size        int64            `gorm:"column:size"`
+	Status      DerivativeStatus `gorm:"index;column:status"`
+	Attempts    int              `gorm:"column:attempts"`
+	Error       string           `gorm:"column:error"`
+	Created     time.Time        `gorm:"column:created"`
+	Updated     time.Time        `gorm:"column:updated"`
+}
+
+func (Derivative) TableName() string {
+	return "derivative"
+}
+
+// Usage is the space and the number of the files an address holds on a
+// storage. It follows the files as they are recorded and removed, the
+// files in the trash and the older versions still hold their space.
+type Usage struct {
+	Address string      `gorm:"primaryKey;column:address"`
+	SType   StorageType `gorm:"primaryKey;column:stype"`
+	Used    int64       `gorm:"column:used"`
+	Files   int         `gorm:"column:files"`
+	Updated time.Time   `gorm:"column:updated"`
+}
+
+func (Usage) TableName() string {
+	return "usage"
+}
+
+type LedgerKind string
+
+const (
+	LedgerUpload   LedgerKind = "upload"
+	LedgerDownload LedgerKind = "download"
+	// LedgerShare is a download through a share link, it is not charged
+	// to the owner
+	LedgerShare LedgerKind = "share"
+)
+
+// LedgerEntry records a transfer of a file of Address, the owner. Actor is
+// who downloaded a shared file, it is empty for a public link. Entries are
+// only appended.
+type LedgerEntry struct {
+	ID      int         `gorm:"primarykey"`
+	Address string      `gorm:"index:ledger_address;column:address"`
+	SType   StorageType `gorm:"column:stype"`
+	Kind    LedgerKind  `gorm:"column:kind"`
+	FileID  int         `gorm:"index;column:fileid"`
+	Mid     string      `gorm:"column:mid"`
+	Actor   string      `gorm:"column:actor"`
+	Bytes   int64       `gorm:"column:bytes"`
+	Time    time.Time   `gorm:"index:ledger_address;index;column:time"`
+}
+
+func (LedgerEntry) TableName() string {
+	return "ledger"
+}
+
+// LedgerQuery selects the ledger entries to sum up by Period, "day" or
+// "month", and by kind. The fields left empty are not checked, ByFile and
+// ByAddress sum up each file or each address apart.
+type LedgerQuery struct {
+	Address   string
+	SType     *StorageType
+	FileID    int
+	Kind      LedgerKind
+	From      time.Time
+	To        time.Time
+	Period    string
+	ByFile    bool
+	ByAddress bool
+}
+
+// LedgerSum is the number and the bytes of the transfers of a kind in a
+// period, Period is a date like 2006-01-02 or a month like 2006-01
+type LedgerSum struct {
+	Period  string
+	Address string `json:",omitempty"`
+	FileID  int    `json:",omitempty" gorm:"column:fileid"`
+	Kind    LedgerKind
+	Count   int64
+	Bytes   int64
+}
+
+type BillingKind string
+
+const (
+	BillingBuySpace    BillingKind = "buy_space"
+	BillingBuyTraffic  BillingKind = "buy_traffic"
+	BillingCashSpace   BillingKind = "cash_space"
+	BillingCashTraffic BillingKind = "cash_traffic"
+)
+
+// BillingEntry records a purchase made by Address or a check of it cashed
+// out, with the hash of the transaction. A purchase is recorded once its
+// transaction is confirmed, Price is the price of the contract then. A
+// cash-out has the size and the nonce of the check.
+type BillingEntry struct {
+	ID      int         `gorm:"primarykey"`
+	Address string      `gorm:"index:billing_address;column:address"`
+	Kind    BillingKind `gorm:"column:kind"`
+	Size    int64       `gorm:"column:size"`
+	Price   string      `gorm:"column:price"`
+	Nonce   string      `gorm:"column:nonce"`
+	TxHash  string      `gorm:"index;column:txhash"`
+	Time    time.Time   `gorm:"index:billing_address;index;column:time"`
+}
+
+func (BillingEntry) TableName() string {
+	return "billing"
+}
+
+// Purchase is the space or traffic bought by a transaction of the proxy
+type Purchase struct {
+	Kind  BillingKind
+	Buyer common.Address
+	Size  uint64
+}
+
 type PayType uint8
 
 const (
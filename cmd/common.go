@@ -7,4 +7,7 @@ var CommonCmd = []*cli.Command{
 	WalletCmd,
 	VersionCmd,
 	UserCmd,
+	RepairCmd,
+	UsageCmd,
+	StatementCmd,
 }
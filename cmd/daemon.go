@@ -39,6 +39,11 @@ var runCmd = &cli.Command{
 			Usage:   "input your endpoint",
 			Value:   ":8080",
 		},
+		&cli.StringFlag{
+			Name:  "s3-endpoint",
+			Usage: "input the endpoint of the s3 compatible api, empty to disable it",
+			Value: "",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		endPoint := ctx.String("endpoint")
@@ -55,6 +60,24 @@ var runCmd = &cli.Command{
 			}
 		}()
 
+		var s3srv *http.Server
+		if s3EndPoint := ctx.String("s3-endpoint"); s3EndPoint != "" {
+			s3srv = server.NewS3Server(server.ServerOption{Endpoint: s3EndPoint})
+
+			go func() {
+				if err := s3srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("listen s3: %s\n", err)
+				}
+			}()
+		}
+
+		bctx, stopBackground := context.WithCancel(context.Background())
+		defer stopBackground()
+		server.StartRepair(bctx)
+		server.StartPinning(bctx)
+		server.StartTrash(bctx)
+		server.StartDerivatives(bctx)
+
 		pidpath, err := homedir.Expand("./")
 		if err != nil {
 			return nil
@@ -72,12 +95,18 @@ var runCmd = &cli.Command{
 		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 		<-quit
 		log.Println("Shutting down server...")
+		stopBackground()
 
 		cctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(cctx); err != nil {
 			log.Fatal("Server forced to shutdown: ", err)
 		}
+		if s3srv != nil {
+			if err := s3srv.Shutdown(cctx); err != nil {
+				log.Fatal("S3 Server forced to shutdown: ", err)
+			}
+		}
 
 		log.Println("Server exiting")
 		return nil
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/repair"
+	"github.com/urfave/cli/v2"
+)
+
+var RepairCmd = &cli.Command{
+	Name:  "repair",
+	Usage: "replica repair options",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Aliases: []string{"e"},
+			Usage:   "input the url of the running daemon",
+			Value:   "http://localhost:8080",
+		},
+	},
+	Subcommands: []*cli.Command{
+		repairStatusCmd,
+		repairRunCmd,
+		repairReplicasCmd,
+	},
+}
+
+var repairStatusCmd = &cli.Command{
+	Name:  "status",
+	Usage: "show the progress of the repair worker",
+	Action: func(ctx *cli.Context) error {
+		var status repair.Status
+		err := adminRequest(ctx, http.MethodGet, "/admin/repair", &status)
+		if err != nil {
+			return err
+		}
+		printRepairStatus(status)
+		return nil
+	},
+}
+
+var repairRunCmd = &cli.Command{
+	Name:  "run",
+	Usage: "start a repair round now",
+	Action: func(ctx *cli.Context) error {
+		var status repair.Status
+		err := adminRequest(ctx, http.MethodPost, "/admin/repair", &status)
+		if err != nil {
+			return err
+		}
+		fmt.Println("repair round scheduled")
+		return nil
+	},
+}
+
+var repairReplicasCmd = &cli.Command{
+	Name:  "replicas",
+	Usage: "list the replicas that are not healthy",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "status",
+			Aliases: []string{"s"},
+			Usage:   "only list the replicas with this status (failed, missing)",
+		},
+		&cli.IntFlag{
+			Name:    "limit",
+			Aliases: []string{"l"},
+			Usage:   "max number of replicas",
+			Value:   100,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		q := url.Values{}
+		q.Set("limit", fmt.Sprint(ctx.Int("limit")))
+		if status := ctx.String("status"); status != "" {
+			q.Set("status", status)
+		}
+
+		var replicas []api.ObjectReplica
+		err := adminRequest(ctx, http.MethodGet, "/admin/repair/replicas?"+q.Encode(), &replicas)
+		if err != nil {
+			return err
+		}
+		for _, r := range replicas {
+			fmt.Printf("file %d\t%s\t%s\t%s\t%s\n", r.FileID, r.Backend, r.Status, r.CheckTime.Format("2006-01-02 15:04:05"), r.Message)
+		}
+		return nil
+	},
+}
+
+func printRepairStatus(s repair.Status) {
+	fmt.Println("round:", s.Round, "running:", s.Running)
+	fmt.Println("started:", s.Started.Format("2006-01-02 15:04:05"))
+	if !s.Running && !s.Finished.IsZero() {
+		fmt.Println("finished:", s.Finished.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("files: %d replicas: %d healthy: %d repaired: %d failed: %d\n", s.Files, s.Replicas, s.Healthy, s.Repaired, s.Failed)
+	for _, f := range s.Failures {
+		fmt.Printf("  file %d %s on %s: %s\n", f.FileID, f.Name, f.Backend, f.Message)
+	}
+}
+
+// adminRequest calls the admin api of the daemon with the admin token of
+// the local config and decodes the answer into v
+func adminRequest(ctx *cli.Context, method, path string, v interface{}) error {
+	resp, err := adminDo(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// adminDo calls the admin api of the daemon, an answer with an error status
+// is turned into an error
+func adminDo(ctx *cli.Context, method, path string) (*http.Response, error) {
+	endpoint := strings.TrimSuffix(ctx.String("endpoint"), "/")
+	req, err := http.NewRequestWithContext(ctx.Context, method, endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+config.Cfg.AdminToken)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+var StatementCmd = &cli.Command{
+	Name:  "statement",
+	Usage: "export the billing statements of the addresses",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Aliases: []string{"e"},
+			Usage:   "input the url of the running daemon",
+			Value:   "http://localhost:8080",
+		},
+		&cli.StringFlag{
+			Name:    "month",
+			Aliases: []string{"m"},
+			Usage:   "month of the statements like 2006-01, the current one by default",
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "RFC 3339 start of the period, instead of a month",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "RFC 3339 end of the period, instead of a month",
+		},
+		&cli.StringFlag{
+			Name:    "address",
+			Aliases: []string{"a"},
+			Usage:   "only export the statement of this address",
+		},
+		&cli.StringFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Usage:   "csv or json",
+			Value:   "csv",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "file to write the statements to, the standard output by default",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		q := url.Values{}
+		for _, name := range []string{"month", "from", "to", "address", "format"} {
+			if v := ctx.String(name); v != "" {
+				q.Set(name, v)
+			}
+		}
+
+		resp, err := adminDo(ctx, http.MethodGet, "/admin/statements?"+q.Encode())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		var w io.Writer = os.Stdout
+		if output := ctx.String("output"); output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err = io.Copy(w, resp.Body)
+		if err != nil {
+			return err
+		}
+		if ctx.String("output") != "" {
+			fmt.Println("statements written to", ctx.String("output"))
+		}
+		return nil
+	},
+}
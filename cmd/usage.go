@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/memoio/backend/api"
+	"github.com/urfave/cli/v2"
+)
+
+var UsageCmd = &cli.Command{
+	Name:  "usage",
+	Usage: "report the space used by the addresses",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "endpoint",
+			Aliases: []string{"e"},
+			Usage:   "input the url of the running daemon",
+			Value:   "http://localhost:8080",
+		},
+		&cli.StringFlag{
+			Name:    "address",
+			Aliases: []string{"a"},
+			Usage:   "only report this address",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		path := "/admin/usage"
+		if address := ctx.String("address"); address != "" {
+			path += "?" + url.Values{"address": {address}}.Encode()
+		}
+
+		var usage []api.Usage
+		err := adminRequest(ctx, http.MethodGet, path, &usage)
+		if err != nil {
+			return err
+		}
+		printUsage(usage)
+		return nil
+	},
+	Subcommands: []*cli.Command{
+		usageRebuildCmd,
+	},
+}
+
+var usageRebuildCmd = &cli.Command{
+	Name:  "rebuild",
+	Usage: "count the usage again from all the files",
+	Action: func(ctx *cli.Context) error {
+		var usage []api.Usage
+		err := adminRequest(ctx, http.MethodPost, "/admin/usage/rebuild", &usage)
+		if err != nil {
+			return err
+		}
+		printUsage(usage)
+		return nil
+	},
+}
+
+// printUsage prints the usage of each address on each storage, and its
+// total when it uses more than one storage
+func printUsage(usage []api.Usage) {
+	var total api.Usage
+	storages := 0
+	for i, u := range usage {
+		fmt.Printf("%s\t%s\tfiles: %d\tused: %d\n", u.Address, u.SType, u.Files, u.Used)
+		total.Files += u.Files
+		total.Used += u.Used
+		storages++
+		// the usage is ordered by address
+		if i+1 < len(usage) && usage[i+1].Address == u.Address {
+			continue
+		}
+		if storages > 1 {
+			fmt.Printf("%s\ttotal\tfiles: %d\tused: %d\n", u.Address, total.Files, total.Used)
+		}
+		total, storages = api.Usage{}, 0
+	}
+}
@@ -20,6 +20,7 @@ type Config struct {
 	Storage     StorageConfig  `json:"storage"`
 	Contract    ContractConfig `json:"contract"`
 	SecurityKey string         `json:"securityKey"`
+	AdminToken  string         `json:"adminToken"`
 	Domain      string         `json:"domain"`
 	EthDriveUrl string         `json:"ethDriveUrl"`
 	// LensAPIUrl  string                 `json:"lensAPIUrl"`
@@ -28,6 +29,14 @@ type Config struct {
 type StorageConfig struct {
 	Mefs        MefsConfig       `json:"mefs"`
 	Ipfs        IpfsConfig       `json:"ipfs"`
+	Local       LocalConfig      `json:"local"`
+	Qiniu       QiniuConfig      `json:"qiniu"`
+	Replica     ReplicaConfig    `json:"replica"`
+	Repair      RepairConfig     `json:"repair"`
+	Trash       TrashConfig      `json:"trash"`
+	Versioning  VersioningConfig `json:"versioning"`
+	Encryption  EncryptionConfig `json:"encryption"`
+	Thumbnail   ThumbnailConfig  `json:"thumbnail"`
 	Prices      map[string]int64 `json:"prices"`
 	TrafficCost int64            `json:"traffic_cost"`
 }
@@ -39,11 +48,94 @@ type MefsConfig struct {
 
 type IpfsConfig struct {
 	Host string `json:"host"`
+	// Pinners are remote pinning services uploads are also pinned on,
+	// a failed request is tried PinRetries times
+	Pinners    []PinnerConfig `json:"pinners"`
+	PinRetries int            `json:"pinRetries"`
+}
+
+// PinnerConfig is a service implementing the ipfs pinning service api
+type PinnerConfig struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint"`
+	Token    string `json:"token"`
+}
+
+// LocalConfig is the on-disk store used for development and tests
+type LocalConfig struct {
+	Enable bool   `json:"enable"`
+	Path   string `json:"path"`
+}
+
+// QiniuConfig is a qiniu kodo bucket, objects are read from Domain
+type QiniuConfig struct {
+	Enable    bool   `json:"enable"`
+	AccessKey string `json:"accessKey"`
+	SecretKey string `json:"secretKey"`
+	Bucket    string `json:"bucket"`
+	UpHost    string `json:"upHost"`
+	RsHost    string `json:"rsHost"`
+	Domain    string `json:"domain"`
+	Private   bool   `json:"private"`
+}
+
+// ReplicaConfig lists, per storage, the other backends an object uploaded to
+// it is copied to, e.g. {"mefs": [{"storage": "ipfs"}]}
+type ReplicaConfig struct {
+	Enable   bool                        `json:"enable"`
+	Policies map[string][]ReplicaBackend `json:"policies"`
+}
+
+// ReplicaBackend is a storage and, for mefs, the area of the replica
+type ReplicaBackend struct {
+	Storage string `json:"storage"`
+	Area    string `json:"area"`
+}
+
+// RepairConfig is the worker checking the replicas, Interval is a duration
+// such as "1h"
+type RepairConfig struct {
+	Enable   bool   `json:"enable"`
+	Interval string `json:"interval"`
+}
+
+// VersioningConfig keeps the file replaced by a put of its name as an older
+// version, at most Keep of them, 0 keeps them all. Without it the file
+// replaced is moved into the trash.
+type VersioningConfig struct {
+	Enable bool `json:"enable"`
+	Keep   int  `json:"keep"`
+}
+
+// EncryptionConfig lets the objects be encrypted before they are stored,
+// Default encrypts all of them. MasterKey, 32 bytes in hex, seals their keys
+// so they are decrypted on read, the objects are lost with it.
+type EncryptionConfig struct {
+	Enable    bool   `json:"enable"`
+	Default   bool   `json:"default"`
+	MasterKey string `json:"masterKey"`
+}
+
+// ThumbnailConfig makes in the background the thumbnails of the images and
+// the previews of the text files uploaded, the thumbnails fit in Size pixels.
+// Files larger than MaxSize bytes are left out.
+type ThumbnailConfig struct {
+	Enable  bool  `json:"enable"`
+	Size    int   `json:"size"`
+	MaxSize int64 `json:"maxSize"`
+}
+
+// TrashConfig keeps the deleted files for Retention, they are purged by a
+// sweep run every Interval. Both are durations such as "720h".
+type TrashConfig struct {
+	Retention string `json:"retention"`
+	Interval  string `json:"interval"`
 }
 
 func newDefaultIpfsConfig() IpfsConfig {
 	return IpfsConfig{
-		Host: "127.0.0.1:5002",
+		Host:       "127.0.0.1:5002",
+		PinRetries: 5,
 	}
 }
 
@@ -54,10 +146,47 @@ func newDefaultMefsConfig() MefsConfig {
 	}
 }
 
+func newDefaultLocalConfig() LocalConfig {
+	return LocalConfig{
+		Enable: false,
+		Path:   "./localstore",
+	}
+}
+
+func newDefaultQiniuConfig() QiniuConfig {
+	return QiniuConfig{
+		Enable:  false,
+		UpHost:  "https://up.qiniup.com",
+		RsHost:  "https://rs.qiniuapi.com",
+		Private: true,
+	}
+}
+
 func newDefaultStorageConfig() StorageConfig {
 	return StorageConfig{
-		Mefs: newDefaultMefsConfig(),
-		Ipfs: newDefaultIpfsConfig(),
+		Mefs:  newDefaultMefsConfig(),
+		Ipfs:  newDefaultIpfsConfig(),
+		Local: newDefaultLocalConfig(),
+		Qiniu: newDefaultQiniuConfig(),
+		Replica: ReplicaConfig{
+			Policies: make(map[string][]ReplicaBackend),
+		},
+		Repair: RepairConfig{
+			Enable:   false,
+			Interval: "1h",
+		},
+		Trash: TrashConfig{
+			Retention: "720h",
+			Interval:  "1h",
+		},
+		Thumbnail: ThumbnailConfig{
+			Enable:  false,
+			Size:    256,
+			MaxSize: 32 << 20,
+		},
+		Encryption: EncryptionConfig{
+			MasterKey: newDefaultSecurityKeyConfig(),
+		},
 	}
 }
 
@@ -83,6 +212,7 @@ func NewDefaultConfig() *Config {
 		Storage:     newDefaultStorageConfig(),
 		Contract:    newDefaultContractConfig(),
 		SecurityKey: newDefaultSecurityKeyConfig(),
+		AdminToken:  newDefaultSecurityKeyConfig(),
 		Domain:      newDefaultDomainConfig(),
 		EthDriveUrl: "https://ethdrive.net",
 		// LensAPIUrl:  "https://api.lens.dev",
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/memoio/backend/internal/logs"
 	"github.com/memoio/go-did/memo"
 )
 
@@ -99,6 +100,27 @@ func CheckAuthPermission(did string, sig []byte, message ...[]byte) (bool, error
 	return false, nil
 }
 
+// PublicKey returns in hex the public key of the authentication keys of did
+func PublicKey(did string) (string, error) {
+	resolver, err := memo.NewMemoDIDResolver("dev")
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := resolver.Dereference(did + "#authentication")
+	if err != nil {
+		return "", err
+	}
+
+	for _, key := range keys {
+		if key.PublicKeyHex != "" {
+			return key.PublicKeyHex, nil
+		}
+	}
+
+	return "", logs.AuthenticationFailed{Message: "no public key of " + did}
+}
+
 func int64ToBytes(v int64) []byte {
 	return []byte{
 		byte(0xff & v),
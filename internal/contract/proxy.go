@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/memoio/backend/api"
@@ -22,6 +23,55 @@ func (c *Contract) BuyTraffic(ctx context.Context, buyer string, size uint64) (a
 	return c.GetTrasaction(ctx, c.proxyAddr, buyer, "proxy", "buyTraffic", size, common.HexToAddress(buyer))
 }
 
+// GetPurchase returns what the transaction hash bought, the kind is empty
+// when it is not a purchase of the proxy
+func (c *Contract) GetPurchase(ctx context.Context, hash string) (api.Purchase, error) {
+	var res api.Purchase
+	client, err := ethclient.DialContext(ctx, c.endpoint)
+	if err != nil {
+		lerr := logs.ContractError{Message: err.Error()}
+		logger.Error(lerr)
+		return res, lerr
+	}
+	defer client.Close()
+
+	tx, _, err := client.TransactionByHash(ctx, common.HexToHash(hash))
+	if err != nil {
+		lerr := logs.ContractError{Message: err.Error()}
+		logger.Error(lerr)
+		return res, lerr
+	}
+	data := tx.Data()
+	if tx.To() == nil || *tx.To() != c.proxyAddr || len(data) < 4 {
+		return res, nil
+	}
+
+	proxyABI := getContractABI("proxy")
+	method, err := proxyABI.MethodById(data[:4])
+	if err != nil {
+		return res, nil
+	}
+	switch method.Name {
+	case "buySpace":
+		res.Kind = api.BillingBuySpace
+	case "buyTraffic":
+		res.Kind = api.BillingBuyTraffic
+	default:
+		return res, nil
+	}
+
+	// the size comes first and the buyer last
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil || len(args) < 2 {
+		lerr := logs.ContractError{Message: fmt.Sprint("unpack purchase error: ", err)}
+		logger.Error(lerr)
+		return api.Purchase{}, lerr
+	}
+	res.Size = *abi.ConvertType(args[0], new(uint64)).(*uint64)
+	res.Buyer = *abi.ConvertType(args[len(args)-1], new(common.Address)).(*common.Address)
+	return res, nil
+}
+
 func (c *Contract) CashSpaceCheck(ctx context.Context, check api.CheckInfo) (string, error) {
 	client, err := ethclient.DialContext(ctx, c.endpoint)
 	if err != nil {
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// AppendBilling records a purchase or a cash-out, its time is taken in utc.
+// An entry with the hash of a transaction recorded already is skipped.
+func (d *DataBase) AppendBilling(ctx context.Context, entry api.BillingEntry) error {
+	entry.ID = 0
+	entry.Time = entry.Time.UTC()
+	var err error
+	if entry.TxHash == "" {
+		err = d.Create(&entry).Error
+	} else {
+		err = d.Where("txhash = ?", entry.TxHash).Attrs(entry).FirstOrCreate(&api.BillingEntry{}).Error
+	}
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// ListBilling returns the entries of address from the time from and before
+// to, of every address when address is empty, by address and time
+func (d *DataBase) ListBilling(ctx context.Context, address string, from, to time.Time) ([]api.BillingEntry, error) {
+	var entries []api.BillingEntry
+	tx := d.Where("time >= ? and time < ?", from.UTC(), to.UTC()).Order("address, time, id")
+	if address != "" {
+		tx = tx.Where("address = ?", address)
+	}
+	err := tx.Find(&entries).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return entries, nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errContentReleased = errors.New("content was released")
+
+// GetContent returns the content of st hashed as hash, its ID is 0 when no
+// such content is stored
+func (d *DataBase) GetContent(ctx context.Context, st api.StorageType, hash string) (api.Content, error) {
+	var content api.Content
+	err := d.Where("stype = ? and hash = ?", st, hash).Find(&content).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return content, lerr
+	}
+	return content, nil
+}
+
+// PutObjectContent records fi with its replicas as a reference of content,
+// a content without ID is recorded with this first reference. When the same
+// content was recorded meanwhile fi takes a reference of it instead, with
+// its object and replicas, the object of fi is then left to the caller.
+func (d *DataBase) PutObjectContent(ctx context.Context, fi api.FileInfo, replicas []api.ObjectReplica, content api.Content) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		created := false
+		if content.ID == 0 {
+			content.Refs = 1
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&content)
+			if res.Error != nil {
+				return res.Error
+			}
+			created = res.RowsAffected > 0
+			if !created {
+				var shared api.Content
+				err := tx.Where("stype = ? and hash = ?", content.SType, content.Hash).Find(&shared).Error
+				if err != nil {
+					return err
+				}
+				// a content stored in another area is not shared
+				if shared.ID == 0 || shared.Area != content.Area {
+					return putObjectReplicas(tx, fi, replicas)
+				}
+				content = shared
+				fi.Mid, fi.ObjectKey = content.Mid, content.ObjectKey
+				replicas, err = contentReplicas(tx, fi.SType, content.Mid)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if !created {
+			res := tx.Model(&api.Content{}).Where("id = ? and refs > 0", content.ID).
+				Update("refs", gorm.Expr("refs + 1"))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errContentReleased
+			}
+		}
+
+		fi.Hash = content.Hash
+		return putObjectReplicas(tx, fi, replicas)
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// DeleteObjectRef removes the file fi and its reference of its content, the
+// content is returned with true when this was its last reference
+func (d *DataBase) DeleteObjectRef(ctx context.Context, fi api.FileInfo) (api.Content, bool, error) {
+	var content api.Content
+	last := false
+	err := d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&api.ObjectReplica{}, "fileid = ?", fi.ID).Error
+		if err != nil {
+			return err
+		}
+		err = removeObjects(tx, "id = ?", fi.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&api.Content{}).Where("stype = ? and hash = ?", fi.SType, fi.Hash).
+			Update("refs", gorm.Expr("refs - 1")).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("stype = ? and hash = ?", fi.SType, fi.Hash).Find(&content).Error
+		if err != nil || content.ID == 0 || content.Refs > 0 {
+			return err
+		}
+
+		last = true
+		return tx.Delete(&api.Content{}, "id = ?", content.ID).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return content, false, lerr
+	}
+	return content, last, nil
+}
+
+// contentReplicas returns the replicas of the first file stored as mid on
+// storage st
+func contentReplicas(tx *gorm.DB, st api.StorageType, mid string) ([]api.ObjectReplica, error) {
+	var replicas []api.ObjectReplica
+	var fi api.FileInfo
+	err := tx.Where("stype = ? and mid = ?", st, mid).Order("id").Limit(1).Find(&fi).Error
+	if err != nil || fi.ID == 0 {
+		return replicas, err
+	}
+	err = tx.Where("fileid = ?", fi.ID).Order("isprimary desc, id").Find(&replicas).Error
+	return replicas, err
+}
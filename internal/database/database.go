@@ -2,6 +2,9 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/memoio/backend/api"
@@ -20,7 +23,7 @@ type DataBase struct {
 func (d *DataBase) ListObjects(ctx context.Context, address string, st api.StorageType) ([]interface{}, error) {
 	var fileInfos []api.FileInfo
 	var ifileInfos []interface{}
-	err := d.Where("address = ? and stype = ?", address, st).Find(&fileInfos).Error
+	err := d.Where("address = ? and stype = ? and archived = ?", address, st, false).Find(&fileInfos).Error
 	if err != nil {
 		lerr := logs.DataBaseError{Message: err.Error()}
 		logger.Error(lerr)
@@ -34,9 +37,143 @@ func (d *DataBase) ListObjects(ctx context.Context, address string, st api.Stora
 	return ifileInfos, nil
 }
 
+// objectKey is the path and name of a file without the leading slash
+const objectKey = "substr(path, 2) || name"
+
+var sortColumns = map[string]string{
+	"name":    "name",
+	"size":    "size",
+	"modtime": "modtime",
+}
+
+// ListObjectsPage returns a page of the files selected by opts, together
+// with the number of files selected on every page
+func (d *DataBase) ListObjectsPage(ctx context.Context, address string, st api.StorageType, opts api.ListOptions) ([]api.FileInfo, int64, error) {
+	tx := d.Model(&api.FileInfo{}).Where("address = ? and stype = ? and archived = ?", address, st, false)
+	if opts.Prefix != "" {
+		tx = tx.Where("substr("+objectKey+", 1, length(?)) = ?", opts.Prefix, opts.Prefix)
+	}
+	if opts.Delimiter != "" {
+		tx = tx.Where("instr(substr("+objectKey+", length(?) + 1), ?) = 0", opts.Prefix, opts.Delimiter)
+	}
+	if opts.NameContains != "" {
+		tx = tx.Where("instr(name, ?) > 0", opts.NameContains)
+	}
+	if strings.HasSuffix(opts.ContentType, "/") {
+		tx = tx.Where("substr(ctype, 1, length(?)) = ?", opts.ContentType, opts.ContentType)
+	} else if opts.ContentType != "" {
+		tx = tx.Where("ctype = ?", opts.ContentType)
+	}
+	if opts.Public != nil {
+		tx = tx.Where("public = ?", *opts.Public)
+	}
+	if opts.MinSize > 0 {
+		tx = tx.Where("size >= ?", opts.MinSize)
+	}
+	if opts.MaxSize > 0 {
+		tx = tx.Where("size <= ?", opts.MaxSize)
+	}
+	if opts.MinWidth > 0 {
+		tx = tx.Where("width >= ?", opts.MinWidth)
+	}
+	if opts.MinHeight > 0 {
+		tx = tx.Where("height >= ?", opts.MinHeight)
+	}
+	if opts.MinDuration > 0 {
+		tx = tx.Where("duration >= ?", opts.MinDuration)
+	}
+	if opts.MaxDuration > 0 {
+		tx = tx.Where("duration > 0 and duration <= ?", opts.MaxDuration)
+	}
+	if !opts.TakenAfter.IsZero() {
+		tx = tx.Where("taken >= ?", opts.TakenAfter.UTC())
+	}
+	// the files with no date are not before any
+	if !opts.TakenBefore.IsZero() {
+		tx = tx.Where("taken > ? and taken < ?", time.Time{}, opts.TakenBefore.UTC())
+	}
+	for k, v := range opts.Tags {
+		// userdefine of the older files may not be json
+		tag := "case when json_valid(userdefine) then json_extract(userdefine, ?) end"
+		key := `$."` + api.TagPrefix + k + `"`
+		if v == "" {
+			tx = tx.Where(tag+" is not null", key)
+		} else {
+			tx = tx.Where(tag+" = ?", key, v)
+		}
+	}
+
+	var total int64
+	err := tx.Session(&gorm.Session{}).Count(&total).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, 0, lerr
+	}
+
+	cmp, order := ">", ""
+	if opts.Desc {
+		cmp, order = "<", " desc"
+	}
+	column, ok := sortColumns[opts.Sort]
+	if opts.After != nil {
+		var value interface{}
+		switch column {
+		case "name":
+			value = opts.After.Name
+		case "size":
+			value = opts.After.Size
+		case "modtime":
+			value = opts.After.ModTime
+		}
+		if ok {
+			tx = tx.Where(fmt.Sprintf("(%s %s ? or (%s = ? and id %s ?))", column, cmp, column, cmp), value, value, opts.After.ID)
+		} else {
+			tx = tx.Where("id "+cmp+" ?", opts.After.ID)
+		}
+	}
+	if ok {
+		tx = tx.Order(column + order)
+	}
+	tx = tx.Order("id" + order)
+	if opts.Limit > 0 {
+		tx = tx.Limit(opts.Limit)
+	}
+
+	var fileInfos []api.FileInfo
+	err = tx.Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, 0, lerr
+	}
+
+	return fileInfos, total, nil
+}
+
+// ListCommonPrefixes returns the distinct starts of the file and folder
+// keys up to the first delimiter after prefix
+func (d *DataBase) ListCommonPrefixes(ctx context.Context, address string, st api.StorageType, prefix, delimiter string) ([]string, error) {
+	var prefixes []string
+	err := d.Raw(`select distinct substr(k, 1, length(@prefix) + instr(substr(k, length(@prefix) + 1), @delimiter) + length(@delimiter) - 1) as p
+		from (select `+objectKey+` as k from fileinfo where address = @address and stype = @stype and deleted is null and not archived
+			union all select substr(path, 2) as k from folder where address = @address and stype = @stype)
+		where substr(k, 1, length(@prefix)) = @prefix and instr(substr(k, length(@prefix) + 1), @delimiter) > 0
+		order by p`,
+		map[string]interface{}{"address": address, "stype": st, "prefix": prefix, "delimiter": delimiter}).
+		Scan(&prefixes).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return prefixes, nil
+}
+
 func (d *DataBase) GetObjectInfo(ctx context.Context, address, mid string, st api.StorageType) (interface{}, error) {
 	var result api.FileInfo
-	err := d.Where("address = ? and mid = ? and stype = ?", address, mid, st).Find(&result).Error
+	// the current version comes before the older ones of the same content
+	err := d.Where("address = ? and mid = ? and stype = ?", address, mid, st).Order("archived").Find(&result).Error
 	if err != nil {
 		lerr := logs.DataBaseError{Message: err.Error()}
 		logger.Error(err)
@@ -58,13 +195,150 @@ func (d *DataBase) GetObjectInfoById(ctx context.Context, id int) (interface{},
 	return result, err
 }
 
+// DeleteObject removes the file together with its replicas, a file in the
+// trash included
 func (d *DataBase) DeleteObject(ctx context.Context, id int) error {
-	return d.Delete(&api.FileInfo{}, "id = ?", id).Error
+	return d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&api.ObjectReplica{}, "fileid = ?", id).Error
+		if err != nil {
+			return err
+		}
+		return removeObjects(tx, "id = ?", id)
+	})
 }
 
-func (d *DataBase) PutObject(ctx context.Context, fi api.FileInfo) error {
-	if err := d.Create(&fi).Error; err != nil {
-		return err
+// CountObjectsByMid returns the number of files of any address stored as mid,
+// the files in the trash still hold their object
+func (d *DataBase) CountObjectsByMid(ctx context.Context, st api.StorageType, mid string) (int64, error) {
+	var count int64
+	err := d.Unscoped().Model(&api.FileInfo{}).Where("stype = ? and mid = ?", st, mid).Count(&count).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return 0, lerr
+	}
+	return count, nil
+}
+
+// CountObjectsByKey returns the number of files of address, and of contents
+// stored by address, using the object key on the storage. The files in the
+// trash are counted.
+func (d *DataBase) CountObjectsByKey(ctx context.Context, address string, st api.StorageType, key string) (int64, error) {
+	var count, contents int64
+	err := d.Unscoped().Model(&api.FileInfo{}).
+		Where("address = ? and stype = ? and (objectkey = ? or (objectkey = '' and path = '/' and name = ?))", address, st, key, key).
+		Count(&count).Error
+	if err == nil {
+		err = d.Model(&api.Content{}).Where("address = ? and stype = ? and objectkey = ?", address, st, key).Count(&contents).Error
+	}
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return 0, lerr
+	}
+	return count + contents, nil
+}
+
+// CountObjectsByName returns the number of current files of address named
+// name in the folder path
+func (d *DataBase) CountObjectsByName(ctx context.Context, address string, st api.StorageType, path, name string) (int64, error) {
+	var count int64
+	err := d.Model(&api.FileInfo{}).Where("address = ? and stype = ? and path = ? and name = ? and archived = ?", address, st, path, name, false).Count(&count).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return 0, lerr
+	}
+	return count, nil
+}
+
+// RenameObject changes the folder and name of the file id and of its older
+// versions, the object on the storage keeps its key
+func (d *DataBase) RenameObject(ctx context.Context, id int, path, name string) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		var fi api.FileInfo
+		err := tx.Where("id = ?", id).First(&fi).Error
+		if err != nil {
+			return err
+		}
+		return versionsOf(tx.Model(&api.FileInfo{}), fi).
+			Updates(map[string]interface{}{"path": path, "name": name}).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
 	}
 	return nil
 }
+
+// CopyObject records fi as a new file sharing the object, and the replicas,
+// of the file id
+func (d *DataBase) CopyObject(ctx context.Context, id int, fi api.FileInfo) (api.FileInfo, error) {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		fi.ID = 0
+		err := tx.Create(&fi).Error
+		if err != nil {
+			return err
+		}
+		err = addUsage(tx, fi, 1)
+		if err != nil {
+			return err
+		}
+
+		// a shared content gains a reference
+		if fi.Hash != "" {
+			err = tx.Model(&api.Content{}).Where("stype = ? and hash = ?", fi.SType, fi.Hash).
+				Update("refs", gorm.Expr("refs + 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var replicas []api.ObjectReplica
+		err = tx.Where("fileid = ?", id).Find(&replicas).Error
+		if err != nil || len(replicas) == 0 {
+			return err
+		}
+		for i := range replicas {
+			replicas[i].ID = 0
+			replicas[i].FileID = fi.ID
+		}
+		return tx.Create(&replicas).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return fi, lerr
+	}
+	return fi, nil
+}
+
+// UpdateUserDefine replaces the user defined values of the file id
+func (d *DataBase) UpdateUserDefine(ctx context.Context, id int, userdefine string) error {
+	err := d.Model(&api.FileInfo{}).Where("id = ?", id).Update("userdefine", userdefine).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// WithTransaction runs fn on a database whose changes are committed together
+// once fn returns nil, the transactions fn starts are nested in it
+func (d *DataBase) WithTransaction(ctx context.Context, fn func(api.IDataBase) error) error {
+	return d.Transaction(func(tx *gorm.DB) error {
+		return fn(&DataBase{DB: tx})
+	})
+}
+
+func (d *DataBase) PutObject(ctx context.Context, fi api.FileInfo) error {
+	return d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&fi).Error
+		if err != nil {
+			return err
+		}
+		return addUsage(tx, fi, 1)
+	})
+}
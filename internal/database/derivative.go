@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QueueDerivatives records derivatives to be made, the ones already
+// recorded are kept
+func (d *DataBase) QueueDerivatives(ctx context.Context, derivatives []api.Derivative) error {
+	if len(derivatives) == 0 {
+		return nil
+	}
+	err := d.Clauses(clause.OnConflict{DoNothing: true}).Create(&derivatives).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// ListQueuedDerivatives returns at most limit derivatives to be made whose
+// ID is above after, the oldest first
+func (d *DataBase) ListQueuedDerivatives(ctx context.Context, after, limit int) ([]api.Derivative, error) {
+	var derivatives []api.Derivative
+	err := d.Where("status = ? and id > ?", api.DerivativeQueued, after).Order("id").Limit(limit).Find(&derivatives).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return derivatives, nil
+}
+
+func (d *DataBase) UpdateDerivative(ctx context.Context, derivative api.Derivative) error {
+	err := d.Save(&derivative).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// GetDerivative returns the derivative kind of the file id, its ID is 0 when
+// there is none
+func (d *DataBase) GetDerivative(ctx context.Context, fileID int, kind string) (api.Derivative, error) {
+	var derivative api.Derivative
+	err := d.Where("fileid = ? and kind = ?", fileID, kind).Find(&derivative).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return derivative, lerr
+	}
+	return derivative, nil
+}
+
+func (d *DataBase) ListDerivatives(ctx context.Context, fileIDs []int) ([]api.Derivative, error) {
+	var derivatives []api.Derivative
+	if len(fileIDs) == 0 {
+		return derivatives, nil
+	}
+	err := d.Where("fileid in ?", fileIDs).Order("fileid, kind").Find(&derivatives).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return derivatives, nil
+}
+
+// DeleteDerivatives forgets the derivatives of the file id, it returns them
+// so their objects can be deleted
+func (d *DataBase) DeleteDerivatives(ctx context.Context, fileID int) ([]api.Derivative, error) {
+	var derivatives []api.Derivative
+	err := d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("fileid = ?", fileID).Find(&derivatives).Error
+		if err != nil || len(derivatives) == 0 {
+			return err
+		}
+		return tx.Delete(&api.Derivative{}, "fileid = ?", fileID).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return derivatives, nil
+}
+
+// CountDerivativesByMid counts the derivatives stored as mid on storage st
+func (d *DataBase) CountDerivativesByMid(ctx context.Context, st api.StorageType, mid string) (int64, error) {
+	var count int64
+	err := d.Model(&api.Derivative{}).Where("stype = ? and mid = ?", st, mid).Count(&count).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return 0, lerr
+	}
+	return count, nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// underPath selects the rows whose path starts with path, unlike a like
+// clause the comparison is case sensitive
+func underPath(tx *gorm.DB, address string, st api.StorageType, path string) *gorm.DB {
+	return tx.Where("address = ? and stype = ? and substr(path, 1, length(?)) = ?", address, st, path, path)
+}
+
+// ListObjectsByPath returns the current files in the folder path and in its
+// sub folders
+func (d *DataBase) ListObjectsByPath(ctx context.Context, address string, st api.StorageType, path string) ([]api.FileInfo, error) {
+	var fileInfos []api.FileInfo
+	err := underPath(d.DB, address, st, path).Where("archived = ?", false).Order("path, name").Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return fileInfos, nil
+}
+
+// CreateFolders records the folders, the ones already recorded are kept
+func (d *DataBase) CreateFolders(ctx context.Context, folders []api.Folder) error {
+	if len(folders) == 0 {
+		return nil
+	}
+	err := d.Clauses(clause.OnConflict{DoNothing: true}).Create(&folders).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// ListFolders returns the folder path and the folders under it
+func (d *DataBase) ListFolders(ctx context.Context, address string, st api.StorageType, path string) ([]api.Folder, error) {
+	var folders []api.Folder
+	err := underPath(d.DB, address, st, path).Order("path").Find(&folders).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return folders, nil
+}
+
+// MoveFolder renames the folder from to, the folders and files under it
+// are moved along
+func (d *DataBase) MoveFolder(ctx context.Context, address string, st api.StorageType, from, to string) error {
+	rename := gorm.Expr("? || substr(path, length(?) + 1)", to, from)
+	err := d.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&api.Folder{}, &api.FileInfo{}} {
+			err := underPath(tx.Model(model), address, st, from).Update("path", rename).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// DeleteFolders forgets the folder path and the folders under it
+func (d *DataBase) DeleteFolders(ctx context.Context, address string, st api.StorageType, path string) error {
+	err := underPath(d.DB, address, st, path).Delete(&api.Folder{}).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
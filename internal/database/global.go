@@ -1,13 +1,15 @@
 package database
 
 import (
+	"context"
+
 	"github.com/memoio/backend/api"
 	"github.com/memoio/backend/internal/storage"
 	"gorm.io/gorm"
 )
 
 func Put(fi api.FileInfo) (bool, error) {
-	if err := GlobalDataBase.Create(&fi).Error; err != nil {
+	if err := NewDataBase().PutObject(context.Background(), fi); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"time"
 
 	"github.com/memoio/backend/api"
@@ -33,7 +34,17 @@ func init() {
 		logger.Panicf("Failed to ping database: %s", err.Error())
 	}
 	GlobalDataBase = db
-	GlobalDataBase.AutoMigrate(&api.FileInfo{}, &api.USerInfo{})
+	// the usage of the files recorded before it was kept is counted once
+	countUsage := !GlobalDataBase.Migrator().HasTable(&api.Usage{})
+	GlobalDataBase.AutoMigrate(&api.FileInfo{}, &api.USerInfo{}, &api.UploadSession{}, &api.UploadPart{}, &api.ObjectReplica{}, &api.RemotePin{}, &api.Folder{}, &api.Content{}, &api.Derivative{}, &api.Usage{}, &api.LedgerEntry{}, &api.BillingEntry{})
+	if countUsage {
+		NewDataBase().RebuildUsage(context.Background())
+	}
+
+	// the files are unique per version since they are versioned
+	if GlobalDataBase.Migrator().HasIndex(&api.FileInfo{}, "file_composite") {
+		GlobalDataBase.Migrator().DropIndex(&api.FileInfo{}, "file_composite")
+	}
 }
 
 func NewDataBase() *DataBase {
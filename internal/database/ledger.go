@@ -0,0 +1,78 @@
+package database
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// ledgerPeriods are the dates the entries are summed up by, the times are
+// stored in utc
+var ledgerPeriods = map[string]string{
+	"day":   "strftime('%Y-%m-%d', time)",
+	"month": "strftime('%Y-%m', time)",
+}
+
+// AppendLedger records a transfer, its time is taken in utc
+func (d *DataBase) AppendLedger(ctx context.Context, entry api.LedgerEntry) error {
+	entry.ID = 0
+	entry.Time = entry.Time.UTC()
+	err := d.Create(&entry).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// SumLedger sums up the entries selected by q, the oldest period first and
+// the most bytes first in a period
+func (d *DataBase) SumLedger(ctx context.Context, q api.LedgerQuery) ([]api.LedgerSum, error) {
+	period, ok := ledgerPeriods[q.Period]
+	if !ok {
+		lerr := logs.DataBaseError{Message: "period should be day or month"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	columns := "kind"
+	if q.ByAddress {
+		columns += ", address"
+	}
+	if q.ByFile {
+		columns += ", fileid"
+	}
+	tx := d.Model(&api.LedgerEntry{}).
+		Select(period + " as period, " + columns + ", count(*) as count, sum(bytes) as bytes").
+		Group("period, " + columns).Order("period, bytes desc")
+
+	if q.Address != "" {
+		tx = tx.Where("address = ?", q.Address)
+	}
+	if q.SType != nil {
+		tx = tx.Where("stype = ?", *q.SType)
+	}
+	if q.FileID != 0 {
+		tx = tx.Where("fileid = ?", q.FileID)
+	}
+	if q.Kind != "" {
+		tx = tx.Where("kind = ?", q.Kind)
+	}
+	if !q.From.IsZero() {
+		tx = tx.Where("time >= ?", q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("time < ?", q.To.UTC())
+	}
+
+	var sums []api.LedgerSum
+	err := tx.Scan(&sums).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return sums, nil
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+)
+
+// PutObjectReplicas records a file together with its replicas
+func (d *DataBase) PutObjectReplicas(ctx context.Context, fi api.FileInfo, replicas []api.ObjectReplica) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		return putObjectReplicas(tx, fi, replicas)
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func putObjectReplicas(tx *gorm.DB, fi api.FileInfo, replicas []api.ObjectReplica) error {
+	err := tx.Create(&fi).Error
+	if err != nil {
+		return err
+	}
+	err = addUsage(tx, fi, 1)
+	if err != nil {
+		return err
+	}
+	for i := range replicas {
+		replicas[i].ID = 0
+		replicas[i].FileID = fi.ID
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+	return tx.Create(&replicas).Error
+}
+
+func (d *DataBase) ListObjectReplicas(ctx context.Context, fileIDs []int) ([]api.ObjectReplica, error) {
+	var replicas []api.ObjectReplica
+	if len(fileIDs) == 0 {
+		return replicas, nil
+	}
+	err := d.Where("fileid in ?", fileIDs).Order("fileid, isprimary desc, id").Find(&replicas).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return replicas, nil
+}
+
+// ListObjectReplicasByMid returns the replicas of the first file stored as
+// mid on storage st
+func (d *DataBase) ListObjectReplicasByMid(ctx context.Context, st api.StorageType, mid string) ([]api.ObjectReplica, error) {
+	var fi api.FileInfo
+	err := d.Where("stype = ? and mid = ?", st, mid).Order("id").Limit(1).Find(&fi).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	if fi.ID == 0 {
+		return nil, nil
+	}
+	return d.ListObjectReplicas(ctx, []int{fi.ID})
+}
+
+func (d *DataBase) UpdateObjectReplica(ctx context.Context, replica api.ObjectReplica) error {
+	if err := d.Save(&replica).Error; err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+)
+
+// TrashObject moves the file id into the trash together with its older
+// versions, their replicas are kept until they are purged
+func (d *DataBase) TrashObject(ctx context.Context, id int) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		var fi api.FileInfo
+		err := tx.Where("id = ?", id).First(&fi).Error
+		if err != nil {
+			return err
+		}
+		return versionsOf(tx.Model(&api.FileInfo{}), fi).Update("deleted", time.Now()).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// GetTrashedObject returns the file id if it is in the trash, its ID is 0
+// otherwise
+func (d *DataBase) GetTrashedObject(ctx context.Context, id int) (api.FileInfo, error) {
+	var fi api.FileInfo
+	err := d.Unscoped().Where("id = ? and deleted is not null", id).Find(&fi).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return fi, lerr
+	}
+	return fi, nil
+}
+
+// FindTrashedObject returns the file in the trash that fi would replace,
+// the one with the same content, name and folder. Its ID is 0 when there
+// is none.
+func (d *DataBase) FindTrashedObject(ctx context.Context, fi api.FileInfo) (api.FileInfo, error) {
+	var trashed api.FileInfo
+	err := d.Unscoped().
+		Where("chainid = ? and address = ? and stype = ? and mid = ? and path = ? and name = ? and deleted is not null and not archived",
+			fi.ChainID, fi.Address, fi.SType, fi.Mid, fi.Path, fi.Name).
+		Find(&trashed).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return trashed, lerr
+	}
+	return trashed, nil
+}
+
+// RestoreObject takes the file fi.ID out of the trash into the folder and
+// under the name of fi, with its time and user defined values. The older
+// versions trashed with it are restored along.
+func (d *DataBase) RestoreObject(ctx context.Context, fi api.FileInfo) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		var trashed api.FileInfo
+		err := tx.Unscoped().Where("id = ? and deleted is not null", fi.ID).First(&trashed).Error
+		if err != nil {
+			return err
+		}
+		if !trashed.Archived {
+			err = tx.Unscoped().Model(&api.FileInfo{}).
+				Where("address = ? and stype = ? and path = ? and name = ? and archived and deleted = ?",
+					trashed.Address, trashed.SType, trashed.Path, trashed.Name, trashed.Deleted).
+				Updates(map[string]interface{}{"deleted": nil, "path": fi.Path, "name": fi.Name}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Model(&api.FileInfo{}).Where("id = ?", fi.ID).
+			Updates(map[string]interface{}{
+				"deleted":    nil,
+				"path":       fi.Path,
+				"name":       fi.Name,
+				"modtime":    fi.ModTime,
+				"userdefine": fi.UserDefine,
+				"ctype":      fi.ContentType,
+			}).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// ListTrash returns the files of address in the trash, the last deleted
+// first, with their number. The older versions trashed with a file are not
+// listed.
+func (d *DataBase) ListTrash(ctx context.Context, address string, st api.StorageType, offset, limit int) ([]api.FileInfo, int64, error) {
+	tx := d.Unscoped().Model(&api.FileInfo{}).Where("address = ? and stype = ? and deleted is not null and not archived", address, st)
+
+	var total int64
+	err := tx.Count(&total).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, 0, lerr
+	}
+
+	var fileInfos []api.FileInfo
+	tx = tx.Order("deleted desc, id desc").Offset(offset)
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	err = tx.Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, 0, lerr
+	}
+	return fileInfos, total, nil
+}
+
+// ListExpiredTrash returns at most limit files of any address deleted
+// before before, in id order after the id after
+func (d *DataBase) ListExpiredTrash(ctx context.Context, before time.Time, after, limit int) ([]api.FileInfo, error) {
+	var fileInfos []api.FileInfo
+	err := d.Unscoped().Where("deleted < ? and id > ?", before, after).Order("id").Limit(limit).Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return fileInfos, nil
+}
+
+// ListTrashedVersions returns the older versions trashed with the file fi
+func (d *DataBase) ListTrashedVersions(ctx context.Context, fi api.FileInfo) ([]api.FileInfo, error) {
+	var fileInfos []api.FileInfo
+	err := d.Unscoped().
+		Where("address = ? and stype = ? and path = ? and name = ? and archived and deleted = ?",
+			fi.Address, fi.SType, fi.Path, fi.Name, fi.Deleted).
+		Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return fileInfos, nil
+}
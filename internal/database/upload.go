@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+)
+
+var errNoUploadSession = errors.New("upload session not exist")
+
+func (d *DataBase) CreateUploadSession(ctx context.Context, us api.UploadSession) error {
+	if err := d.Create(&us).Error; err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (d *DataBase) GetUploadSession(ctx context.Context, id string) (api.UploadSession, error) {
+	var result api.UploadSession
+	err := d.Where("id = ?", id).First(&result).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return result, logs.ControllerError{Message: "upload session not exist"}
+		}
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	return result, nil
+}
+
+// DeleteUploadSession removes the session together with its parts, it fails
+// when the session was already removed
+func (d *DataBase) DeleteUploadSession(ctx context.Context, id string) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&api.UploadPart{}, "sessionid = ?", id).Error
+		if err != nil {
+			return err
+		}
+		res := tx.Delete(&api.UploadSession{}, "id = ?", id)
+		if res.Error == nil && res.RowsAffected == 0 {
+			return errNoUploadSession
+		}
+		return res.Error
+	})
+	if err == errNoUploadSession {
+		return logs.ControllerError{Message: "upload session not exist"}
+	}
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (d *DataBase) ListExpiredUploadSessions(ctx context.Context, now time.Time) ([]api.UploadSession, error) {
+	var sessions []api.UploadSession
+	err := d.Where("expire < ?", now).Find(&sessions).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return sessions, nil
+}
+
+// PutUploadPart records a received part, a part sent again replaces the old one
+func (d *DataBase) PutUploadPart(ctx context.Context, part api.UploadPart) error {
+	if err := d.Save(&part).Error; err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (d *DataBase) ListUploadParts(ctx context.Context, id string) ([]api.UploadPart, error) {
+	var parts []api.UploadPart
+	err := d.Where("sessionid = ?", id).Order("number").Find(&parts).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return parts, nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// addUsage counts the file fi n times in the usage of its address, n is 1
+// when fi is recorded and -1 when it is removed. It runs in the transaction
+// changing fileinfo so both stay in step.
+func addUsage(tx *gorm.DB, fi api.FileInfo, n int) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "address"}, {Name: "stype"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "used"}, Value: gorm.Expr("used + ?", fi.Size*int64(n))},
+			{Column: clause.Column{Name: "files"}, Value: gorm.Expr("files + ?", n)},
+			{Column: clause.Column{Name: "updated"}, Value: gorm.Expr("excluded.updated")},
+		},
+	}).Create(&api.Usage{
+		Address: fi.Address,
+		SType:   fi.SType,
+		Used:    fi.Size * int64(n),
+		Files:   n,
+		Updated: time.Now(),
+	}).Error
+}
+
+// removeObjects removes the files matching the conditions from fileinfo,
+// the ones in the trash included, and from the usage of their addresses
+func removeObjects(tx *gorm.DB, query interface{}, args ...interface{}) error {
+	var files []api.FileInfo
+	err := tx.Unscoped().Where(query, args...).Find(&files).Error
+	if err != nil || len(files) == 0 {
+		return err
+	}
+	for _, fi := range files {
+		err = addUsage(tx, fi, -1)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Unscoped().Where(query, args...).Delete(&api.FileInfo{}).Error
+}
+
+// ListUsage returns the usage of address on each storage, or the usage of
+// every address when address is empty
+func (d *DataBase) ListUsage(ctx context.Context, address string) ([]api.Usage, error) {
+	var usage []api.Usage
+	tx := d.Order("address, stype")
+	if address != "" {
+		tx = tx.Where("address = ?", address)
+	}
+	err := tx.Find(&usage).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return usage, nil
+}
+
+// RebuildUsage counts the usage again from all of fileinfo, it fills the
+// usage of the files recorded before it was kept
+func (d *DataBase) RebuildUsage(ctx context.Context) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&api.Usage{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO usage (address, stype, used, files, updated) "+
+			"SELECT address, stype, SUM(size), COUNT(*), ? FROM fileinfo GROUP BY address, stype", time.Now()).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+)
+
+// versionsOf selects the file fi with its older versions when fi is the
+// current version, only fi otherwise
+func versionsOf(tx *gorm.DB, fi api.FileInfo) *gorm.DB {
+	if fi.Archived {
+		return tx.Where("id = ?", fi.ID)
+	}
+	return tx.Where("address = ? and stype = ? and path = ? and name = ? and (id = ? or archived)",
+		fi.Address, fi.SType, fi.Path, fi.Name, fi.ID)
+}
+
+// GetCurrentObject returns the current version of the file of address named
+// name in the folder path, its ID is 0 when there is none
+func (d *DataBase) GetCurrentObject(ctx context.Context, address string, st api.StorageType, path, name string) (api.FileInfo, error) {
+	var fi api.FileInfo
+	err := d.Where("address = ? and stype = ? and path = ? and name = ? and archived = ?", address, st, path, name, false).
+		Order("version desc").Find(&fi).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return fi, lerr
+	}
+	return fi, nil
+}
+
+// NextVersion returns the version a new file named name in the folder path
+// gets, the versions in the trash are counted
+func (d *DataBase) NextVersion(ctx context.Context, address string, st api.StorageType, path, name string) (int, error) {
+	var version int
+	err := d.Unscoped().Model(&api.FileInfo{}).Select("coalesce(max(version), 0)").
+		Where("address = ? and stype = ? and path = ? and name = ?", address, st, path, name).
+		Scan(&version).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return 0, lerr
+	}
+	return version + 1, nil
+}
+
+// ArchiveObject makes the file id an older version, or the current one
+// again when archived is false
+func (d *DataBase) ArchiveObject(ctx context.Context, id int, archived bool) error {
+	err := d.Model(&api.FileInfo{}).Where("id = ?", id).Update("archived", archived).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// ListVersions returns the versions of the file of address named name in
+// the folder path, the last one first
+func (d *DataBase) ListVersions(ctx context.Context, address string, st api.StorageType, path, name string) ([]api.FileInfo, error) {
+	var fileInfos []api.FileInfo
+	err := d.Where("address = ? and stype = ? and path = ? and name = ?", address, st, path, name).
+		Order("version desc").Find(&fileInfos).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	return fileInfos, nil
+}
+
+// SetCurrentVersion makes the file id the current version of its name, the
+// current one becomes an older version
+func (d *DataBase) SetCurrentVersion(ctx context.Context, id int) error {
+	err := d.Transaction(func(tx *gorm.DB) error {
+		var fi api.FileInfo
+		err := tx.Where("id = ?", id).First(&fi).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&api.FileInfo{}).
+			Where("address = ? and stype = ? and path = ? and name = ?", fi.Address, fi.SType, fi.Path, fi.Name).
+			Update("archived", true).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&api.FileInfo{}).Where("id = ?", id).Update("archived", false).Error
+	})
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
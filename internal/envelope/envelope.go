@@ -0,0 +1,139 @@
+package envelope
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+)
+
+var (
+	ErrMasterKey = errors.New("encryption master key should be 32 bytes in hex")
+	ErrPublicKey = errors.New("public key should be a secp256k1 key in hex")
+)
+
+var master struct {
+	sync.Once
+	key []byte
+	err error
+}
+
+// MasterKey is the key of the encryption config sealing the data keys
+func MasterKey() ([]byte, error) {
+	master.Do(func() {
+		master.key, master.err = ParseKey(config.Cfg.Storage.Encryption.MasterKey)
+	})
+	return master.key, master.err
+}
+
+// ParseKey parses a key of KeySize bytes in hex
+func ParseKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil || len(key) != KeySize {
+		return nil, ErrMasterKey
+	}
+	return key, nil
+}
+
+// NewKey returns a random data key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+// SealKey seals the data key with the master key, the nonce goes first
+func SealKey(master, key []byte) (string, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return "", err
+	}
+	n := make([]byte, aead.NonceSize())
+	_, err = rand.Read(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(aead.Seal(n, n, key, nil)), nil
+}
+
+// OpenKey opens a data key sealed by SealKey
+func OpenKey(master []byte, sealed string) ([]byte, error) {
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(sealed)
+	if err != nil || len(b) < aead.NonceSize() {
+		return nil, ErrCorrupted
+	}
+	key, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return key, nil
+}
+
+// ParsePublicKey parses a secp256k1 public key in hex, compressed or not
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return nil, ErrPublicKey
+	}
+	var pub *ecdsa.PublicKey
+	if len(b) == 33 {
+		pub, err = crypto.DecompressPubkey(b)
+	} else {
+		pub, err = crypto.UnmarshalPubkey(b)
+	}
+	if err != nil {
+		return nil, ErrPublicKey
+	}
+	return pub, nil
+}
+
+// WrapKey encrypts the data key to pub with ecies, only the owner of its
+// private key can unwrap it
+func WrapKey(pub *ecdsa.PublicKey, key []byte) (string, error) {
+	b, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), key, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetObject reads the object of fi from store into w, an encrypted one is
+// decrypted. The offset and length of opts select bytes of the content.
+func GetObject(ctx context.Context, store api.IGateway, fi api.FileInfo, w io.Writer, opts api.ObjectOptions) error {
+	if fi.DataKey == "" {
+		return store.GetObject(ctx, fi.Mid, w, opts)
+	}
+
+	mk, err := MasterKey()
+	if err != nil {
+		return err
+	}
+	key, err := OpenKey(mk, fi.DataKey)
+	if err != nil {
+		return err
+	}
+	dw, err := NewWriter(w, key, fi.Size, opts.Offset, opts.Length)
+	if err != nil {
+		return err
+	}
+
+	opts.Offset, opts.Length = SealedRange(fi.Size, opts.Offset, opts.Length)
+	err = store.GetObject(ctx, fi.Mid, dw, opts)
+	if err != nil {
+		return err
+	}
+	return dw.Close()
+}
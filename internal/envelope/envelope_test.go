@@ -0,0 +1,147 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+func seal(t *testing.T, key, plain []byte) []byte {
+	r, err := NewReader(bytes.NewReader(plain), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Size() != int64(len(plain)) {
+		t.Fatalf("size %d, want %d", r.Size(), len(plain))
+	}
+	return sealed
+}
+
+func open(key, sealed []byte, size, offset, length int64) ([]byte, error) {
+	var out bytes.Buffer
+	w, err := NewWriter(&out, key, size, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	start, n := SealedRange(size, offset, length)
+	// the chunks are written in pieces of any size
+	part := sealed[start : start+n]
+	for len(part) > 0 {
+		m := 1000
+		if m > len(part) {
+			m = len(part)
+		}
+		_, err = w.Write(part[:m])
+		if err != nil {
+			return nil, err
+		}
+		part = part[m:]
+	}
+	return out.Bytes(), w.Close()
+}
+
+func TestStream(t *testing.T) {
+	key, _ := NewKey()
+	for _, size := range []int{0, 1, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 5} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		sealed := seal(t, key, plain)
+		if int64(len(sealed)) != SealedSize(int64(size)) {
+			t.Fatalf("sealed size %d, want %d", len(sealed), SealedSize(int64(size)))
+		}
+
+		got, err := open(key, sealed, int64(size), 0, 0)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: decrypted content differs: %v", size, err)
+		}
+
+		ranges := [][2]int64{{0, 1}, {int64(size) - 1, 1}, {ChunkSize - 2, 4}, {5, int64(size) - 5}}
+		for _, r := range ranges {
+			if r[0] < 0 || r[1] <= 0 || r[0]+r[1] > int64(size) {
+				continue
+			}
+			got, err := open(key, sealed, int64(size), r[0], r[1])
+			if err != nil || !bytes.Equal(got, plain[r[0]:r[0]+r[1]]) {
+				t.Fatalf("size %d: range %v differs: %v", size, r, err)
+			}
+		}
+	}
+}
+
+func TestStreamCorrupted(t *testing.T) {
+	key, _ := NewKey()
+	plain := make([]byte, 2*ChunkSize+10)
+	sealed := seal(t, key, plain)
+	size := int64(len(plain))
+
+	flipped := append([]byte{}, sealed...)
+	flipped[ChunkSize+tagSize+3] ^= 1
+	_, err := open(key, flipped, size, 0, 0)
+	if err != ErrCorrupted {
+		t.Fatalf("flipped byte: %v", err)
+	}
+
+	// a full chunk cut from the end is not taken as the last one
+	_, err = open(key, sealed[:2*(ChunkSize+tagSize)], 2*ChunkSize, 0, 0)
+	if err != ErrCorrupted {
+		t.Fatalf("cut object: %v", err)
+	}
+
+	var out bytes.Buffer
+	w, _ := NewWriter(&out, key, size, 0, 0)
+	w.Write(sealed[:len(sealed)-1])
+	if w.Close() != ErrCorrupted {
+		t.Fatal("short object is not reported")
+	}
+}
+
+func TestKeys(t *testing.T) {
+	master, _ := NewKey()
+	key, _ := NewKey()
+
+	sealed, err := SealKey(master, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenKey(master, sealed)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("sealed key differs: %v", err)
+	}
+	other, _ := NewKey()
+	_, err = OpenKey(other, sealed)
+	if err != ErrCorrupted {
+		t.Fatalf("opened with another master key: %v", err)
+	}
+
+	sk, _ := crypto.GenerateKey()
+	for _, pub := range [][]byte{crypto.FromECDSAPub(&sk.PublicKey), crypto.CompressPubkey(&sk.PublicKey)} {
+		pk, err := ParsePublicKey("0x" + hex.EncodeToString(pub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapped, err := WrapKey(pk, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := hex.DecodeString(wrapped)
+		got, err := ecies.ImportECDSA(sk).Decrypt(b, nil, nil)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Fatalf("wrapped key differs: %v", err)
+		}
+	}
+
+	_, err = ParsePublicKey("0x1234")
+	if err != ErrPublicKey {
+		t.Fatalf("parsed a bad key: %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+// Package envelope encrypts the objects before they are stored. An object is
+// encrypted with its own data key, in chunks of ChunkSize bytes sealed by
+// AES-256-GCM. The nonce of a chunk is its index in big endian in the first
+// 8 bytes, the last byte is 1 for the last chunk, so chunks can neither be
+// reordered nor dropped. The data key is wrapped to the public key of the
+// owner, and sealed by the master key of the middleware which decrypts the
+// objects on read.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	ChunkSize = 64 << 10
+	KeySize   = 32
+	tagSize   = 16
+)
+
+var ErrCorrupted = errors.New("encrypted object is corrupted")
+
+// SealedSize is the size of size bytes once encrypted
+func SealedSize(size int64) int64 {
+	return size + chunks(size)*tagSize
+}
+
+// SealedRange is the part of the encrypted object of size bytes holding the
+// length bytes at offset, a zero length goes to the end
+func SealedRange(size, offset, length int64) (int64, int64) {
+	if length <= 0 || offset+length > size {
+		length = size - offset
+	}
+	first := offset / ChunkSize
+	last := first
+	if length > 0 {
+		last = (offset + length - 1) / ChunkSize
+	}
+
+	start := first * (ChunkSize + tagSize)
+	end := (last + 1) * (ChunkSize + tagSize)
+	if sealed := SealedSize(size); end > sealed {
+		end = sealed
+	}
+	return start, end - start
+}
+
+// chunks is the number of chunks of size bytes, an empty object has one
+func chunks(size int64) int64 {
+	if size == 0 {
+		return 1
+	}
+	return (size + ChunkSize - 1) / ChunkSize
+}
+
+func nonce(index int64, last bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n, uint64(index))
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Reader encrypts the content read from its source
+type Reader struct {
+	aead  cipher.AEAD
+	r     *bufio.Reader
+	plain []byte
+	// sealed is the part of the current chunk not read yet
+	sealed []byte
+	out    []byte
+	index  int64
+	size   int64
+	done   bool
+}
+
+// NewReader returns a reader of r encrypted with key
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		aead:  aead,
+		r:     bufio.NewReader(r),
+		plain: make([]byte, ChunkSize),
+		out:   make([]byte, 0, ChunkSize+tagSize),
+	}, nil
+}
+
+func (e *Reader) Read(p []byte) (int, error) {
+	for len(e.sealed) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		err := e.seal()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.sealed)
+	e.sealed = e.sealed[n:]
+	return n, nil
+}
+
+// seal encrypts the next chunk, a full chunk is the last one when nothing
+// follows it
+func (e *Reader) seal() error {
+	n, err := io.ReadFull(e.r, e.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	last := n < len(e.plain)
+	if !last {
+		_, err = e.r.Peek(1)
+		if err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	e.sealed = e.aead.Seal(e.out[:0], nonce(e.index, last), e.plain[:n], nil)
+	e.size += int64(n)
+	e.index++
+	e.done = last
+	return nil
+}
+
+// Size is the number of bytes encrypted so far
+func (e *Reader) Size() int64 {
+	return e.size
+}
+
+// Writer decrypts the chunks written to it, they start at the chunk holding
+// offset as given by SealedRange
+type Writer struct {
+	aead  cipher.AEAD
+	w     io.Writer
+	size  int64
+	index int64
+	// skip is the part of the first chunk before offset, remain the bytes
+	// still to be written
+	skip   int64
+	remain int64
+	buf    []byte
+}
+
+// NewWriter returns a writer decrypting with key into w the length bytes at
+// offset of an object of size bytes, a zero length goes to the end
+func NewWriter(w io.Writer, key []byte, size, offset, length int64) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 || offset+length > size {
+		length = size - offset
+	}
+	return &Writer{
+		aead:   aead,
+		w:      w,
+		size:   size,
+		index:  offset / ChunkSize,
+		skip:   offset % ChunkSize,
+		remain: length,
+	}, nil
+}
+
+// sealedChunk is the encrypted size of the chunk index
+func (d *Writer) sealedChunk() int64 {
+	if d.index < chunks(d.size)-1 {
+		return ChunkSize + tagSize
+	}
+	return d.size - d.index*ChunkSize + tagSize
+}
+
+func (d *Writer) Write(p []byte) (int, error) {
+	d.buf = append(d.buf, p...)
+	for d.remain > 0 {
+		need := d.sealedChunk()
+		if int64(len(d.buf)) < need {
+			break
+		}
+
+		last := d.index == chunks(d.size)-1
+		plain, err := d.aead.Open(d.buf[:0], nonce(d.index, last), d.buf[:need], nil)
+		if err != nil {
+			return 0, ErrCorrupted
+		}
+		plain = plain[d.skip:]
+		d.skip = 0
+		if int64(len(plain)) > d.remain {
+			plain = plain[:d.remain]
+		}
+		if len(plain) > 0 {
+			_, err = d.w.Write(plain)
+			if err != nil {
+				return 0, err
+			}
+		}
+		d.remain -= int64(len(plain))
+		d.buf = append(d.buf[:0], d.buf[need:]...)
+		d.index++
+	}
+	return len(p), nil
+}
+
+// Close reports an object cut before the bytes asked were decrypted
+func (d *Writer) Close() error {
+	if d.remain > 0 {
+		return ErrCorrupted
+	}
+	return nil
+}
@@ -3,17 +3,20 @@ package ipfs
 import (
 	"context"
 	"io"
-	"io/ioutil"
+	"strings"
 	"time"
 
 	shapi "github.com/ipfs/go-ipfs-api"
+	files "github.com/ipfs/go-ipfs-files"
 	"github.com/memoio/backend/api"
 	"github.com/memoio/backend/config"
 	"github.com/memoio/backend/internal/logs"
-	"github.com/memoio/backend/utils"
 )
 
+var logger = logs.Logger("ipfs")
+
 var _ api.IGateway = (*Ipfs)(nil)
+var _ api.IPinner = (*Ipfs)(nil)
 
 func ChunkerSize(size string) shapi.AddOpts {
 	return func(rb *shapi.RequestBuilder) error {
@@ -44,9 +47,20 @@ func (i *Ipfs) GetStoreType(ctx context.Context) api.StorageType {
 
 func (i *Ipfs) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts api.ObjectOptions) (objInfo api.ObjectInfo, err error) {
 	sh := shapi.NewShell(i.host)
-	cidvereion := shapi.CidVersion(1)
-	chunkersize := ChunkerSize("size-253952")
-	hash, err := sh.Add(r, cidvereion, chunkersize)
+
+	// the body is streamed to the node as a multipart file, the request is
+	// canceled with ctx
+	cr := &countReader{r: r}
+	slf := files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(cr))})
+	rb := sh.Request("add").Body(files.NewMultiFileReader(slf, true))
+	shapi.CidVersion(1)(rb)
+	ChunkerSize("size-253952")(rb)
+	shapi.Pin(true)(rb)
+
+	var out struct {
+		Hash string
+	}
+	err = rb.Exec(ctx, &out)
 	if err != nil {
 		return objInfo, err
 	}
@@ -54,8 +68,8 @@ func (i *Ipfs) PutObject(ctx context.Context, bucket, object string, r io.Reader
 	return api.ObjectInfo{
 		Bucket:      bucket,
 		Name:        object,
-		Size:        int64(opts.Size),
-		Cid:         hash,
+		Size:        cr.n,
+		Cid:         out.Hash,
 		ModTime:     time.Now(),
 		UserDefined: opts.UserDefined,
 		SType:       i.st,
@@ -64,30 +78,99 @@ func (i *Ipfs) PutObject(ctx context.Context, bucket, object string, r io.Reader
 
 func (i *Ipfs) GetObject(ctx context.Context, cid string, w io.Writer, opts api.ObjectOptions) error {
 	sh := shapi.NewShell(i.host)
-	r, err := sh.Cat(cid)
+	rb := sh.Request("cat", cid)
+	if opts.Offset > 0 {
+		rb.Option("offset", opts.Offset)
+	}
+	if opts.Length > 0 {
+		rb.Option("length", opts.Length)
+	}
+	resp, err := rb.Send(ctx)
 	if err != nil {
 		return err
 	}
-	data, _ := ioutil.ReadAll(r)
-	w.Write(data)
-	return nil
+	defer resp.Close()
+	if resp.Error != nil {
+		return resp.Error
+	}
+
+	_, err = io.Copy(w, resp.Output)
+	return err
 }
 
 func (i *Ipfs) GetObjectInfo(ctx context.Context, cid string) (api.ObjectInfo, error) {
 	result := api.ObjectInfo{}
 	sh := shapi.NewShell(i.host)
-	objects, err := sh.List(cid)
+	// ls lists the chunks of a file and nothing for a single block, the
+	// size is read from the file stat
+	stat, err := sh.FilesStat(ctx, "/ipfs/"+cid)
 	if err != nil {
-		return result, err
+		if strings.Contains(err.Error(), "not found") {
+			return result, logs.StorageError{Message: "object not exist"}
+		}
+		return result, logs.StorageError{Message: err.Error()}
 	}
-	ctype := utils.TypeByExtension(objects[0].Name)
 	return api.ObjectInfo{
-		Name:  objects[0].Name,
-		Size:  int64(objects[0].Size),
-		CType: ctype,
+		Cid:   cid,
+		Size:  int64(stat.Size),
+		SType: i.st,
 	}, nil
 }
 
-func (i *Ipfs) DeleteObject(ctx context.Context, address, mid string) error {
-	return logs.StorageError{Message: "ipfs not support delete option"}
+// DeleteObject cannot find the content of a name, ipfs objects are released
+// with Unpin once no file refers to their cid
+func (i *Ipfs) DeleteObject(ctx context.Context, bucket, object string) error {
+	return logs.StorageError{Message: "ipfs objects are deleted by unpinning their cid"}
+}
+
+func (i *Ipfs) Pin(ctx context.Context, cid string) error {
+	sh := shapi.NewShell(i.host)
+	err := sh.Request("pin/add", cid).Option("recursive", true).Exec(ctx, nil)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// Unpin lets the node garbage collect cid, a cid that is not pinned is not
+// an error
+func (i *Ipfs) Unpin(ctx context.Context, cid string) error {
+	sh := shapi.NewShell(i.host)
+	err := sh.Request("pin/rm", cid).Option("recursive", true).Exec(ctx, nil)
+	if err != nil && !strings.Contains(err.Error(), "not pinned") {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// Pins returns the cids pinned recursively on the node
+func (i *Ipfs) Pins(ctx context.Context) (map[string]bool, error) {
+	sh := shapi.NewShell(i.host)
+	pins, err := sh.PinsOfType(ctx, shapi.RecursivePin)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	result := make(map[string]bool, len(pins))
+	for cid := range pins {
+		result[cid] = true
+	}
+	return result, nil
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -0,0 +1,335 @@
+package local
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+	mh "github.com/multiformats/go-multihash"
+)
+
+var logger = logs.Logger("local")
+
+var _ api.IGateway = (*Local)(nil)
+
+// gateways are created per request, the lock guards the reference counts
+// of every store in the process
+var lk sync.Mutex
+
+// Local keeps objects on disk, addressed by the cid of their content:
+//
+//	objects/<cid>       content
+//	objects/<cid>.json  reference count
+//	names/<hash>.json   bucket and name of an object, its cid and metadata
+type Local struct {
+	st   api.StorageType
+	root string
+}
+
+// objectMeta is the sidecar of an object name
+type objectMeta struct {
+	Bucket      string
+	Name        string
+	Cid         string
+	Size        int64
+	ModTime     time.Time
+	UserDefined map[string]string
+}
+
+type contentRef struct {
+	Size int64
+	Refs int
+}
+
+func NewGateway() (api.IGateway, error) {
+	return NewGatewayWith(config.Cfg.Storage.Local)
+}
+
+func NewGatewayWith(lc config.LocalConfig) (api.IGateway, error) {
+	if lc.Path == "" {
+		lerr := logs.ConfigError{Message: "local storage path is empty"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	for _, dir := range []string{"objects", "names", "tmp"} {
+		err := os.MkdirAll(filepath.Join(lc.Path, dir), os.ModePerm)
+		if err != nil {
+			lerr := logs.StorageError{Message: err.Error()}
+			logger.Error(lerr)
+			return nil, lerr
+		}
+	}
+
+	return &Local{
+		st:   api.LOCAL,
+		root: lc.Path,
+	}, nil
+}
+
+func (l *Local) GetStoreType(ctx context.Context) api.StorageType {
+	return l.st
+}
+
+func (l *Local) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts api.ObjectOptions) (objInfo api.ObjectInfo, err error) {
+	tmp, err := os.CreateTemp(filepath.Join(l.root, "tmp"), "put-")
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return objInfo, lerr
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		return objInfo, logs.StorageError{Message: err.Error()}
+	}
+	err = tmp.Close()
+	if err != nil {
+		return objInfo, logs.StorageError{Message: err.Error()}
+	}
+
+	mhash, err := mh.Encode(h.Sum(nil), mh.SHA2_256)
+	if err != nil {
+		return objInfo, logs.StorageError{Message: err.Error()}
+	}
+	id := cid.NewCidV1(cid.Raw, mhash).String()
+
+	meta := objectMeta{
+		Bucket:      bucket,
+		Name:        object,
+		Cid:         id,
+		Size:        size,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+	}
+
+	lk.Lock()
+	defer lk.Unlock()
+
+	old, oerr := l.getMeta(bucket, object)
+	if oerr != nil || old.Cid != id {
+		// the content is kept once whatever the number of names pointing at it
+		ref, err := l.getRef(id)
+		if err != nil {
+			return objInfo, err
+		}
+		if ref.Refs == 0 {
+			err = os.Rename(tmp.Name(), l.objectPath(id))
+			if err != nil {
+				lerr := logs.StorageError{Message: err.Error()}
+				logger.Error(lerr)
+				return objInfo, lerr
+			}
+		}
+		ref.Size = size
+		ref.Refs++
+		err = writeJSON(l.refPath(id), ref)
+		if err != nil {
+			return objInfo, err
+		}
+
+		// an object put again under its name drops its old content
+		if oerr == nil {
+			err = l.unref(old.Cid)
+			if err != nil {
+				return objInfo, err
+			}
+		}
+	}
+
+	err = writeJSON(l.metaPath(bucket, object), meta)
+	if err != nil {
+		return objInfo, err
+	}
+
+	return api.ObjectInfo{
+		Bucket:      bucket,
+		Name:        object,
+		Size:        size,
+		Cid:         id,
+		ModTime:     meta.ModTime,
+		CType:       utils.TypeByExtension(path.Ext(object)),
+		UserDefined: opts.UserDefined,
+		SType:       l.st,
+	}, nil
+}
+
+func (l *Local) GetObject(ctx context.Context, id string, w io.Writer, opts api.ObjectOptions) error {
+	f, err := os.Open(l.objectPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return logs.StorageError{Message: "object not exist"}
+		}
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if opts.Offset > 0 {
+		_, err = f.Seek(opts.Offset, io.SeekStart)
+		if err != nil {
+			return logs.StorageError{Message: err.Error()}
+		}
+	}
+	if opts.Length > 0 {
+		r = io.LimitReader(f, opts.Length)
+	}
+
+	_, err = io.Copy(w, &ctxReader{ctx: ctx, r: r})
+	return err
+}
+
+func (l *Local) GetObjectInfo(ctx context.Context, id string) (api.ObjectInfo, error) {
+	lk.Lock()
+	ref, err := l.getRef(id)
+	lk.Unlock()
+	if err != nil {
+		return api.ObjectInfo{}, err
+	}
+	if ref.Refs == 0 {
+		return api.ObjectInfo{}, logs.StorageError{Message: "object not exist"}
+	}
+
+	return api.ObjectInfo{
+		Cid:   id,
+		Size:  ref.Size,
+		SType: l.st,
+	}, nil
+}
+
+func (l *Local) DeleteObject(ctx context.Context, bucket, object string) error {
+	lk.Lock()
+	defer lk.Unlock()
+
+	meta, err := l.getMeta(bucket, object)
+	if err != nil {
+		return err
+	}
+
+	err = l.unref(meta.Cid)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(l.metaPath(bucket, object))
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+func (l *Local) objectPath(id string) string {
+	return filepath.Join(l.root, "objects", id)
+}
+
+func (l *Local) refPath(id string) string {
+	return filepath.Join(l.root, "objects", id+".json")
+}
+
+func (l *Local) metaPath(bucket, object string) string {
+	h := sha256.Sum256([]byte(bucket + "/" + object))
+	return filepath.Join(l.root, "names", hex.EncodeToString(h[:])+".json")
+}
+
+func (l *Local) getMeta(bucket, object string) (objectMeta, error) {
+	var meta objectMeta
+	err := readJSON(l.metaPath(bucket, object), &meta)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, logs.StorageError{Message: "object not exist"}
+		}
+		return meta, logs.StorageError{Message: err.Error()}
+	}
+	return meta, nil
+}
+
+func (l *Local) getRef(id string) (contentRef, error) {
+	var ref contentRef
+	err := readJSON(l.refPath(id), &ref)
+	if err != nil && !os.IsNotExist(err) {
+		return ref, logs.StorageError{Message: err.Error()}
+	}
+	return ref, nil
+}
+
+// unref drops one reference to the content, the last one removes it
+func (l *Local) unref(id string) error {
+	ref, err := l.getRef(id)
+	if err != nil {
+		return err
+	}
+
+	ref.Refs--
+	if ref.Refs > 0 {
+		return writeJSON(l.refPath(id), ref)
+	}
+
+	for _, p := range []string{l.objectPath(id), l.refPath(id)} {
+		err = os.Remove(p)
+		if err != nil && !os.IsNotExist(err) {
+			lerr := logs.StorageError{Message: err.Error()}
+			logger.Error(lerr)
+			return lerr
+		}
+	}
+	return nil
+}
+
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON replaces the file at path atomically
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+	return nil
+}
+
+// ctxReader stops reading once ctx is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewGatewayWith(config.LocalConfig{Path: t.TempDir()})
+	assert.NoError(t, err)
+
+	content := "hello local storage"
+	oi, err := store.PutObject(ctx, "0xabc", "a.txt", strings.NewReader(content), api.ObjectOptions{UserDefined: map[string]string{"k": "v"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), oi.Size)
+	assert.True(t, strings.HasPrefix(oi.Cid, "bafkrei"))
+
+	// same content under another name shares the cid
+	oi2, err := store.PutObject(ctx, "0xabc", "b.txt", strings.NewReader(content), api.ObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, oi.Cid, oi2.Cid)
+
+	var w bytes.Buffer
+	err = store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, content, w.String())
+
+	w.Reset()
+	err = store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{Offset: 6, Length: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "local", w.String())
+
+	// the content stays until its last name is deleted
+	assert.NoError(t, store.DeleteObject(ctx, "0xabc", "a.txt"))
+	w.Reset()
+	assert.NoError(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}))
+
+	assert.NoError(t, store.DeleteObject(ctx, "0xabc", "b.txt"))
+	err = store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{})
+	assert.ErrorContains(t, err, "not exist")
+
+	err = store.DeleteObject(ctx, "0xabc", "b.txt")
+	assert.ErrorContains(t, err, "not exist")
+}
+
+func TestLocalReplace(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewGatewayWith(config.LocalConfig{Path: t.TempDir()})
+	assert.NoError(t, err)
+
+	oi, err := store.PutObject(ctx, "0xabc", "a.txt", strings.NewReader("v1"), api.ObjectOptions{})
+	assert.NoError(t, err)
+
+	// putting the same content again keeps it
+	_, err = store.PutObject(ctx, "0xabc", "a.txt", strings.NewReader("v1"), api.ObjectOptions{})
+	assert.NoError(t, err)
+	var w bytes.Buffer
+	assert.NoError(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}))
+
+	// new content drops the old one
+	oi2, err := store.PutObject(ctx, "0xabc", "a.txt", strings.NewReader("v2"), api.ObjectOptions{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, oi.Cid, oi2.Cid)
+	assert.ErrorContains(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}), "not exist")
+}
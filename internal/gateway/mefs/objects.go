@@ -199,8 +199,11 @@ func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Write
 	stepLen := int64(build.DefaultSegSize * 16)
 	stepAccMax := 16
 
-	start := int64(0)
+	start := opts.Offset
 	end := length
+	if opts.Length > 0 && start+opts.Length < end {
+		end = start + opts.Length
+	}
 	stepacc := 1
 	for start < end {
 		if stepacc > stepAccMax {
@@ -217,12 +220,21 @@ func (m *Mefs) GetObject(ctx context.Context, objectName string, writer io.Write
 			Length: readLen,
 		}
 
+		// segments are fetched one window at a time, a slow or gone reader
+		// stops the download here
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		data, err := napi.GetObject(ctx, "", objectName, doo)
 		if err != nil {
-			//log.Println("received length err is:", start, readLen, stepLen, err)
-			break
+			lerr := logs.StorageError{Message: err.Error()}
+			logger.Error(lerr)
+			return lerr
+		}
+		_, err = writer.Write(data)
+		if err != nil {
+			return err
 		}
-		writer.Write(data)
 		start += int64(readLen)
 		stepacc *= 2
 	}
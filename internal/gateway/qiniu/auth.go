@@ -0,0 +1,62 @@
+package qiniu
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// putPolicy is the part of the qiniu upload policy the gateway uses
+type putPolicy struct {
+	Scope    string `json:"scope"`
+	Deadline int64  `json:"deadline"`
+}
+
+func (q *Qiniu) sign(data []byte) string {
+	h := hmac.New(sha1.New, []byte(q.cfg.SecretKey))
+	h.Write(data)
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// uploadToken allows to put (or overwrite) key until expire
+func (q *Qiniu) uploadToken(key string, expire time.Duration) (string, error) {
+	policy, err := json.Marshal(putPolicy{
+		Scope:    q.cfg.Bucket + ":" + key,
+		Deadline: time.Now().Add(expire).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.URLEncoding.EncodeToString(policy)
+	return q.cfg.AccessKey + ":" + q.sign([]byte(encoded)) + ":" + encoded, nil
+}
+
+// managementToken signs a request without body to the rs api
+func (q *Qiniu) managementToken(r *http.Request) string {
+	data := r.URL.Path
+	if r.URL.RawQuery != "" {
+		data += "?" + r.URL.RawQuery
+	}
+	return "QBox " + q.cfg.AccessKey + ":" + q.sign([]byte(data+"\n"))
+}
+
+// privateURL signs a download url of a private bucket
+func (q *Qiniu) privateURL(u string, expire time.Duration) string {
+	sep := "?"
+	if strings.Contains(u, "?") {
+		sep = "&"
+	}
+	u += sep + "e=" + strconv.FormatInt(time.Now().Add(expire).Unix(), 10)
+	return u + "&token=" + q.cfg.AccessKey + ":" + q.sign([]byte(u))
+}
+
+// entry is the encoded "bucket:key" of the rs api
+func (q *Qiniu) entry(key string) string {
+	return base64.URLEncoding.EncodeToString([]byte(q.cfg.Bucket + ":" + key))
+}
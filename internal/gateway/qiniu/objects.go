@@ -0,0 +1,288 @@
+package qiniu
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+)
+
+var logger = logs.Logger("qiniu")
+
+var _ api.IGateway = (*Qiniu)(nil)
+
+const tokenExpire = time.Hour
+
+// Qiniu stores the objects of every address in one kodo bucket under the
+// key "<address>/<name>". The cid of an object is "<hash>.<encoded key>",
+// the qiniu etag of the content followed by what is needed to find it.
+type Qiniu struct {
+	st     api.StorageType
+	cfg    config.QiniuConfig
+	client *http.Client
+}
+
+type uploadResult struct {
+	Hash string `json:"hash"`
+	Key  string `json:"key"`
+}
+
+type errorResult struct {
+	Error string `json:"error"`
+}
+
+func NewGateway() (api.IGateway, error) {
+	return NewGatewayWith(config.Cfg.Storage.Qiniu)
+}
+
+func NewGatewayWith(qc config.QiniuConfig) (api.IGateway, error) {
+	if qc.AccessKey == "" || qc.SecretKey == "" || qc.Bucket == "" || qc.Domain == "" {
+		lerr := logs.ConfigError{Message: "qiniu accessKey, secretKey, bucket and domain should be set"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	return &Qiniu{
+		st:     api.QINIU,
+		cfg:    qc,
+		client: http.DefaultClient,
+	}, nil
+}
+
+func (q *Qiniu) GetStoreType(ctx context.Context) api.StorageType {
+	return q.st
+}
+
+func (q *Qiniu) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts api.ObjectOptions) (objInfo api.ObjectInfo, err error) {
+	key := objectKey(bucket, object)
+	token, err := q.uploadToken(key, tokenExpire)
+	if err != nil {
+		return objInfo, logs.StorageError{Message: err.Error()}
+	}
+
+	// the form is written while it is sent
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadForm(mw, token, key, object, r, opts.UserDefined))
+	}()
+	defer pr.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.cfg.UpHost, pr)
+	if err != nil {
+		return objInfo, logs.StorageError{Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var res uploadResult
+	err = q.do(req, &res)
+	if err != nil {
+		return objInfo, err
+	}
+
+	oi, err := q.stat(ctx, key)
+	if err != nil {
+		return objInfo, err
+	}
+
+	return api.ObjectInfo{
+		Bucket:      bucket,
+		Name:        object,
+		Size:        oi.Size,
+		Cid:         toCid(res.Hash, key),
+		ModTime:     time.Now(),
+		CType:       oi.CType,
+		UserDefined: opts.UserDefined,
+		SType:       q.st,
+	}, nil
+}
+
+func writeUploadForm(mw *multipart.Writer, token, key, object string, r io.Reader, ud map[string]string) error {
+	err := mw.WriteField("token", token)
+	if err != nil {
+		return err
+	}
+	err = mw.WriteField("key", key)
+	if err != nil {
+		return err
+	}
+	for k, v := range ud {
+		err = mw.WriteField("x-qn-meta-"+k, v)
+		if err != nil {
+			return err
+		}
+	}
+
+	fw, err := mw.CreateFormFile("file", object)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	if err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+func (q *Qiniu) GetObject(ctx context.Context, cid string, w io.Writer, opts api.ObjectOptions) error {
+	key, err := keyOf(cid)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, q.DownloadURL(key), nil)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+	if opts.Offset > 0 || opts.Length > 0 {
+		rng := fmt.Sprintf("bytes=%d-", opts.Offset)
+		if opts.Length > 0 {
+			rng += strconv.FormatInt(opts.Offset+opts.Length-1, 10)
+		}
+		req.Header.Set("Range", rng)
+	}
+
+	resp, err := q.client.Do(req)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound:
+		return logs.StorageError{Message: "object not exist"}
+	default:
+		return logs.StorageError{Message: "download failed: " + resp.Status}
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (q *Qiniu) GetObjectInfo(ctx context.Context, cid string) (api.ObjectInfo, error) {
+	key, err := keyOf(cid)
+	if err != nil {
+		return api.ObjectInfo{}, err
+	}
+	return q.stat(ctx, key)
+}
+
+func (q *Qiniu) DeleteObject(ctx context.Context, bucket, object string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.cfg.RsHost+"/delete/"+q.entry(objectKey(bucket, object)), nil)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", q.managementToken(req))
+
+	return q.do(req, nil)
+}
+
+// DownloadURL returns the url of key, signed when the bucket is private
+func (q *Qiniu) DownloadURL(key string) string {
+	u := strings.TrimSuffix(q.cfg.Domain, "/") + "/" + (&url.URL{Path: key}).EscapedPath()
+	if q.cfg.Private {
+		return q.privateURL(u, tokenExpire)
+	}
+	return u
+}
+
+func (q *Qiniu) stat(ctx context.Context, key string) (api.ObjectInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, q.cfg.RsHost+"/stat/"+q.entry(key), nil)
+	if err != nil {
+		return api.ObjectInfo{}, logs.StorageError{Message: err.Error()}
+	}
+	req.Header.Set("Authorization", q.managementToken(req))
+
+	var res struct {
+		Fsize    int64  `json:"fsize"`
+		Hash     string `json:"hash"`
+		MimeType string `json:"mimeType"`
+		PutTime  int64  `json:"putTime"`
+	}
+	err = q.do(req, &res)
+	if err != nil {
+		return api.ObjectInfo{}, err
+	}
+
+	ctype := res.MimeType
+	if ctype == "" {
+		ctype = utils.TypeByExtension(path.Ext(key))
+	}
+	return api.ObjectInfo{
+		Name: key,
+		Size: res.Fsize,
+		Cid:  toCid(res.Hash, key),
+		// putTime is in units of 100ns
+		ModTime: time.Unix(0, res.PutTime*100),
+		CType:   ctype,
+		SType:   q.st,
+	}, nil
+}
+
+// do sends req and decodes a json answer into v
+func (q *Qiniu) do(req *http.Request, v interface{}) error {
+	resp, err := q.client.Do(req)
+	if err != nil {
+		lerr := logs.StorageError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var res errorResult
+		json.NewDecoder(resp.Body).Decode(&res)
+		if resp.StatusCode == 612 || resp.StatusCode == http.StatusNotFound {
+			return logs.StorageError{Message: "object not exist"}
+		}
+		lerr := logs.StorageError{Message: fmt.Sprintf("qiniu %d: %s", resp.StatusCode, res.Error)}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	if v == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return logs.StorageError{Message: err.Error()}
+	}
+	return nil
+}
+
+func objectKey(bucket, object string) string {
+	return bucket + "/" + object
+}
+
+func toCid(hash, key string) string {
+	return hash + "." + base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func keyOf(cid string) (string, error) {
+	i := strings.LastIndex(cid, ".")
+	if i < 0 {
+		return "", logs.StorageError{Message: "invalid qiniu cid " + cid}
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cid[i+1:])
+	if err != nil {
+		return "", logs.StorageError{Message: "invalid qiniu cid " + cid}
+	}
+	return string(key), nil
+}
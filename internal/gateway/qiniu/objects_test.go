@@ -0,0 +1,134 @@
+package qiniu
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// kodo is a minimal stand-in for the qiniu upload, rs and download hosts
+type kodo struct {
+	t       *testing.T
+	q       *Qiniu
+	lk      sync.Mutex
+	objects map[string][]byte
+}
+
+func (k *kodo) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.lk.Lock()
+	defer k.lk.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/":
+		token := r.FormValue("token")
+		parts := strings.Split(token, ":")
+		if len(parts) != 3 || parts[1] != k.q.sign([]byte(parts[2])) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		f, _, err := r.FormFile("file")
+		assert.NoError(k.t, err)
+		data, _ := io.ReadAll(f)
+		key := r.FormValue("key")
+		k.objects[key] = data
+		json.NewEncoder(w).Encode(uploadResult{Hash: hash(data), Key: key})
+
+	case strings.HasPrefix(r.URL.Path, "/stat/"), strings.HasPrefix(r.URL.Path, "/delete/"):
+		if r.Header.Get("Authorization") != k.q.managementToken(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		i := strings.LastIndex(r.URL.Path, "/")
+		entry, _ := base64.URLEncoding.DecodeString(r.URL.Path[i+1:])
+		key := strings.TrimPrefix(string(entry), k.q.cfg.Bucket+":")
+		data, ok := k.objects[key]
+		if !ok {
+			w.WriteHeader(612)
+			json.NewEncoder(w).Encode(errorResult{Error: "no such file or directory"})
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/delete/") {
+			delete(k.objects, key)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"fsize":   len(data),
+			"hash":    hash(data),
+			"putTime": time.Now().UnixNano() / 100,
+		})
+
+	case r.Method == http.MethodGet:
+		if r.URL.Query().Get("token") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, ok := k.objects[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func hash(data []byte) string {
+	h := sha1.Sum(data)
+	return base64.URLEncoding.EncodeToString(h[:])
+}
+
+func TestQiniu(t *testing.T) {
+	k := &kodo{t: t, objects: make(map[string][]byte)}
+	srv := httptest.NewServer(k)
+	defer srv.Close()
+
+	store, err := NewGatewayWith(config.QiniuConfig{
+		AccessKey: "ak",
+		SecretKey: "sk",
+		Bucket:    "memo",
+		UpHost:    srv.URL,
+		RsHost:    srv.URL,
+		Domain:    srv.URL,
+		Private:   true,
+	})
+	assert.NoError(t, err)
+	k.q = store.(*Qiniu)
+
+	ctx := context.Background()
+	content := "hello qiniu storage"
+	oi, err := store.PutObject(ctx, "0xabc", "dir/a.txt", strings.NewReader(content), api.ObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), oi.Size)
+	assert.Contains(t, k.objects, "0xabc/dir/a.txt")
+
+	var w bytes.Buffer
+	assert.NoError(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}))
+	assert.Equal(t, content, w.String())
+
+	w.Reset()
+	assert.NoError(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{Offset: 6, Length: 5}))
+	assert.Equal(t, "qiniu", w.String())
+
+	info, err := k.q.GetObjectInfo(ctx, oi.Cid)
+	assert.NoError(t, err)
+	assert.Equal(t, oi.Size, info.Size)
+
+	assert.NoError(t, store.DeleteObject(ctx, "0xabc", "dir/a.txt"))
+	assert.ErrorContains(t, store.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}), "not exist")
+	assert.ErrorContains(t, store.DeleteObject(ctx, "0xabc", "dir/a.txt"), "not exist")
+}
@@ -0,0 +1,245 @@
+package replica
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+var logger = logs.Logger("replica")
+
+var _ api.IGateway = (*Replica)(nil)
+var _ api.IWrapper = (*Replica)(nil)
+
+// Backend is a gateway holding replicas, Name tells it apart from the other
+// backends of the same storage (e.g. "mefs:area")
+type Backend struct {
+	Name string
+	Area string
+	G    api.IGateway
+}
+
+// Lookup returns the replicas recorded for the content mid of storage st
+type Lookup func(ctx context.Context, st api.StorageType, mid string) ([]api.ObjectReplica, error)
+
+// Replica copies every object put to the primary backend to the others. It
+// reports the storage type of the primary so files keep being listed there,
+// the copies made are returned in ObjectInfo.Replicas.
+type Replica struct {
+	primary Backend
+	others  []Backend
+	lookup  Lookup
+}
+
+func NewGateway(primary Backend, others []Backend, lookup Lookup) *Replica {
+	return &Replica{
+		primary: primary,
+		others:  others,
+		lookup:  lookup,
+	}
+}
+
+// WithPrimary returns the same policy with g as primary backend, it is used
+// when an upload goes to another mefs area
+func (r *Replica) WithPrimary(g api.IGateway, area string) *Replica {
+	primary := r.primary
+	primary.G = g
+	primary.Area = area
+	return NewGateway(primary, r.others, r.lookup)
+}
+
+// Backends returns the primary backend followed by the others
+func (r *Replica) Backends() []Backend {
+	return append([]Backend{r.primary}, r.others...)
+}
+
+// Unwrap returns the primary gateway, a pinning primary pins the content
+// of the replicated objects
+func (r *Replica) Unwrap() api.IGateway {
+	return r.primary.G
+}
+
+func (r *Replica) GetStoreType(ctx context.Context) api.StorageType {
+	return r.primary.G.GetStoreType(ctx)
+}
+
+// branch is the upload of the object to one backend
+type branch struct {
+	b    Backend
+	pw   *io.PipeWriter
+	dead bool
+	oi   api.ObjectInfo
+	err  error
+}
+
+func (r *Replica) PutObject(ctx context.Context, bucket, object string, rd io.Reader, opts api.ObjectOptions) (objInfo api.ObjectInfo, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// the object is read once and streamed to every backend
+	var wg sync.WaitGroup
+	branches := make([]*branch, 0, len(r.others)+1)
+	for _, b := range r.Backends() {
+		pr, pw := io.Pipe()
+		br := &branch{b: b, pw: pw}
+		branches = append(branches, br)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			br.oi, br.err = br.b.G.PutObject(ctx, bucket, object, pr, opts)
+			if br.err != nil {
+				pr.CloseWithError(br.err)
+			} else {
+				pr.Close()
+			}
+		}()
+	}
+
+	_, err = io.Copy(&fanout{branches: branches}, rd)
+	for _, br := range branches {
+		br.pw.CloseWithError(err)
+	}
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+
+	primary := branches[0]
+	if err == nil {
+		err = primary.err
+	}
+	if err != nil {
+		// nothing is kept if the primary failed
+		for _, br := range branches[1:] {
+			if br.err == nil {
+				br.b.G.DeleteObject(context.Background(), bucket, object)
+			}
+		}
+		return objInfo, err
+	}
+
+	objInfo = primary.oi
+	for i, br := range branches {
+		replica := api.ObjectReplica{
+			Backend: br.b.Name,
+			SType:   br.b.G.GetStoreType(ctx),
+			Area:    br.b.Area,
+			Mid:     br.oi.Cid,
+			Primary: i == 0,
+			Status:  api.ReplicaOK,
+			ModTime: time.Now(),
+		}
+		if br.err != nil {
+			logger.Errorf("replicate %s/%s to %s: %s", bucket, object, br.b.Name, br.err)
+			replica.Status = api.ReplicaFailed
+			replica.Message = br.err.Error()
+		}
+		objInfo.Replicas = append(objInfo.Replicas, replica)
+	}
+
+	return objInfo, nil
+}
+
+// fanout writes to every branch still alive, a failed replica does not stop
+// the upload but the primary does
+type fanout struct {
+	branches []*branch
+}
+
+func (f *fanout) Write(p []byte) (int, error) {
+	for i, br := range f.branches {
+		if br.dead {
+			continue
+		}
+		_, err := br.pw.Write(p)
+		if err != nil {
+			if i == 0 {
+				return 0, err
+			}
+			br.dead = true
+		}
+	}
+	return len(p), nil
+}
+
+// GetObject reads from the first healthy replica, the next one is only
+// tried while nothing has been written
+func (r *Replica) GetObject(ctx context.Context, mid string, w io.Writer, opts api.ObjectOptions) error {
+	st := r.GetStoreType(ctx)
+	replicas, err := r.lookup(ctx, st, mid)
+	if err != nil {
+		return err
+	}
+	if len(replicas) == 0 {
+		return r.primary.G.GetObject(ctx, mid, w, opts)
+	}
+
+	cw := &countWriter{w: w}
+	err = logs.StorageError{Message: "object not exist"}
+	for _, replica := range replicas {
+		if replica.Status != api.ReplicaOK {
+			continue
+		}
+		g := r.backend(replica)
+		if g == nil {
+			continue
+		}
+
+		err = g.GetObject(ctx, replica.Mid, cw, opts)
+		if err == nil || cw.n > 0 || ctx.Err() != nil {
+			return err
+		}
+		logger.Errorf("read %s from %s: %s", mid, replica.Backend, err)
+	}
+	return err
+}
+
+// backend returns the gateway holding replica, nil if it is no longer
+// configured
+func (r *Replica) backend(replica api.ObjectReplica) api.IGateway {
+	if replica.Primary {
+		return r.primary.G
+	}
+	for _, b := range r.others {
+		if b.Name == replica.Backend {
+			return b.G
+		}
+	}
+	return nil
+}
+
+// DeleteObject deletes the object from every backend, only the primary
+// decides of the result. Pinned content may be shared with other files and
+// is left on its backends.
+func (r *Replica) DeleteObject(ctx context.Context, bucket, object string) error {
+	for _, b := range r.others {
+		if _, ok := b.G.(api.IPinner); ok {
+			continue
+		}
+		err := b.G.DeleteObject(ctx, bucket, object)
+		if err != nil && !strings.Contains(err.Error(), "not exist") {
+			logger.Errorf("delete %s/%s from %s: %s", bucket, object, b.Name, err)
+		}
+	}
+	if _, ok := r.primary.G.(api.IPinner); ok {
+		return nil
+	}
+	return r.primary.G.DeleteObject(ctx, bucket, object)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,119 @@
+package replica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/gateway/local"
+	"github.com/stretchr/testify/assert"
+)
+
+// broken is a backend that is down
+type broken struct{}
+
+func (broken) GetStoreType(context.Context) api.StorageType { return api.IPFS }
+
+func (broken) PutObject(ctx context.Context, bucket, object string, r io.Reader, opts api.ObjectOptions) (api.ObjectInfo, error) {
+	return api.ObjectInfo{}, errors.New("backend down")
+}
+
+func (broken) GetObject(ctx context.Context, mid string, w io.Writer, opts api.ObjectOptions) error {
+	return errors.New("backend down")
+}
+
+func (broken) DeleteObject(ctx context.Context, bucket, object string) error {
+	return errors.New("backend down")
+}
+
+func newLocal(t *testing.T) api.IGateway {
+	g, err := local.NewGatewayWith(config.LocalConfig{Path: t.TempDir()})
+	assert.NoError(t, err)
+	return g
+}
+
+func TestReplica(t *testing.T) {
+	ctx := context.Background()
+	primary, second := newLocal(t), newLocal(t)
+
+	var recorded []api.ObjectReplica
+	lookup := func(ctx context.Context, st api.StorageType, mid string) ([]api.ObjectReplica, error) {
+		return recorded, nil
+	}
+	rs := NewGateway(Backend{Name: "local", G: primary}, []Backend{
+		{Name: "local:2", G: second},
+		{Name: "ipfs", G: broken{}},
+	}, lookup)
+
+	content := strings.Repeat("replicated ", 10000)
+	oi, err := rs.PutObject(ctx, "0xabc", "a.txt", strings.NewReader(content), api.ObjectOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), oi.Size)
+	assert.Len(t, oi.Replicas, 3)
+	assert.True(t, oi.Replicas[0].Primary)
+	assert.Equal(t, api.ReplicaOK, oi.Replicas[1].Status)
+	assert.Equal(t, api.ReplicaFailed, oi.Replicas[2].Status)
+
+	// both copies hold the content
+	for _, g := range []api.IGateway{primary, second} {
+		var w bytes.Buffer
+		assert.NoError(t, g.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}))
+		assert.Equal(t, content, w.String())
+	}
+
+	// a lost primary is read from the other replica
+	recorded = oi.Replicas
+	assert.NoError(t, primary.DeleteObject(ctx, "0xabc", "a.txt"))
+	var w bytes.Buffer
+	assert.NoError(t, rs.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{Offset: 0, Length: 10}))
+	assert.Equal(t, "replicated", w.String())
+
+	// the primary is already gone, the other copies are deleted anyway
+	assert.ErrorContains(t, rs.DeleteObject(ctx, "0xabc", "a.txt"), "not exist")
+	assert.ErrorContains(t, second.GetObject(ctx, oi.Cid, &w, api.ObjectOptions{}), "not exist")
+}
+
+func TestReplicaPrimaryFails(t *testing.T) {
+	ctx := context.Background()
+	second := newLocal(t)
+	rs := NewGateway(Backend{Name: "ipfs", G: broken{}}, []Backend{{Name: "local", G: second}}, nil)
+
+	_, err := rs.PutObject(ctx, "0xabc", "a.txt", strings.NewReader("content"), api.ObjectOptions{})
+	assert.Error(t, err)
+
+	// the replica made is dropped
+	assert.ErrorContains(t, second.DeleteObject(ctx, "0xabc", "a.txt"), "not exist")
+}
+
+// pinned is a pinning backend recording the cids unpinned
+type pinned struct {
+	broken
+	unpinned []string
+}
+
+func (p *pinned) Pin(ctx context.Context, cid string) error { return nil }
+
+func (p *pinned) Unpin(ctx context.Context, cid string) error {
+	p.unpinned = append(p.unpinned, cid)
+	return nil
+}
+
+func (p *pinned) Pins(ctx context.Context) (map[string]bool, error) { return nil, nil }
+
+func TestReplicaPinner(t *testing.T) {
+	primary := &pinned{}
+	rs := NewGateway(Backend{Name: "ipfs", G: primary}, []Backend{{Name: "local", G: newLocal(t)}}, nil)
+	p, ok := api.Pinner(rs)
+	assert.True(t, ok)
+	assert.NoError(t, p.Unpin(context.Background(), "cid"))
+	assert.Equal(t, []string{"cid"}, primary.unpinned)
+
+	rs = NewGateway(Backend{Name: "local", G: newLocal(t)}, []Backend{{Name: "ipfs", G: primary}}, nil)
+	_, ok = api.Pinner(rs)
+	assert.False(t, ok)
+}
@@ -0,0 +1,135 @@
+package pinning
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// status of a pin in the pinning service api
+const (
+	StatusQueued  = "queued"
+	StatusPinning = "pinning"
+	StatusPinned  = "pinned"
+	StatusFailed  = "failed"
+)
+
+// ErrNotFound is returned for a request id the service does not know
+var ErrNotFound = logs.GatewayError{Message: "pin request not found"}
+
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    string            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+type failure struct {
+	Error struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	} `json:"error"`
+}
+
+// Client talks to a remote service implementing the pinning service api
+type Client struct {
+	name     string
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func NewClient(pc config.PinnerConfig) *Client {
+	return &Client{
+		name:     pc.Name,
+		endpoint: strings.TrimSuffix(pc.Endpoint, "/"),
+		token:    pc.Token,
+		client:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Add asks the service to pin cid
+func (c *Client) Add(ctx context.Context, pin Pin) (PinStatus, error) {
+	var ps PinStatus
+	err := c.do(ctx, http.MethodPost, "/pins", pin, &ps)
+	return ps, err
+}
+
+// Get returns the status of the request id
+func (c *Client) Get(ctx context.Context, id string) (PinStatus, error) {
+	var ps PinStatus
+	err := c.do(ctx, http.MethodGet, "/pins/"+id, nil, &ps)
+	return ps, err
+}
+
+// Remove cancels the request id, the service unpins its cid
+func (c *Client) Remove(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/pins/"+id, nil, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		err := json.NewEncoder(&body).Encode(in)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint+path, &body)
+	if err != nil {
+		return logs.GatewayError{Message: err.Error()}
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return logs.GatewayError{Message: err.Error()}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var f failure
+		json.NewDecoder(resp.Body).Decode(&f)
+		msg := f.Error.Reason
+		if f.Error.Details != "" {
+			msg += ": " + f.Error.Details
+		}
+		return logs.GatewayError{Message: fmt.Sprintf("pinner %s: %s %s", c.name, resp.Status, msg)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return logs.GatewayError{Message: err.Error()}
+	}
+	return nil
+}
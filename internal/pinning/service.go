@@ -0,0 +1,249 @@
+package pinning
+
+import (
+	"context"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/logs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var logger = logs.Logger("pinning")
+
+const (
+	// pollInterval is how often a pin in progress is checked
+	pollInterval = 30 * time.Second
+	// retryDelay doubles after every failed attempt
+	retryDelay = 30 * time.Second
+	batchSize  = 100
+)
+
+// Service pins cids on the remote pinning services in the background, the
+// requests and their status are kept in the remotepin table
+type Service struct {
+	db      *gorm.DB
+	clients map[string]*Client
+	retries int
+	wake    chan struct{}
+
+	pollInterval time.Duration
+	retryDelay   time.Duration
+}
+
+func NewService(db *gorm.DB, ic config.IpfsConfig) *Service {
+	clients := make(map[string]*Client, len(ic.Pinners))
+	for _, pc := range ic.Pinners {
+		clients[pc.Name] = NewClient(pc)
+	}
+
+	retries := ic.PinRetries
+	if retries < 1 {
+		retries = 1
+	}
+
+	return &Service{
+		db:           db,
+		clients:      clients,
+		retries:      retries,
+		wake:         make(chan struct{}, 1),
+		pollInterval: pollInterval,
+		retryDelay:   retryDelay,
+	}
+}
+
+// Enabled is false when no remote pinner is configured
+func (s *Service) Enabled() bool {
+	return len(s.clients) > 0
+}
+
+// Enqueue records a pin of cid on every pinner, the requests are sent by
+// the running service. A cid already pinned is left as is.
+func (s *Service) Enqueue(ctx context.Context, cid, name string) error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	pins := make([]api.RemotePin, 0, len(s.clients))
+	for pinner := range s.clients {
+		pins = append(pins, api.RemotePin{
+			Pinner:  pinner,
+			Cid:     cid,
+			Name:    name,
+			Status:  StatusQueued,
+			NextTry: now,
+			Created: now,
+			Updated: now,
+		})
+	}
+
+	err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&pins).Error
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	s.notify()
+	return nil
+}
+
+// Remove unpins cid from the remote pinners and forgets its requests
+func (s *Service) Remove(ctx context.Context, cid string) error {
+	var pins []api.RemotePin
+	err := s.db.Where("cid = ?", cid).Find(&pins).Error
+	if err != nil {
+		return logs.DataBaseError{Message: err.Error()}
+	}
+
+	for _, pin := range pins {
+		c, ok := s.clients[pin.Pinner]
+		if !ok || pin.RequestID == "" {
+			continue
+		}
+		err := c.Remove(ctx, pin.RequestID)
+		if err != nil && err != ErrNotFound {
+			logger.Errorf("remove pin %s from %s: %s", cid, pin.Pinner, err)
+		}
+	}
+
+	err = s.db.Delete(&api.RemotePin{}, "cid = ?", cid).Error
+	if err != nil {
+		return logs.DataBaseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// Status returns the remote pins of the cids
+func (s *Service) Status(ctx context.Context, cids []string) (map[string][]api.RemotePin, error) {
+	result := make(map[string][]api.RemotePin)
+	if len(cids) == 0 {
+		return result, nil
+	}
+
+	var pins []api.RemotePin
+	err := s.db.Where("cid in ?", cids).Order("cid, pinner").Find(&pins).Error
+	if err != nil {
+		return nil, logs.DataBaseError{Message: err.Error()}
+	}
+	for _, pin := range pins {
+		result[pin.Cid] = append(result[pin.Cid], pin)
+	}
+	return result, nil
+}
+
+// Start sends the pending requests and follows them until ctx is done
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			s.Process(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Process handles once every pin due, it returns the number handled
+func (s *Service) Process(ctx context.Context) int {
+	var pins []api.RemotePin
+	err := s.db.Where("status in ? and nexttry <= ?", []string{StatusQueued, StatusPinning}, time.Now()).
+		Order("nexttry").Limit(batchSize).Find(&pins).Error
+	if err != nil {
+		logger.Error(logs.DataBaseError{Message: err.Error()})
+		return 0
+	}
+
+	for _, pin := range pins {
+		if ctx.Err() != nil {
+			break
+		}
+		s.process(ctx, pin)
+	}
+	return len(pins)
+}
+
+func (s *Service) process(ctx context.Context, pin api.RemotePin) {
+	c, ok := s.clients[pin.Pinner]
+	if !ok {
+		pin.Status = StatusFailed
+		pin.Error = "pinner is not configured"
+		s.save(pin)
+		return
+	}
+
+	var ps PinStatus
+	var err error
+	if pin.RequestID == "" {
+		ps, err = c.Add(ctx, Pin{Cid: pin.Cid, Name: pin.Name})
+	} else {
+		ps, err = c.Get(ctx, pin.RequestID)
+		if err == ErrNotFound {
+			// the service lost the request, it is sent again
+			pin.RequestID = ""
+			pin.Status = StatusQueued
+			pin.NextTry = time.Now()
+			s.save(pin)
+			return
+		}
+	}
+	if err != nil {
+		s.retry(pin, err.Error())
+		return
+	}
+
+	pin.RequestID = ps.RequestID
+	pin.Status = ps.Status
+	pin.Error = ""
+	switch ps.Status {
+	case StatusPinned:
+	case StatusFailed:
+		// the service gave up, a new request is made
+		pin.RequestID = ""
+		s.retry(pin, "pinning failed on "+pin.Pinner)
+		return
+	default:
+		pin.NextTry = time.Now().Add(s.pollInterval)
+	}
+	s.save(pin)
+}
+
+// retry schedules pin again later, it fails for good after the retries
+func (s *Service) retry(pin api.RemotePin, msg string) {
+	pin.Attempts++
+	pin.Error = msg
+	if pin.Attempts >= s.retries {
+		pin.Status = StatusFailed
+		logger.Errorf("pin %s on %s failed: %s", pin.Cid, pin.Pinner, msg)
+	} else {
+		if pin.RequestID == "" {
+			pin.Status = StatusQueued
+		}
+		pin.NextTry = time.Now().Add(s.retryDelay << (pin.Attempts - 1))
+	}
+	s.save(pin)
+}
+
+func (s *Service) save(pin api.RemotePin) {
+	pin.Updated = time.Now()
+	err := s.db.Save(&pin).Error
+	if err != nil {
+		logger.Error(logs.DataBaseError{Message: err.Error()})
+	}
+}
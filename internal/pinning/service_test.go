@@ -0,0 +1,151 @@
+package pinning
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// mockPinner is a pinning service pinning every cid on its second status
+// request, it answers 500 to the first fails requests
+type mockPinner struct {
+	lk      sync.Mutex
+	fails   int
+	pins    map[string]*PinStatus
+	polls   map[string]int
+	removed []string
+}
+
+func newMockPinner(fails int) *mockPinner {
+	return &mockPinner{
+		fails: fails,
+		pins:  make(map[string]*PinStatus),
+		polls: make(map[string]int),
+	}
+}
+
+func (m *mockPinner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if m.fails > 0 {
+		m.fails--
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"reason": "INTERNAL"}})
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/pins/")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/pins":
+		var pin Pin
+		json.NewDecoder(r.Body).Decode(&pin)
+		ps := &PinStatus{RequestID: strconv.Itoa(len(m.pins) + 1), Status: StatusQueued, Created: time.Now(), Pin: pin}
+		m.pins[ps.RequestID] = ps
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(ps)
+	case r.Method == http.MethodGet:
+		ps, ok := m.pins[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m.polls[id]++
+		if m.polls[id] > 1 {
+			ps.Status = StatusPinned
+		} else {
+			ps.Status = StatusPinning
+		}
+		json.NewEncoder(w).Encode(ps)
+	case r.Method == http.MethodDelete:
+		delete(m.pins, id)
+		m.removed = append(m.removed, id)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newTestService(t *testing.T, pinners map[string]*mockPinner) *Service {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&api.RemotePin{}))
+
+	ic := config.IpfsConfig{PinRetries: 3}
+	for name, m := range pinners {
+		srv := httptest.NewServer(m)
+		t.Cleanup(srv.Close)
+		ic.Pinners = append(ic.Pinners, config.PinnerConfig{Name: name, Endpoint: srv.URL, Token: "secret"})
+	}
+
+	s := NewService(db, ic)
+	// every pin is due at once
+	s.pollInterval = 0
+	s.retryDelay = 0
+	return s
+}
+
+func TestRemotePinning(t *testing.T) {
+	ctx := context.Background()
+	a, b := newMockPinner(0), newMockPinner(1)
+	s := newTestService(t, map[string]*mockPinner{"a": a, "b": b})
+
+	cid := "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	assert.NoError(t, s.Enqueue(ctx, cid, "a.txt"))
+	// enqueued twice, pinned once
+	assert.NoError(t, s.Enqueue(ctx, cid, "a.txt"))
+
+	for i := 0; i < 5; i++ {
+		s.Process(ctx)
+	}
+
+	status, err := s.Status(ctx, []string{cid})
+	assert.NoError(t, err)
+	assert.Len(t, status[cid], 2)
+	for _, pin := range status[cid] {
+		assert.Equal(t, StatusPinned, pin.Status, pin.Pinner)
+	}
+	// the failed request of b was retried
+	assert.Equal(t, 1, status[cid][1].Attempts)
+
+	assert.NoError(t, s.Remove(ctx, cid))
+	assert.Len(t, a.removed, 1)
+	assert.Len(t, b.removed, 1)
+	status, err = s.Status(ctx, []string{cid})
+	assert.NoError(t, err)
+	assert.Empty(t, status[cid])
+}
+
+func TestRemotePinningGivesUp(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t, map[string]*mockPinner{"down": newMockPinner(100)})
+
+	cid := "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	assert.NoError(t, s.Enqueue(ctx, cid, "a.txt"))
+	for i := 0; i < 5; i++ {
+		s.Process(ctx)
+	}
+
+	status, err := s.Status(ctx, []string{cid})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusFailed, status[cid][0].Status)
+	assert.Equal(t, 3, status[cid][0].Attempts)
+	assert.Contains(t, status[cid][0].Error, "INTERNAL")
+}
@@ -0,0 +1,69 @@
+package repair
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// LoadRepairModule registers the admin api of the repair worker w, g should
+// only be reachable by admins
+func LoadRepairModule(g *gin.RouterGroup, w *Worker) {
+	// 修复进度
+	g.GET("/repair", StatusHandler(w))
+
+	// 立即开始一轮修复
+	g.POST("/repair", TriggerHandler(w))
+
+	// 不健康的副本
+	g.GET("/repair/replicas", ListReplicasHandler())
+}
+
+func StatusHandler(w *Worker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, w.Status())
+	}
+}
+
+func TriggerHandler(w *Worker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !w.Trigger() {
+			errRes := logs.ToAPIErrorCode(logs.ControllerError{Message: "a repair round is already pending"})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		c.JSON(http.StatusAccepted, w.Status())
+	}
+}
+
+// ListReplicasHandler lists the replicas that are not healthy, the status
+// query selects one status and limit caps the result (100 by default)
+func ListReplicasHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 {
+			errRes := logs.ToAPIErrorCode(logs.ControllerError{Message: "invalid limit"})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		tx := database.GlobalDataBase.Where("status <> ?", api.ReplicaOK)
+		if status := c.Query("status"); status != "" {
+			tx = database.GlobalDataBase.Where("status = ?", status)
+		}
+
+		var replicas []api.ObjectReplica
+		err = tx.Order("fileid, id").Limit(limit).Find(&replicas).Error
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		c.JSON(http.StatusOK, replicas)
+	}
+}
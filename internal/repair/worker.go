@@ -0,0 +1,327 @@
+package repair
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/logs"
+)
+
+var logger = logs.Logger("repair")
+
+const (
+	// files are walked in batches of batchSize rows
+	batchSize = 100
+	// at most maxFailures failures of a round are kept
+	maxFailures = 100
+)
+
+// Resolver returns the gateway holding a replica
+type Resolver func(ctx context.Context, replica api.ObjectReplica) (api.IGateway, error)
+
+// Status is the progress of the current or the last round
+type Status struct {
+	Running  bool
+	Round    int
+	Started  time.Time
+	Finished time.Time
+	Files    int
+	Replicas int
+	Healthy  int
+	Repaired int
+	Failed   int
+	Failures []Failure
+}
+
+type Failure struct {
+	FileID  int
+	Name    string
+	Backend string
+	Message string
+	Time    time.Time
+}
+
+// Worker probes the replicas of every replicated file and copies an object
+// back from a healthy replica to the backends that lost it
+type Worker struct {
+	resolve  Resolver
+	interval time.Duration
+	db       *database.DataBase
+	trigger  chan struct{}
+	started  bool
+
+	// round is held while a round runs
+	round sync.Mutex
+
+	lk     sync.Mutex
+	status Status
+}
+
+func NewWorker(resolve Resolver, interval time.Duration) *Worker {
+	return &Worker{
+		resolve:  resolve,
+		interval: interval,
+		db:       database.NewDataBase(),
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Start runs a round every interval until ctx is done
+func (w *Worker) Start(ctx context.Context) {
+	w.lk.Lock()
+	w.started = true
+	w.lk.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-w.trigger:
+			}
+			w.RunOnce(ctx)
+		}
+	}()
+}
+
+// Trigger asks the worker to run a round now, it returns false if one is
+// already pending. A worker that is not started runs the round on its own.
+func (w *Worker) Trigger() bool {
+	w.lk.Lock()
+	started, running := w.started, w.status.Running
+	w.lk.Unlock()
+	if !started {
+		if running {
+			return false
+		}
+		go w.RunOnce(context.Background())
+		return true
+	}
+
+	select {
+	case w.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) Status() Status {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	status := w.status
+	status.Failures = append([]Failure(nil), w.status.Failures...)
+	return status
+}
+
+// RunOnce walks all the files once and returns the status of the round
+func (w *Worker) RunOnce(ctx context.Context) Status {
+	w.round.Lock()
+	defer w.round.Unlock()
+
+	w.update(func(s *Status) {
+		*s = Status{
+			Running: true,
+			Round:   s.Round + 1,
+			Started: time.Now(),
+		}
+	})
+	logger.Info("repair round started")
+
+	err := w.walk(ctx)
+	if err != nil {
+		w.fail(Failure{Message: err.Error(), Time: time.Now()})
+	}
+
+	w.update(func(s *Status) {
+		s.Running = false
+		s.Finished = time.Now()
+	})
+	status := w.Status()
+	logger.Infof("repair round done, %d replicas, %d healthy, %d repaired, %d failed", status.Replicas, status.Healthy, status.Repaired, status.Failed)
+	return status
+}
+
+func (w *Worker) walk(ctx context.Context) error {
+	lastID := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var files []api.FileInfo
+		err := w.db.Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&files).Error
+		if err != nil {
+			return logs.DataBaseError{Message: err.Error()}
+		}
+		if len(files) == 0 {
+			return nil
+		}
+		lastID = files[len(files)-1].ID
+
+		ids := make([]int, 0, len(files))
+		for _, fi := range files {
+			ids = append(ids, fi.ID)
+		}
+		replicas, err := w.db.ListObjectReplicas(ctx, ids)
+		if err != nil {
+			return err
+		}
+		byFile := make(map[int][]api.ObjectReplica)
+		for _, r := range replicas {
+			byFile[r.FileID] = append(byFile[r.FileID], r)
+		}
+
+		for _, fi := range files {
+			if len(byFile[fi.ID]) == 0 {
+				continue
+			}
+			w.checkFile(ctx, fi, byFile[fi.ID])
+		}
+	}
+}
+
+// checkFile probes the replicas of fi and repairs the missing ones
+func (w *Worker) checkFile(ctx context.Context, fi api.FileInfo, replicas []api.ObjectReplica) {
+	w.update(func(s *Status) {
+		s.Files++
+		s.Replicas += len(replicas)
+	})
+
+	gateways := make([]api.IGateway, len(replicas))
+	source := -1
+	for i := range replicas {
+		r := &replicas[i]
+		g, err := w.resolve(ctx, *r)
+		if err != nil {
+			w.record(fi, r, api.ReplicaFailed, err)
+			continue
+		}
+		gateways[i] = g
+
+		if r.Mid == "" {
+			// the upload to this backend never succeeded
+			r.Status = api.ReplicaMissing
+			continue
+		}
+
+		err = probe(ctx, g, r.Mid)
+		switch {
+		case err == nil:
+			w.record(fi, r, api.ReplicaOK, nil)
+			if source < 0 {
+				source = i
+			}
+		case isNotExist(err):
+			r.Status = api.ReplicaMissing
+			r.Message = err.Error()
+		default:
+			// the backend may only be unreachable, it is probed again
+			// next round before anything is copied
+			w.record(fi, r, api.ReplicaFailed, err)
+		}
+	}
+
+	for i := range replicas {
+		r := &replicas[i]
+		if r.Status != api.ReplicaMissing || gateways[i] == nil {
+			continue
+		}
+		if source < 0 {
+			w.record(fi, r, api.ReplicaMissing, logs.StorageError{Message: "no healthy replica to repair from"})
+			continue
+		}
+
+		src := replicas[source]
+		mid, err := copyObject(ctx, fi, gateways[source], src.Mid, gateways[i])
+		if err != nil {
+			w.record(fi, r, api.ReplicaMissing, err)
+			continue
+		}
+		r.Mid = mid
+		if w.record(fi, r, api.ReplicaOK, nil) {
+			w.update(func(s *Status) { s.Repaired++ })
+			logger.Infof("repaired %s of file %d from %s", r.Backend, fi.ID, src.Backend)
+		}
+	}
+}
+
+// record saves the health of a replica and counts it in the round, it
+// returns false if the replica is not healthy
+func (w *Worker) record(fi api.FileInfo, r *api.ObjectReplica, status api.ReplicaStatus, err error) bool {
+	r.Status = status
+	r.Message = ""
+	if err != nil {
+		r.Message = err.Error()
+	}
+	r.CheckTime = time.Now()
+
+	uerr := w.db.UpdateObjectReplica(context.Background(), *r)
+	if uerr != nil && err == nil {
+		err = uerr
+	}
+
+	if status == api.ReplicaOK && err == nil {
+		w.update(func(s *Status) { s.Healthy++ })
+		return true
+	}
+	w.fail(Failure{FileID: fi.ID, Name: fi.Name, Backend: r.Backend, Message: err.Error(), Time: r.CheckTime})
+	return false
+}
+
+func (w *Worker) fail(f Failure) {
+	w.update(func(s *Status) {
+		s.Failed++
+		if len(s.Failures) < maxFailures {
+			s.Failures = append(s.Failures, f)
+		}
+	})
+}
+
+func (w *Worker) update(f func(*Status)) {
+	w.lk.Lock()
+	defer w.lk.Unlock()
+	f(&w.status)
+}
+
+// prober is implemented by the gateways that can stat an object without
+// reading it
+type prober interface {
+	GetObjectInfo(ctx context.Context, mid string) (api.ObjectInfo, error)
+}
+
+func probe(ctx context.Context, g api.IGateway, mid string) error {
+	if p, ok := g.(prober); ok {
+		_, err := p.GetObjectInfo(ctx, mid)
+		return err
+	}
+	return g.GetObject(ctx, mid, io.Discard, api.ObjectOptions{Length: 1})
+}
+
+// copyObject streams the object from src to dst and returns its id on dst
+func copyObject(ctx context.Context, fi api.FileInfo, src api.IGateway, mid string, dst api.IGateway) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(src.GetObject(ctx, mid, pw, api.ObjectOptions{}))
+	}()
+	defer pr.Close()
+
+	oi, err := dst.PutObject(ctx, fi.Address, fi.Key(), pr, api.ObjectOptions{Size: fi.Size})
+	if err != nil {
+		return "", err
+	}
+	return oi.Cid, nil
+}
+
+func isNotExist(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "not exist") || strings.Contains(msg, "not found")
+}
@@ -0,0 +1,318 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+)
+
+const maxObjectList = 1000
+
+var validBucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+func ListBucketsHandler(c *gin.Context) {
+	address := c.GetString("address")
+
+	buckets, err := listBuckets(address)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	res := listAllMyBucketsResult{
+		Xmlns: s3Namespace,
+		Owner: owner{ID: address, DisplayName: address},
+	}
+	for _, b := range buckets {
+		res.Buckets = append(res.Buckets, bucketXML{
+			Name:         b.Name,
+			CreationDate: iso8601(b.Created),
+		})
+	}
+
+	c.XML(http.StatusOK, res)
+}
+
+// CreateBucketHandler creates a bucket, the location constraint selects
+// the storage of the bucket ("mefs" by default) and its area as
+// "storage:area"
+func CreateBucketHandler(c *gin.Context) {
+	address := c.GetString("address")
+	name := c.Param("bucket")
+
+	if !validBucketName.MatchString(name) {
+		writeError(c, errInvalidBucketName)
+		return
+	}
+
+	var conf createBucketConfiguration
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if len(body) > 0 {
+		err = xml.Unmarshal(body, &conf)
+		if err != nil {
+			writeError(c, errMalformedXML)
+			return
+		}
+	}
+
+	st, area, err := parseLocation(conf.Location)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	_, err = s3opts.Store(st)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = createBucket(&Bucket{
+		Address: address,
+		Name:    name,
+		SType:   st,
+		Area:    area,
+		Created: time.Now(),
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("Location", "/"+name)
+	c.Status(http.StatusOK)
+}
+
+func HeadBucketHandler(c *gin.Context) {
+	_, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func DeleteBucketHandler(c *gin.Context) {
+	b, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = deleteBucket(b)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetBucketHandler serves GetBucketLocation, ListObjectsV2 and ListObjects
+func GetBucketHandler(c *gin.Context) {
+	b, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	query := c.Request.URL.Query()
+	switch {
+	case query.Has("location"):
+		c.XML(http.StatusOK, locationConstraint{Xmlns: s3Namespace, Location: location(b)})
+	case query.Has("uploads"), query.Has("versioning"), query.Has("policy"), query.Has("acl"):
+		writeError(c, errNotImplemented)
+	default:
+		listObjectsHandler(c, b)
+	}
+}
+
+// PostBucketHandler serves DeleteObjects
+func PostBucketHandler(c *gin.Context) {
+	b, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if !c.Request.URL.Query().Has("delete") {
+		writeError(c, errNotImplemented)
+		return
+	}
+
+	var req deleteObjectsRequest
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	err = xml.Unmarshal(body, &req)
+	if err != nil || len(req.Objects) > maxObjectList {
+		writeError(c, errMalformedXML)
+		return
+	}
+
+	res := deleteObjectsResult{Xmlns: s3Namespace}
+	for _, obj := range req.Objects {
+		err := deleteObject(c.Request.Context(), b, obj.Key)
+		if err != nil {
+			aerr := toAPIError(err)
+			res.Errors = append(res.Errors, deleteError{Key: obj.Key, Code: aerr.Code, Message: aerr.Description})
+			continue
+		}
+		if !req.Quiet {
+			res.Deleted = append(res.Deleted, obj)
+		}
+	}
+
+	c.XML(http.StatusOK, res)
+}
+
+func listObjectsHandler(c *gin.Context, b Bucket) {
+	query := c.Request.URL.Query()
+	v2 := query.Get("list-type") == "2"
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	maxKeys := maxObjectList
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(c, errInvalidArgument)
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	res := listBucketResult{
+		Xmlns:     s3Namespace,
+		Name:      b.Name,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+
+	var after string
+	if v2 {
+		res.StartAfter = query.Get("start-after")
+		res.ContinuationToken = query.Get("continuation-token")
+		after = res.StartAfter
+		if res.ContinuationToken != "" {
+			token, err := base64.StdEncoding.DecodeString(res.ContinuationToken)
+			if err != nil {
+				writeError(c, errInvalidArgument)
+				return
+			}
+			after = string(token)
+		}
+	} else {
+		res.Marker = query.Get("marker")
+		after = res.Marker
+	}
+	if cp, ok := commonPrefixOf(after, prefix, delimiter); ok {
+		after = cp + string(utf8.MaxRune)
+	}
+
+	var last string
+	for {
+		objects, err := listObjects(b, prefix, after, maxObjectList)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		requery := false
+		for _, fi := range objects {
+			if res.KeyCount == maxKeys {
+				res.IsTruncated = true
+				break
+			}
+
+			key := fileKey(b.Name, fi)
+			after = key
+			if cp, ok := commonPrefixOf(key, prefix, delimiter); ok {
+				res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: cp})
+				res.KeyCount++
+				last = cp
+				// skip every key under the common prefix
+				after = cp + string(utf8.MaxRune)
+				requery = true
+				break
+			}
+
+			res.Contents = append(res.Contents, toObjectXML(key, fi))
+			res.KeyCount++
+			last = key
+		}
+
+		if res.IsTruncated || (!requery && len(objects) < maxObjectList) {
+			break
+		}
+	}
+
+	if res.IsTruncated {
+		if v2 {
+			res.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(last))
+		} else {
+			res.NextMarker = last
+		}
+	}
+
+	if !v2 {
+		res.KeyCount = 0
+	}
+
+	c.XML(http.StatusOK, res)
+}
+
+func commonPrefixOf(key, prefix, delimiter string) (string, bool) {
+	if delimiter == "" || !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	i := strings.Index(key[len(prefix):], delimiter)
+	if i < 0 {
+		return "", false
+	}
+	return key[:len(prefix)+i+len(delimiter)], true
+}
+
+func parseLocation(loc string) (api.StorageType, string, error) {
+	if loc == "" || loc == "us-east-1" {
+		return api.MEFS, "", nil
+	}
+	name, area, _ := strings.Cut(loc, ":")
+	st, ok := api.ParseStorageType(name)
+	if !ok {
+		return st, "", errInvalidLocation
+	}
+	return st, area, nil
+}
+
+func location(b Bucket) string {
+	if b.Area == "" {
+		return b.SType.String()
+	}
+	return b.SType.String() + ":" + b.Area
+}
+
+func toInt64(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errInvalidArgument
+	}
+	return n, nil
+}
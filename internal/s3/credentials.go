@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/memoio/backend/internal/authentication"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/logs"
+)
+
+const (
+	accessKeyChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	secretKeyChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+)
+
+type CredentialResponse struct {
+	AccessKey string
+	SecretKey string `json:",omitempty"`
+	Created   time.Time
+}
+
+// LoadCredentialModule registers the api used to manage the s3 access keys
+// of the logged in address
+func LoadCredentialModule(g *gin.RouterGroup) {
+	err := InitS3Table()
+	if err != nil {
+		panic(err.Error())
+	}
+
+	cred := g.Group("s3/credentials", auth.VerifyAccessTokenHandler)
+
+	// 创建访问密钥, 密钥只在创建时返回
+	cred.POST("", CreateCredentialHandler())
+
+	// 列出访问密钥
+	cred.GET("", ListCredentialsHandler())
+
+	// 删除访问密钥
+	cred.DELETE(":accesskey", DeleteCredentialHandler())
+}
+
+func CreateCredentialHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address := c.GetString("address")
+
+		accessKey, err := randomString(accessKeyChars, 20)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		secretKey, err := randomString(secretKeyChars, 40)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(err)
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		cred := Credential{
+			AccessKey: accessKey,
+			SecretKey: secretKey,
+			Address:   address,
+			DID:       c.GetString("did"),
+			Created:   time.Now(),
+		}
+		err = database.GlobalDataBase.Create(&cred).Error
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		c.JSON(http.StatusOK, CredentialResponse{
+			AccessKey: cred.AccessKey,
+			SecretKey: cred.SecretKey,
+			Created:   cred.Created,
+		})
+	}
+}
+
+func ListCredentialsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address := c.GetString("address")
+
+		var creds []Credential
+		err := database.GlobalDataBase.Where("address = ?", address).Order("created").Find(&creds).Error
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: err.Error()})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		res := make([]CredentialResponse, 0, len(creds))
+		for _, cred := range creds {
+			res = append(res, CredentialResponse{AccessKey: cred.AccessKey, Created: cred.Created})
+		}
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+func DeleteCredentialHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address := c.GetString("address")
+
+		res := database.GlobalDataBase.Where("accesskey = ? and address = ?", c.Param("accesskey"), address).Delete(&Credential{})
+		if res.Error != nil {
+			errRes := logs.ToAPIErrorCode(logs.DataBaseError{Message: res.Error.Error()})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+		if res.RowsAffected == 0 {
+			errRes := logs.ToAPIErrorCode(logs.ControllerError{Message: "access key not found"})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		c.JSON(http.StatusOK, "delete success")
+	}
+}
+
+func randomString(chars string, n int) (string, error) {
+	max := big.NewInt(int64(len(chars)))
+	b := make([]byte, n)
+	for i := range b {
+		v, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = chars[v.Int64()]
+	}
+	return string(b), nil
+}
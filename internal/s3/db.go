@@ -0,0 +1,161 @@
+package s3
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+	"gorm.io/gorm"
+)
+
+// objectName is the name an object is stored as on the storage
+func objectName(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// objectPath maps the key onto a name in the folders of the bucket, the way
+// the api files objects. Keys that would not map back are not valid.
+func objectPath(bucket, key string) (string, string, error) {
+	folder, name, ok := utils.SplitObject("/"+bucket, key)
+	if !ok || strings.TrimPrefix(folder, "/"+bucket+"/")+name != key {
+		return "", "", errInvalidObjectName
+	}
+	return folder, name, nil
+}
+
+// fileKey is the key of the file fi in the bucket
+func fileKey(bucket string, fi api.FileInfo) string {
+	return strings.TrimPrefix(fi.Path, "/"+bucket+"/") + fi.Name
+}
+
+func getCredential(accessKey string) (Credential, error) {
+	var cred Credential
+	err := database.GlobalDataBase.Where("accesskey = ?", accessKey).First(&cred).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return cred, errInvalidAccessKeyID
+		}
+		return cred, logs.DataBaseError{Message: err.Error()}
+	}
+	return cred, nil
+}
+
+func getBucket(address, name string) (Bucket, error) {
+	var b Bucket
+	err := database.GlobalDataBase.Where("address = ? and name = ?", address, name).First(&b).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return b, errNoSuchBucket
+		}
+		return b, logs.DataBaseError{Message: err.Error()}
+	}
+	return b, nil
+}
+
+func listBuckets(address string) ([]Bucket, error) {
+	var buckets []Bucket
+	err := database.GlobalDataBase.Where("address = ?", address).Order("name").Find(&buckets).Error
+	if err != nil {
+		return nil, logs.DataBaseError{Message: err.Error()}
+	}
+	return buckets, nil
+}
+
+func createBucket(b *Bucket) error {
+	err := database.GlobalDataBase.Create(b).Error
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "UNIQUE constraint failed") {
+			return errBucketAlreadyOwnedByYou
+		}
+		return logs.DataBaseError{Message: err.Error()}
+	}
+	return nil
+}
+
+func deleteBucket(b Bucket) error {
+	objects, err := listObjects(b, "", "", 1)
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		return errBucketNotEmpty
+	}
+
+	err = database.GlobalDataBase.Delete(&b).Error
+	if err != nil {
+		return logs.DataBaseError{Message: err.Error()}
+	}
+	return nil
+}
+
+func getObjectInfo(b Bucket, key string) (api.FileInfo, error) {
+	var fi api.FileInfo
+	folder, name, err := objectPath(b.Name, key)
+	if err != nil {
+		return fi, errNoSuchKey
+	}
+	err = database.GlobalDataBase.Where("address = ? and stype = ? and path = ? and name = ? and archived = ?", b.Address, b.SType, folder, name, false).First(&fi).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fi, errNoSuchKey
+		}
+		return fi, logs.DataBaseError{Message: err.Error()}
+	}
+	return fi, nil
+}
+
+// listObjects returns at most limit objects of bucket b whose key has
+// prefix and sorts after the key after, in key order
+func listObjects(b Bucket, prefix, after string, limit int) ([]api.FileInfo, error) {
+	var fileInfos []api.FileInfo
+
+	// the path and the name of a file make up the key below the bucket folder
+	root := "/" + b.Name + "/"
+	lo := root + prefix
+	err := database.GlobalDataBase.
+		Where("address = ? and stype = ? and substr(path || name, 1, ?) = ? and path || name > ? and archived = ?",
+			b.Address, b.SType, utf8.RuneCountInString(lo), lo, root+after, false).
+		Order("path || name").Limit(limit).Find(&fileInfos).Error
+	if err != nil {
+		return nil, logs.DataBaseError{Message: err.Error()}
+	}
+	return fileInfos, nil
+}
+
+func getUpload(uploadID string) (MultipartUpload, error) {
+	var up MultipartUpload
+	err := database.GlobalDataBase.Where("uploadid = ?", uploadID).First(&up).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return up, errNoSuchUpload
+		}
+		return up, logs.DataBaseError{Message: err.Error()}
+	}
+	return up, nil
+}
+
+func listParts(uploadID string) ([]Part, error) {
+	var parts []Part
+	err := database.GlobalDataBase.Where("uploadid = ?", uploadID).Order("partnumber").Find(&parts).Error
+	if err != nil {
+		return nil, logs.DataBaseError{Message: err.Error()}
+	}
+	return parts, nil
+}
+
+func deleteUpload(uploadID string) error {
+	return database.GlobalDataBase.Transaction(func(tx *gorm.DB) error {
+		err := tx.Delete(&Part{}, "uploadid = ?", uploadID).Error
+		if err != nil {
+			return logs.DataBaseError{Message: err.Error()}
+		}
+		err = tx.Delete(&MultipartUpload{}, "uploadid = ?", uploadID).Error
+		if err != nil {
+			return logs.DataBaseError{Message: err.Error()}
+		}
+		return nil
+	})
+}
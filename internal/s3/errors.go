@@ -0,0 +1,215 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/internal/logs"
+)
+
+type apiError struct {
+	Code           string
+	Description    string
+	HTTPStatusCode int
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+var (
+	errAccessDenied = apiError{
+		Code:           "AccessDenied",
+		Description:    "Access Denied.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errInvalidAccessKeyID = apiError{
+		Code:           "InvalidAccessKeyId",
+		Description:    "The access key ID you provided does not exist in our records.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errSignatureDoesNotMatch = apiError{
+		Code:           "SignatureDoesNotMatch",
+		Description:    "The request signature we calculated does not match the signature you provided.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errRequestTimeTooSkewed = apiError{
+		Code:           "RequestTimeTooSkewed",
+		Description:    "The difference between the request time and the server's time is too large.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errExpiredPresignRequest = apiError{
+		Code:           "AccessDenied",
+		Description:    "Request has expired.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errMissingFields = apiError{
+		Code:           "MissingFields",
+		Description:    "Missing fields in request.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errMalformedXML = apiError{
+		Code:           "MalformedXML",
+		Description:    "The XML you provided was not well-formed or did not validate against our published schema.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errMissingContentLength = apiError{
+		Code:           "MissingContentLength",
+		Description:    "You must provide the Content-Length HTTP header.",
+		HTTPStatusCode: http.StatusLengthRequired,
+	}
+	errBadDigest = apiError{
+		Code:           "XAmzContentSHA256Mismatch",
+		Description:    "The provided 'x-amz-content-sha256' header does not match what was computed.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errInvalidBucketName = apiError{
+		Code:           "InvalidBucketName",
+		Description:    "The specified bucket is not valid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errInvalidLocation = apiError{
+		Code:           "InvalidLocationConstraint",
+		Description:    "The specified location (storage) constraint is not valid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errNoSuchBucket = apiError{
+		Code:           "NoSuchBucket",
+		Description:    "The specified bucket does not exist",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	errBucketAlreadyOwnedByYou = apiError{
+		Code:           "BucketAlreadyOwnedByYou",
+		Description:    "Your previous request to create the named bucket succeeded and you already own it.",
+		HTTPStatusCode: http.StatusConflict,
+	}
+	errBucketNotEmpty = apiError{
+		Code:           "BucketNotEmpty",
+		Description:    "The bucket you tried to delete is not empty",
+		HTTPStatusCode: http.StatusConflict,
+	}
+	errNoSuchKey = apiError{
+		Code:           "NoSuchKey",
+		Description:    "The specified key does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	errNoSuchUpload = apiError{
+		Code:           "NoSuchUpload",
+		Description:    "The specified multipart upload does not exist.",
+		HTTPStatusCode: http.StatusNotFound,
+	}
+	errInvalidPart = apiError{
+		Code:           "InvalidPart",
+		Description:    "One or more of the specified parts could not be found.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errInvalidPartOrder = apiError{
+		Code:           "InvalidPartOrder",
+		Description:    "The list of parts was not in ascending order.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errInvalidArgument = apiError{
+		Code:           "InvalidArgument",
+		Description:    "Invalid argument.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errInvalidObjectName = apiError{
+		Code:           "InvalidArgument",
+		Description:    "The specified key is not a valid object name.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errEntityTooLarge = apiError{
+		Code:           "EntityTooLarge",
+		Description:    "Your proposed upload exceeds the maximum allowed object size.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errMissingSign = apiError{
+		Code:           "AccessDenied",
+		Description:    "The check signed by the buyer is missing from the X-Memo-Sign header.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errInvalidRequest = apiError{
+		Code:           "InvalidRequest",
+		Description:    "The request is not valid.",
+		HTTPStatusCode: http.StatusBadRequest,
+	}
+	errQuotaExceeded = apiError{
+		Code:           "QuotaExceeded",
+		Description:    "Not enough space bought for the address.",
+		HTTPStatusCode: http.StatusForbidden,
+	}
+	errPreconditionFailed = apiError{
+		Code:           "PreconditionFailed",
+		Description:    "At least one of the preconditions you specified did not hold.",
+		HTTPStatusCode: http.StatusPreconditionFailed,
+	}
+	errInvalidRange = apiError{
+		Code:           "InvalidRange",
+		Description:    "The requested range is not satisfiable",
+		HTTPStatusCode: http.StatusRequestedRangeNotSatisfiable,
+	}
+	errNotImplemented = apiError{
+		Code:           "NotImplemented",
+		Description:    "A header you provided implies functionality that is not implemented",
+		HTTPStatusCode: http.StatusNotImplemented,
+	}
+	errInternal = apiError{
+		Code:           "InternalError",
+		Description:    "We encountered an internal error, please try again.",
+		HTTPStatusCode: http.StatusInternalServerError,
+	}
+)
+
+// toAPIError maps errors of the other modules to s3 errors
+func toAPIError(err error) apiError {
+	switch e := err.(type) {
+	case apiError:
+		return e
+	case logs.StorageNotSupport:
+		return errInvalidLocation
+	case logs.NoPermission:
+		return errAccessDenied
+	case logs.ControllerError:
+		res := errInvalidRequest
+		res.Description = e.Message
+		return res
+	}
+	res := errInternal
+	res.Description = err.Error()
+	return res
+}
+
+func (e apiError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func writeError(c *gin.Context, err error) {
+	aerr := toAPIError(err)
+	if aerr.HTTPStatusCode >= http.StatusInternalServerError {
+		logger.Error(err)
+	}
+
+	// object headers may already be set
+	header := c.Writer.Header()
+	for _, key := range []string{"Content-Type", "Content-Length", "ETag", "Last-Modified"} {
+		header.Del(key)
+	}
+
+	if c.Request.Method == http.MethodHead {
+		c.AbortWithStatus(aerr.HTTPStatusCode)
+		return
+	}
+
+	c.Abort()
+	c.XML(aerr.HTTPStatusCode, errorResponse{
+		Code:      aerr.Code,
+		Message:   aerr.Description,
+		Resource:  c.Request.URL.Path,
+		RequestID: c.GetString("requestid"),
+	})
+}
@@ -0,0 +1,134 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/segmentio/ksuid"
+)
+
+var logger = logs.Logger("s3")
+
+// Options are the hooks the s3 front-end needs from the rest of the server
+type Options struct {
+	// Store returns the gateway of the storage type
+	Store func(api.StorageType) (api.IGateway, error)
+	// QuotaCheck fails if address has not bought size more bytes of space,
+	// nothing is charged
+	QuotaCheck func(ctx context.Context, address string, size uint64) error
+	// Put stores the object of address on the storage st the way the api
+	// does, the space is charged on the check opts.Sign of the buyer and an
+	// encrypted object has its key wrapped to did. It returns the mid.
+	Put func(ctx context.Context, address, did string, st api.StorageType, object string, r io.Reader, opts api.ObjectOptions) (string, error)
+	// ReadCheck verifies the traffic check of size more bytes signed by the
+	// buyer address
+	ReadCheck func(ctx context.Context, address, sign string, size uint64) (api.CheckInfo, error)
+	// ChargeTraffic records the traffic check once the object is served
+	ChargeTraffic func(ctx context.Context, ci api.CheckInfo) error
+}
+
+var s3opts Options
+
+// LoadS3Module registers the s3 compatible api, requests are routed
+// path-style: /bucket/key
+func LoadS3Module(g *gin.RouterGroup, opts Options) {
+	err := InitS3Table()
+	if err != nil {
+		panic(err.Error())
+	}
+	s3opts = opts
+
+	s3 := g.Group("", AuthenticateHandler())
+
+	// service
+	s3.GET("", ListBucketsHandler)
+
+	// bucket
+	s3.PUT("/:bucket", CreateBucketHandler)
+	s3.HEAD("/:bucket", HeadBucketHandler)
+	s3.DELETE("/:bucket", DeleteBucketHandler)
+	s3.GET("/:bucket", GetBucketHandler)
+	s3.POST("/:bucket", PostBucketHandler)
+
+	// object, "/bucket/" is still a bucket request
+	s3.PUT("/:bucket/*key", bucketOr(CreateBucketHandler, PutObjectHandler))
+	s3.HEAD("/:bucket/*key", bucketOr(HeadBucketHandler, HeadObjectHandler))
+	s3.DELETE("/:bucket/*key", bucketOr(DeleteBucketHandler, DeleteObjectHandler))
+	s3.GET("/:bucket/*key", bucketOr(GetBucketHandler, GetObjectHandler))
+	s3.POST("/:bucket/*key", bucketOr(PostBucketHandler, PostObjectHandler))
+}
+
+func bucketOr(bucket, object gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if objectKey(c) == "" {
+			bucket(c)
+			return
+		}
+		object(c)
+	}
+}
+
+// signHeader carries the space check of an upload, or the traffic check of
+// a download, signed by the buyer as in the api. A presigned url carries it
+// in the query.
+const signHeader = "X-Memo-Sign"
+
+func signOf(c *gin.Context) string {
+	if sign := c.GetHeader(signHeader); sign != "" {
+		return sign
+	}
+	return c.Query(signHeader)
+}
+
+func objectKey(c *gin.Context) string {
+	return strings.TrimPrefix(c.Param("key"), "/")
+}
+
+// AuthenticateHandler verifies the aws signature v4 of the request and
+// sets the address bound to the access key
+func AuthenticateHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := ksuid.New().String()
+		c.Set("requestid", requestID)
+		c.Header("x-amz-request-id", requestID)
+
+		sr, err := parseSignedRequest(c.Request)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		cred, err := getCredential(sr.scope.accessKey)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		err = sr.verify(c.Request, cred.SecretKey)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(sr.payloadReader(c.Request, cred.SecretKey))
+		c.Set("address", cred.Address)
+		c.Set("did", cred.DID)
+	}
+}
+
+// contentLength returns the size of the payload, aws-chunked bodies
+// carry the decoded size in a header
+func contentLength(r *http.Request) (int64, error) {
+	if v := r.Header.Get("X-Amz-Decoded-Content-Length"); v != "" {
+		return toInt64(v)
+	}
+	if r.ContentLength < 0 {
+		return 0, errMissingContentLength
+	}
+	return r.ContentLength, nil
+}
@@ -0,0 +1,308 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	maxPartNumber = 10000
+	minPartSize   = 5 << 20
+	maxPartSize   = 5 << 30
+	maxObjectSize = 5 << 40
+)
+
+// parts are kept on local disk until the upload is completed
+var partPath = filepath.Join("./", "s3parts")
+
+func partFile(uploadID string, partNumber int) string {
+	return filepath.Join(partPath, uploadID, strconv.Itoa(partNumber))
+}
+
+func createUploadHandler(c *gin.Context) {
+	address := c.GetString("address")
+	key := objectKey(c)
+
+	b, err := getBucket(address, c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	_, _, err = objectPath(b.Name, key)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	userdefine, err := json.Marshal(userDefined(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	up := MultipartUpload{
+		UploadID:   ksuid.New().String(),
+		Address:    address,
+		Bucket:     b.Name,
+		Key:        key,
+		UserDefine: string(userdefine),
+		Encrypt:    encryptOf(c),
+		Created:    time.Now(),
+	}
+
+	err = os.MkdirAll(filepath.Join(partPath, up.UploadID), os.ModePerm)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = database.GlobalDataBase.Create(&up).Error
+	if err != nil {
+		writeError(c, logs.DataBaseError{Message: err.Error()})
+		return
+	}
+
+	c.XML(http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Bucket:   b.Name,
+		Key:      key,
+		UploadID: up.UploadID,
+	})
+}
+
+// uploadOf loads the upload of the request and checks it belongs to the
+// bucket and key of the request
+func uploadOf(c *gin.Context) (MultipartUpload, error) {
+	up, err := getUpload(c.Query("uploadId"))
+	if err != nil {
+		return up, err
+	}
+	if up.Address != c.GetString("address") || up.Bucket != c.Param("bucket") || up.Key != objectKey(c) {
+		return up, errNoSuchUpload
+	}
+	return up, nil
+}
+
+func uploadPartHandler(c *gin.Context) {
+	up, err := uploadOf(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	partNumber, err := strconv.Atoi(c.Query("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+		writeError(c, errInvalidArgument)
+		return
+	}
+
+	size, err := contentLength(c.Request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if size > maxPartSize {
+		writeError(c, errEntityTooLarge)
+		return
+	}
+
+	// the parts uploaded so far and this one are to be stored as one object,
+	// a part uploaded again replaces the previous one
+	parts, err := listParts(up.UploadID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	total := size
+	for _, p := range parts {
+		if p.PartNumber != partNumber {
+			total += p.Size
+		}
+	}
+	if total > maxObjectSize {
+		writeError(c, errEntityTooLarge)
+		return
+	}
+	// the space is charged on completion, when the buyer signs for the total
+	err = s3opts.QuotaCheck(c.Request.Context(), up.Address, uint64(total))
+	if err != nil {
+		writeError(c, quotaError(err))
+		return
+	}
+
+	f, err := os.Create(partFile(up.UploadID, partNumber))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer f.Close()
+
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(c.Request.Body, size+1))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if n != size {
+		writeError(c, errInvalidArgument)
+		return
+	}
+
+	part := Part{
+		UploadID:   up.UploadID,
+		PartNumber: partNumber,
+		Size:       n,
+		ETag:       hex.EncodeToString(h.Sum(nil)),
+		ModTime:    time.Now(),
+	}
+	err = database.GlobalDataBase.Save(&part).Error
+	if err != nil {
+		writeError(c, logs.DataBaseError{Message: err.Error()})
+		return
+	}
+
+	c.Header("ETag", quote(part.ETag))
+	c.Status(http.StatusOK)
+}
+
+func completeUploadHandler(c *gin.Context) {
+	up, err := uploadOf(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	b, err := getBucket(up.Address, up.Bucket)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var req completeMultipartUpload
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	err = xml.Unmarshal(body, &req)
+	if err != nil || len(req.Parts) == 0 {
+		writeError(c, errMalformedXML)
+		return
+	}
+
+	uploaded, err := listParts(up.UploadID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	partMap := make(map[int]Part, len(uploaded))
+	for _, p := range uploaded {
+		partMap[p.PartNumber] = p
+	}
+
+	// the etag of a multipart object is the md5 of the part md5s
+	var size int64
+	h := md5.New()
+	readers := make([]io.Reader, 0, len(req.Parts))
+	for i, cp := range req.Parts {
+		if i > 0 && cp.PartNumber <= req.Parts[i-1].PartNumber {
+			writeError(c, errInvalidPartOrder)
+			return
+		}
+		p, ok := partMap[cp.PartNumber]
+		if !ok || strings.Trim(cp.ETag, "\"") != p.ETag {
+			writeError(c, errInvalidPart)
+			return
+		}
+		if i < len(req.Parts)-1 && p.Size < minPartSize {
+			writeError(c, apiError{
+				Code:           "EntityTooSmall",
+				Description:    "Your proposed upload is smaller than the minimum allowed object size.",
+				HTTPStatusCode: http.StatusBadRequest,
+			})
+			return
+		}
+
+		sum, _ := hex.DecodeString(p.ETag)
+		h.Write(sum)
+		size += p.Size
+
+		f, err := os.Open(partFile(up.UploadID, p.PartNumber))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	etag := hex.EncodeToString(h.Sum(nil)) + "-" + strconv.Itoa(len(req.Parts))
+
+	ud := make(map[string]string)
+	if up.UserDefine != "" {
+		json.Unmarshal([]byte(up.UserDefine), &ud)
+	}
+
+	opts := api.ObjectOptions{
+		Size:        size,
+		Sign:        signOf(c),
+		UserDefined: ud,
+		Encrypt:     up.Encrypt,
+	}
+	_, err = storeObject(c.Request.Context(), b, up.Key, c.GetString("did"), io.MultiReader(readers...), opts, etag)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = removeUpload(up.UploadID)
+	if err != nil {
+		logger.Error("remove upload error: ", err)
+	}
+
+	c.XML(http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: "/" + objectName(b.Name, up.Key),
+		Bucket:   b.Name,
+		Key:      up.Key,
+		ETag:     quote(etag),
+	})
+}
+
+func abortUploadHandler(c *gin.Context) {
+	up, err := uploadOf(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = removeUpload(up.UploadID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func removeUpload(uploadID string) error {
+	err := deleteUpload(uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(partPath, uploadID))
+}
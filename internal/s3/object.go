@@ -0,0 +1,355 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/envelope"
+	"github.com/memoio/backend/utils"
+)
+
+const metaPrefix = "x-amz-meta-"
+
+// PutObjectHandler serves PutObject and UploadPart
+func PutObjectHandler(c *gin.Context) {
+	query := c.Request.URL.Query()
+	if query.Has("uploadId") {
+		uploadPartHandler(c)
+		return
+	}
+	if c.GetHeader("X-Amz-Copy-Source") != "" {
+		writeError(c, errNotImplemented)
+		return
+	}
+
+	address := c.GetString("address")
+	key := objectKey(c)
+
+	b, err := getBucket(address, c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	size, err := contentLength(c.Request)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	opts := api.ObjectOptions{
+		Size:        size,
+		Sign:        signOf(c),
+		UserDefined: userDefined(c),
+		Encrypt:     encryptOf(c),
+	}
+	etag, err := storeObject(c.Request.Context(), b, key, c.GetString("did"), c.Request.Body, opts, "")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("ETag", quote(etag))
+	c.Status(http.StatusOK)
+}
+
+func GetObjectHandler(c *gin.Context) {
+	b, fi, err := objectOf(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	etag := etagOf(fi)
+	setObjectHeaders(c, fi)
+	if code := utils.CheckPreconditions(c.Request, etag, fi.ModTime); code != 0 {
+		if code == http.StatusPreconditionFailed {
+			writeError(c, errPreconditionFailed)
+			return
+		}
+		c.Writer.Header().Del("Content-Length")
+		c.Status(code)
+		return
+	}
+
+	status := http.StatusOK
+	size := fi.Size
+	opts := api.ObjectOptions{}
+	br, err := utils.RequestRange(c.Request, etag, fi.ModTime, fi.Size)
+	if err != nil {
+		c.Header("Content-Range", "bytes */"+strconv.FormatInt(fi.Size, 10))
+		writeError(c, errInvalidRange)
+		return
+	}
+	if br != nil {
+		status = http.StatusPartialContent
+		size = br.Length
+		opts.Offset = br.Start
+		opts.Length = br.Length
+		c.Header("Content-Range", br.ContentRange(fi.Size))
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	// only the bytes served are charged, on a check the buyer signed
+	var ci api.CheckInfo
+	if size > 0 {
+		sign := signOf(c)
+		if sign == "" {
+			writeError(c, errMissingSign)
+			return
+		}
+		ci, err = s3opts.ReadCheck(c.Request.Context(), b.Address, sign, uint64(size))
+		if err != nil {
+			writeError(c, quotaError(err))
+			return
+		}
+	}
+
+	store, err := s3opts.Store(b.SType)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Status(status)
+	err = envelope.GetObject(c.Request.Context(), store, fi, c.Writer, opts)
+	if err != nil {
+		if !c.Writer.Written() {
+			writeError(c, err)
+			return
+		}
+		logger.Error("get object error: ", err)
+		return
+	}
+	if size > 0 {
+		err = s3opts.ChargeTraffic(c.Request.Context(), ci)
+		if err != nil {
+			logger.Error("charge traffic error: ", err)
+			return
+		}
+	}
+	recordLedger(c.Request.Context(), api.LedgerDownload, fi, size)
+}
+
+func HeadObjectHandler(c *gin.Context) {
+	_, fi, err := objectOf(c)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	setObjectHeaders(c, fi)
+	if code := utils.CheckPreconditions(c.Request, etagOf(fi), fi.ModTime); code != 0 {
+		c.Status(code)
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// DeleteObjectHandler serves DeleteObject and AbortMultipartUpload
+func DeleteObjectHandler(c *gin.Context) {
+	if c.Request.URL.Query().Has("uploadId") {
+		abortUploadHandler(c)
+		return
+	}
+
+	b, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	err = deleteObject(c.Request.Context(), b, objectKey(c))
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// PostObjectHandler serves CreateMultipartUpload and CompleteMultipartUpload
+func PostObjectHandler(c *gin.Context) {
+	query := c.Request.URL.Query()
+	switch {
+	case query.Has("uploads"):
+		createUploadHandler(c)
+	case query.Has("uploadId"):
+		completeUploadHandler(c)
+	default:
+		writeError(c, errNotImplemented)
+	}
+}
+
+func objectOf(c *gin.Context) (Bucket, api.FileInfo, error) {
+	b, err := getBucket(c.GetString("address"), c.Param("bucket"))
+	if err != nil {
+		return b, api.FileInfo{}, err
+	}
+
+	fi, err := getObjectInfo(b, objectKey(c))
+	return b, fi, err
+}
+
+// storeObject puts the object into the folders of the bucket the way the
+// api does, the object replaced is kept as an older version or in the trash.
+// The space is charged on the check opts.Sign of the buyer. If etag is empty
+// the md5 of the content is used, the etag is returned.
+func storeObject(ctx context.Context, b Bucket, key, did string, r io.Reader, opts api.ObjectOptions, etag string) (string, error) {
+	_, _, err := objectPath(b.Name, key)
+	if err != nil {
+		return "", err
+	}
+	if opts.Sign == "" {
+		return "", errMissingSign
+	}
+
+	h := md5.New()
+	if etag == "" {
+		r = io.TeeReader(r, h)
+	}
+
+	// the folders of the key are put under the folder of the bucket
+	opts.Path = "/" + b.Name
+	opts.Area = b.Area
+	mid, err := s3opts.Put(ctx, b.Address, did, b.SType, key, r, opts)
+	if err != nil {
+		return "", err
+	}
+	if etag == "" {
+		etag = hex.EncodeToString(h.Sum(nil))
+	}
+
+	// the etag is kept with the metadata, unless the key was put again since
+	fi, err := getObjectInfo(b, key)
+	if err == nil && fi.Mid == mid {
+		meta := metaOf(fi)
+		meta["etag"] = etag
+		var userdefine []byte
+		userdefine, err = json.Marshal(meta)
+		if err == nil {
+			err = database.NewDataBase().UpdateUserDefine(ctx, fi.ID, string(userdefine))
+		}
+	}
+	if err != nil {
+		logger.Error("record etag error: ", err)
+	}
+
+	return etag, nil
+}
+
+// recordLedger appends a transfer of bytes of fi to the ledger
+func recordLedger(ctx context.Context, kind api.LedgerKind, fi api.FileInfo, bytes int64) {
+	database.NewDataBase().AppendLedger(ctx, api.LedgerEntry{
+		Address: fi.Address,
+		SType:   fi.SType,
+		Kind:    kind,
+		FileID:  fi.ID,
+		Mid:     fi.Mid,
+		Bytes:   bytes,
+		Time:    time.Now(),
+	})
+}
+
+// deleteObject moves the object into the trash with its older versions, it
+// is removed from the storage once the trash is swept. A missing key is not
+// an error.
+func deleteObject(ctx context.Context, b Bucket, key string) error {
+	fi, err := getObjectInfo(b, key)
+	if err != nil {
+		if err == errNoSuchKey {
+			return nil
+		}
+		return err
+	}
+
+	return database.NewDataBase().TrashObject(ctx, fi.ID)
+}
+
+// userDefined collects the content type and the user metadata of the request
+func userDefined(c *gin.Context) map[string]string {
+	ud := make(map[string]string)
+	for k, v := range c.Request.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, metaPrefix) && len(v) > 0 {
+			ud[k] = v[0]
+		}
+	}
+	if ct := c.GetHeader("Content-Type"); ct != "" {
+		ud["content-type"] = ct
+	}
+	return ud
+}
+
+// encryptOf tells if the request asks for server side encryption
+func encryptOf(c *gin.Context) bool {
+	return c.GetHeader("X-Amz-Server-Side-Encryption") != ""
+}
+
+func metaOf(fi api.FileInfo) map[string]string {
+	meta := make(map[string]string)
+	if fi.UserDefine != "" {
+		err := json.Unmarshal([]byte(fi.UserDefine), &meta)
+		if err != nil {
+			logger.Error("unmarshal userdefine error, ", err)
+		}
+	}
+	return meta
+}
+
+func etagOf(fi api.FileInfo) string {
+	etag := metaOf(fi)["etag"]
+	if etag == "" {
+		etag = fi.Mid
+	}
+	return etag
+}
+
+func setObjectHeaders(c *gin.Context, fi api.FileInfo) {
+	meta := metaOf(fi)
+	ctype := meta["content-type"]
+	if ctype == "" {
+		ctype = utils.FileContentType(fi)
+	}
+
+	c.Header("Content-Type", ctype)
+	c.Header("Content-Length", strconv.FormatInt(fi.Size, 10))
+	c.Header("ETag", quote(etagOf(fi)))
+	c.Header("Last-Modified", fi.ModTime.UTC().Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("x-amz-meta-mid", fi.Mid)
+	for k, v := range meta {
+		if strings.HasPrefix(k, metaPrefix) {
+			c.Header(k, v)
+		}
+	}
+}
+
+func toObjectXML(key string, fi api.FileInfo) objectXML {
+	return objectXML{
+		Key:          key,
+		LastModified: iso8601(fi.ModTime),
+		ETag:         quote(etagOf(fi)),
+		Size:         fi.Size,
+		StorageClass: "STANDARD",
+	}
+}
+
+func quotaError(err error) apiError {
+	res := errQuotaExceeded
+	res.Description = err.Error()
+	return res
+}
+
+func quote(s string) string {
+	return "\"" + s + "\""
+}
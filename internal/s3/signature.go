@@ -0,0 +1,406 @@
+package s3
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signV4Algorithm  = "AWS4-HMAC-SHA256"
+	iso8601Format    = "20060102T150405Z"
+	yyyymmdd         = "20060102"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	maxSkewTime    = 15 * time.Minute
+	maxPresignTime = 7 * 24 * time.Hour
+)
+
+// credentialScope is the "AKID/date/region/service/aws4_request" part of a
+// signature
+type credentialScope struct {
+	accessKey string
+	date      string
+	region    string
+	service   string
+}
+
+func (s credentialScope) String() string {
+	return strings.Join([]string{s.date, s.region, s.service, "aws4_request"}, "/")
+}
+
+func parseCredential(v string) (credentialScope, error) {
+	parts := strings.Split(strings.TrimSpace(v), "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return credentialScope{}, errMissingFields
+	}
+	return credentialScope{
+		accessKey: parts[0],
+		date:      parts[1],
+		region:    parts[2],
+		service:   parts[3],
+	}, nil
+}
+
+// signedRequest holds everything parsed from a sigv4 signed request
+type signedRequest struct {
+	scope         credentialScope
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	payloadHash   string
+	presigned     bool
+}
+
+// parseSignedRequest reads the signature either from the Authorization
+// header or from the query of a presigned url
+func parseSignedRequest(r *http.Request) (signedRequest, error) {
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		return parsePresigned(r)
+	}
+	return parseAuthorization(r)
+}
+
+func parseAuthorization(r *http.Request) (signedRequest, error) {
+	var res signedRequest
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, signV4Algorithm) {
+		return res, errAccessDenied
+	}
+	auth = strings.TrimSpace(strings.TrimPrefix(auth, signV4Algorithm))
+	for _, field := range strings.Split(auth, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return res, errMissingFields
+		}
+		switch kv[0] {
+		case "Credential":
+			scope, err := parseCredential(kv[1])
+			if err != nil {
+				return res, err
+			}
+			res.scope = scope
+		case "SignedHeaders":
+			res.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			res.signature = kv[1]
+		}
+	}
+	if res.scope.accessKey == "" || len(res.signedHeaders) == 0 || res.signature == "" {
+		return res, errMissingFields
+	}
+
+	date := r.Header.Get("X-Amz-Date")
+	if date == "" {
+		date = r.Header.Get("Date")
+	}
+	t, err := time.Parse(iso8601Format, date)
+	if err != nil {
+		t, err = http.ParseTime(date)
+		if err != nil {
+			return res, errMissingFields
+		}
+	}
+	res.amzDate = t
+	if d := time.Since(t); d > maxSkewTime || d < -maxSkewTime {
+		return res, errRequestTimeTooSkewed
+	}
+
+	res.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if res.payloadHash == "" {
+		res.payloadHash = emptySHA256
+	}
+
+	return res, nil
+}
+
+func parsePresigned(r *http.Request) (signedRequest, error) {
+	var res signedRequest
+	query := r.URL.Query()
+
+	if query.Get("X-Amz-Algorithm") != signV4Algorithm {
+		return res, errAccessDenied
+	}
+	scope, err := parseCredential(query.Get("X-Amz-Credential"))
+	if err != nil {
+		return res, err
+	}
+	res.scope = scope
+	res.signedHeaders = strings.Split(query.Get("X-Amz-SignedHeaders"), ";")
+	res.signature = query.Get("X-Amz-Signature")
+	if res.signature == "" {
+		return res, errMissingFields
+	}
+
+	t, err := time.Parse(iso8601Format, query.Get("X-Amz-Date"))
+	if err != nil {
+		return res, errMissingFields
+	}
+	res.amzDate = t
+
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignTime {
+		return res, errMissingFields
+	}
+	if time.Now().After(t.Add(time.Duration(expires) * time.Second)) {
+		return res, errExpiredPresignRequest
+	}
+
+	res.payloadHash = unsignedPayload
+	res.presigned = true
+
+	return res, nil
+}
+
+// encodePath encodes a path the way aws does: every byte except
+// unreserved characters and '/' is percent encoded
+func encodePath(p string) string {
+	return uriEncode(p, false)
+}
+
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || (ch == '/' && !encodeSlash) {
+			b.WriteByte(ch)
+			continue
+		}
+		b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{ch})))
+	}
+	return b.String()
+}
+
+func canonicalQuery(query url.Values, presigned bool) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string{}, query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func canonicalHeaders(r *http.Request, signed []string) string {
+	var b strings.Builder
+	for _, h := range signed {
+		var val string
+		switch h {
+		case "host":
+			val = r.Host
+		case "content-length":
+			val = strconv.FormatInt(r.ContentLength, 10)
+			if v := r.Header.Get("Content-Length"); v != "" {
+				val = v
+			}
+		default:
+			vals := r.Header.Values(h)
+			for i := range vals {
+				vals[i] = strings.Join(strings.Fields(vals[i]), " ")
+			}
+			val = strings.Join(vals, ",")
+		}
+		b.WriteString(h + ":" + val + "\n")
+	}
+	return b.String()
+}
+
+func canonicalRequest(r *http.Request, sr signedRequest) string {
+	return strings.Join([]string{
+		r.Method,
+		encodePath(r.URL.Path),
+		canonicalQuery(r.URL.Query(), sr.presigned),
+		canonicalHeaders(r, sr.signedHeaders),
+		strings.Join(sr.signedHeaders, ";"),
+		sr.payloadHash,
+	}, "\n")
+}
+
+func stringToSign(canonical string, t time.Time, scope credentialScope) string {
+	hash := sha256.Sum256([]byte(canonical))
+	return strings.Join([]string{
+		signV4Algorithm,
+		t.UTC().Format(iso8601Format),
+		scope.String(),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func signingKey(secret string, scope credentialScope) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), scope.date)
+	key = hmacSHA256(key, scope.region)
+	key = hmacSHA256(key, scope.service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// verify checks the request signature with secret
+func (sr signedRequest) verify(r *http.Request, secret string) error {
+	if sr.scope.date != sr.amzDate.UTC().Format(yyyymmdd) {
+		return errSignatureDoesNotMatch
+	}
+	sts := stringToSign(canonicalRequest(r, sr), sr.amzDate, sr.scope)
+	expected := hex.EncodeToString(hmacSHA256(signingKey(secret, sr.scope), sts))
+	if !hmac.Equal([]byte(expected), []byte(sr.signature)) {
+		return errSignatureDoesNotMatch
+	}
+	return nil
+}
+
+// payloadReader wraps the request body so that the payload is checked
+// against what the client signed while it is streamed to the backend
+func (sr signedRequest) payloadReader(r *http.Request, secret string) io.Reader {
+	switch sr.payloadHash {
+	case unsignedPayload:
+		return r.Body
+	case streamingPayload:
+		return newChunkedReader(r.Body, signingKey(secret, sr.scope), sr.scope, sr.amzDate, sr.signature)
+	default:
+		return &hashReader{r: r.Body, h: sha256.New(), expected: sr.payloadHash}
+	}
+}
+
+type hashReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected string
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.h.Sum(nil)) != h.expected {
+		return n, errBadDigest
+	}
+	return n, err
+}
+
+// chunkedReader decodes a STREAMING-AWS4-HMAC-SHA256-PAYLOAD body and
+// verifies the signature of every chunk
+type chunkedReader struct {
+	r       *bufio.Reader
+	key     []byte
+	scope   credentialScope
+	t       time.Time
+	prevSig string
+
+	buf  []byte
+	done bool
+	err  error
+}
+
+func newChunkedReader(r io.Reader, key []byte, scope credentialScope, t time.Time, seedSig string) *chunkedReader {
+	return &chunkedReader{
+		r:       bufio.NewReader(r),
+		key:     key,
+		scope:   scope,
+		t:       t,
+		prevSig: seedSig,
+	}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		if c.done {
+			return 0, io.EOF
+		}
+		c.err = c.readChunk()
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *chunkedReader) readChunk() error {
+	header, err := readLine(c.r)
+	if err != nil {
+		return err
+	}
+	// hex-size;chunk-signature=sig
+	parts := strings.SplitN(header, ";", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[1], "chunk-signature=") {
+		return errMalformedXML
+	}
+	size, err := strconv.ParseInt(parts[0], 16, 64)
+	if err != nil || size < 0 {
+		return errMalformedXML
+	}
+	sig := strings.TrimPrefix(parts[1], "chunk-signature=")
+
+	data := make([]byte, size)
+	_, err = io.ReadFull(c.r, data)
+	if err != nil {
+		return err
+	}
+	line, err := readLine(c.r)
+	if err != nil {
+		return err
+	}
+	if line != "" {
+		return errMalformedXML
+	}
+
+	dataHash := sha256.Sum256(data)
+	sts := strings.Join([]string{
+		"AWS4-HMAC-SHA256-PAYLOAD",
+		c.t.UTC().Format(iso8601Format),
+		c.scope.String(),
+		c.prevSig,
+		emptySHA256,
+		hex.EncodeToString(dataHash[:]),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.key, sts))
+	if !hmac.Equal([]byte(expected), []byte(sig)) {
+		return errSignatureDoesNotMatch
+	}
+	c.prevSig = sig
+
+	if size == 0 {
+		c.done = true
+	}
+	c.buf = data
+	return nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
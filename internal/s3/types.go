@@ -0,0 +1,185 @@
+package s3
+
+import (
+	"encoding/xml"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/database"
+)
+
+const s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Credential binds an s3 access key pair to a wallet address
+type Credential struct {
+	AccessKey string `json:"accessKey" gorm:"primarykey;column:accesskey"`
+	SecretKey string `json:"secretKey" gorm:"column:secretkey"`
+	Address   string `json:"address" gorm:"index;column:address"`
+	// DID is the owner the keys of the objects encrypted are wrapped to
+	DID     string    `json:"did" gorm:"column:did"`
+	Created time.Time `json:"created"`
+}
+
+func (Credential) TableName() string {
+	return "s3credential"
+}
+
+// Bucket is a per-address namespace, objects of the bucket are stored
+// in fileinfo under the folder "/bucket/", the folders of their key below it
+type Bucket struct {
+	ID      int             `gorm:"primarykey"`
+	Address string          `gorm:"uniqueIndex:bucket_composite;column:address"`
+	Name    string          `gorm:"uniqueIndex:bucket_composite;column:name"`
+	SType   api.StorageType `gorm:"column:stype"`
+	// Area selects the users of the storage the objects are put with
+	Area    string `gorm:"column:area"`
+	Created time.Time
+}
+
+func (Bucket) TableName() string {
+	return "s3bucket"
+}
+
+type MultipartUpload struct {
+	UploadID   string `gorm:"primarykey;column:uploadid"`
+	Address    string `gorm:"column:address"`
+	Bucket     string `gorm:"column:bucket"`
+	Key        string `gorm:"column:key"`
+	UserDefine string `gorm:"column:userdefine"`
+	Encrypt    bool   `gorm:"column:encrypt"`
+	Created    time.Time
+}
+
+func (MultipartUpload) TableName() string {
+	return "s3upload"
+}
+
+type Part struct {
+	UploadID   string `gorm:"primarykey;column:uploadid"`
+	PartNumber int    `gorm:"primarykey;column:partnumber"`
+	Size       int64
+	ETag       string    `gorm:"column:etag"`
+	ModTime    time.Time `gorm:"column:modtime"`
+}
+
+func (Part) TableName() string {
+	return "s3part"
+}
+
+func InitS3Table() error {
+	return database.GlobalDataBase.AutoMigrate(&Credential{}, &Bucket{}, &MultipartUpload{}, &Part{})
+}
+
+// xml responses
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketXML struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Owner   owner       `xml:"Owner"`
+	Buckets []bucketXML `xml:"Buckets>Bucket"`
+}
+
+type objectXML struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectXML    `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+type createBucketConfiguration struct {
+	XMLName  xml.Name `xml:"CreateBucketConfiguration"`
+	Location string   `xml:"LocationConstraint"`
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name       `xml:"CompleteMultipartUpload"`
+	Parts   []completePart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+type objectIdentifier struct {
+	Key string `xml:"Key"`
+}
+
+type deleteObjectsRequest struct {
+	XMLName xml.Name           `xml:"Delete"`
+	Quiet   bool               `xml:"Quiet"`
+	Objects []objectIdentifier `xml:"Object"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteObjectsResult struct {
+	XMLName xml.Name           `xml:"DeleteResult"`
+	Xmlns   string             `xml:"xmlns,attr"`
+	Deleted []objectIdentifier `xml:"Deleted"`
+	Errors  []deleteError      `xml:"Error"`
+}
+
+func iso8601(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -1,6 +1,7 @@
 package share
 
 import (
+	"context"
 	"time"
 
 	"github.com/memoio/backend/config"
@@ -106,9 +107,12 @@ func SaveShare(address string, chainID int, share *ShareObjectInfo) error {
 		return err
 	}
 
+	// the copy is a new row referring to the same content, which gains a
+	// reference and keeps its replicas
+	id := info.ID
 	info.Address = address
 	info.ChainID = chainID
 
-	_, err = database.Put(info)
+	_, err = database.NewDataBase().CopyObject(context.Background(), id, info)
 	return err
 }
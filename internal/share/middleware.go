@@ -1,16 +1,23 @@
 package share
 
 import (
-	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
 	auth "github.com/memoio/backend/internal/authentication"
+	"github.com/memoio/backend/internal/database"
+	"github.com/memoio/backend/internal/envelope"
 	"github.com/memoio/backend/internal/gateway/ipfs"
+	"github.com/memoio/backend/internal/gateway/local"
 	"github.com/memoio/backend/internal/gateway/mefs"
+	"github.com/memoio/backend/internal/gateway/qiniu"
 	"github.com/memoio/backend/internal/logs"
 	"github.com/memoio/backend/internal/storage"
 	"github.com/memoio/backend/utils"
@@ -30,19 +37,38 @@ func init() {
 func loadApiMap() {
 	ApiMap = make(map[string]*Api)
 
+	// a storage that fails to load does not keep the others out
 	mefs, err := mefs.NewGateway()
 	if err != nil {
 		log.Println("load mefs ap failed")
-		return
+	} else {
+		ApiMap["/mefs"] = &Api{G: mefs, T: storage.MEFS}
 	}
-	ApiMap["/mefs"] = &Api{G: mefs, T: storage.MEFS}
 
 	ipfs, err := ipfs.NewGateway()
 	if err != nil {
 		log.Println("load ipfs ap failed")
-		return
+	} else {
+		ApiMap["/ipfs"] = &Api{G: ipfs, T: storage.IPFS}
+	}
+
+	if config.Cfg.Storage.Local.Enable {
+		local, err := local.NewGateway()
+		if err != nil {
+			log.Println("load local ap failed")
+		} else {
+			ApiMap["/local"] = &Api{G: local, T: storage.LOCAL}
+		}
+	}
+
+	if config.Cfg.Storage.Qiniu.Enable {
+		qiniu, err := qiniu.NewGateway()
+		if err != nil {
+			log.Println("load qiniu ap failed")
+		} else {
+			ApiMap["/qiniu"] = &Api{G: qiniu, T: storage.QINIU}
+		}
 	}
-	ApiMap["/ipfs"] = &Api{G: ipfs, T: storage.IPFS}
 }
 
 func LoadShareModule(g *gin.RouterGroup) {
@@ -62,6 +88,11 @@ func LoadShareModule(g *gin.RouterGroup) {
 		share.GET("info/:shareid", GetShareHandler())
 	}
 
+	{
+		// 免费, several shares downloaded as one archive
+		g.GET("share/archive", ArchiveSharesHandler())
+	}
+
 	{
 		// 需要登录
 		share := g.Group("share", auth.VerifyIdentityHandler)
@@ -126,24 +157,101 @@ func DownloadShareHandler() gin.HandlerFunc {
 			return
 		}
 
-		var w bytes.Buffer
-		err = ApiMap["/"+share.SType.String()].G.GetObject(c.Request.Context(), file.Mid, &w, api.ObjectOptions{})
-		if err != nil {
-			errRes := logs.ToAPIErrorCode(err)
+		store, ok := ApiMap["/"+share.SType.String()]
+		if !ok {
+			errRes := logs.ToAPIErrorCode(logs.StorageNotSupport{})
 			c.JSON(errRes.HTTPStatusCode, errRes)
 			return
 		}
 
-		head := fmt.Sprintf("attachment; filename=\"%s\"", file.Name)
-		extraHeaders := map[string]string{
-			"Content-Disposition": head,
+		header := c.Writer.Header()
+		header.Set("ETag", "\""+file.Mid+"\"")
+		header.Set("Last-Modified", file.ModTime.UTC().Format(http.TimeFormat))
+		header.Set("Accept-Ranges", "bytes")
+
+		if code := utils.CheckPreconditions(c.Request, file.Mid, file.ModTime); code != 0 {
+			c.Status(code)
+			return
 		}
 
-		c.DataFromReader(http.StatusOK, file.Size, utils.TypeByExtension(file.Name), &w, extraHeaders)
+		status := http.StatusOK
+		size := file.Size
+		opts := api.ObjectOptions{}
+		br, err := utils.RequestRange(c.Request, file.Mid, file.ModTime, file.Size)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			c.Status(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		if br != nil {
+			status = http.StatusPartialContent
+			size = br.Length
+			opts.Offset = br.Start
+			opts.Length = br.Length
+			header.Set("Content-Range", br.ContentRange(file.Size))
+		}
 
+		// stream the object through a pipe, closing the reader stops the
+		// gateway when the client goes away
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			err := envelope.GetObject(c.Request.Context(), store.G, file, pw, opts)
+			pw.CloseWithError(err)
+		}()
+
+		// headers are sent with the first copied byte, so a failed read can
+		// still be answered with an error
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", file.Name))
+		header.Set("Content-Type", utils.FileContentType(file))
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+		c.Status(status)
+
+		// only the bytes the client got are recorded
+		cw := &countWriter{w: c.Writer}
+		_, err = io.Copy(cw, pr)
+		if err != nil {
+			if !c.Writer.Written() {
+				for _, key := range []string{"Content-Disposition", "Content-Type", "Content-Length", "Content-Range", "ETag", "Last-Modified"} {
+					header.Del(key)
+				}
+				errRes := logs.ToAPIErrorCode(err)
+				c.JSON(errRes.HTTPStatusCode, errRes)
+				return
+			}
+			log.Println("download share error:", err)
+			return
+		}
+		recordDownload(c, file, cw.n)
 	}
 }
 
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// recordDownload appends a download of file through a share to the ledger of
+// its owner
+func recordDownload(c *gin.Context, file api.FileInfo, bytes int64) {
+	database.NewDataBase().AppendLedger(c.Request.Context(), api.LedgerEntry{
+		Address: file.Address,
+		SType:   file.SType,
+		Kind:    api.LedgerShare,
+		FileID:  file.ID,
+		Mid:     file.Mid,
+		Actor:   c.GetString("address"),
+		Bytes:   bytes,
+		Time:    time.Now(),
+	})
+}
+
 func CreateShareHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		address := c.GetString("address")
@@ -240,3 +348,76 @@ func ListSharesHandler() gin.HandlerFunc {
 		c.JSON(http.StatusOK, shares)
 	}
 }
+
+const maxArchiveShares = 1000
+
+// ArchiveSharesHandler streams the files of the shares given as id as one
+// zip or tar archive, like a share download it is free
+func ArchiveSharesHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ids := c.QueryArray("id")
+		if len(ids) == 0 || len(ids) > maxArchiveShares {
+			errRes := logs.ToAPIErrorCode(logs.ServerError{Message: "an archive holds 1 to 1000 shares"})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		files := make([]api.FileInfo, 0, len(ids))
+		stores := make([]api.IGateway, 0, len(ids))
+		for _, id := range ids {
+			share := GetShareByID(id)
+			if share == nil || !share.IsAvailable() {
+				c.AbortWithStatusJSON(404, "The share link "+id+" is not available")
+				return
+			}
+
+			file, err := share.Source()
+			if err != nil {
+				errRes := logs.ToAPIErrorCode(err)
+				c.JSON(errRes.HTTPStatusCode, errRes)
+				return
+			}
+			store, ok := ApiMap["/"+share.SType.String()]
+			if !ok {
+				errRes := logs.ToAPIErrorCode(logs.StorageNotSupport{})
+				c.JSON(errRes.HTTPStatusCode, errRes)
+				return
+			}
+			files = append(files, file)
+			stores = append(stores, store.G)
+		}
+
+		format := c.DefaultQuery("format", "zip")
+		aw, err := utils.NewArchiveWriter(c.Writer, format)
+		if err != nil {
+			errRes := logs.ToAPIErrorCode(logs.ServerError{Message: err.Error()})
+			c.JSON(errRes.HTTPStatusCode, errRes)
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"shares.%s\"", format))
+		header.Set("Content-Type", utils.ArchiveType(format))
+		c.Status(http.StatusOK)
+
+		names := make(utils.ArchiveNames)
+		for i, file := range files {
+			w, err := aw.Create(names.Unique(file.Name), file.Size, file.ModTime)
+			if err != nil {
+				log.Println("archive shares error:", err)
+				return
+			}
+			cw := &countWriter{w: w}
+			err = envelope.GetObject(c.Request.Context(), stores[i], file, cw, api.ObjectOptions{})
+			if err != nil {
+				log.Println("archive shares error:", err)
+				return
+			}
+			recordDownload(c, file, cw.n)
+		}
+		err = aw.Close()
+		if err != nil {
+			log.Println("archive shares error:", err)
+		}
+	}
+}
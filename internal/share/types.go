@@ -52,6 +52,9 @@ func GetShareByUniqueIndex(address string, chainid int, mid string, stype storag
 	if err := database.GlobalDataBase.Where("address = ? and chain_id = ? and m_id = ? and s_type = ?", address, chainid, mid, stype).Find(&share).Error; err != nil {
 		return nil
 	}
+	if share.ShareID == "" {
+		return nil
+	}
 	return &share
 }
 
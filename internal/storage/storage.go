@@ -18,6 +18,7 @@ const (
 	MEFS StorageType = iota
 	IPFS
 	QINIU
+	LOCAL
 )
 
 func (s StorageType) String() string {
@@ -28,6 +29,8 @@ func (s StorageType) String() string {
 		return "ipfs"
 	case QINIU:
 		return "qiniu"
+	case LOCAL:
+		return "local"
 	default:
 		return "unknow storage"
 	}
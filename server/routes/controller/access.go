@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -15,17 +16,10 @@ func (c *Controller) canWrite(ctx context.Context, address, sign string, size ui
 	if err != nil {
 		return api.CheckInfo{}, err
 	}
-	if !strings.HasPrefix(sign, "0x") {
-		sign = "0x" + sign
-	}
-	sig, err := hexutil.Decode(sign)
+	ci.Sign, err = decodeSign(sign)
 	if err != nil {
-		return api.CheckInfo{}, logs.ControllerError{Message: err.Error()}
-	}
-	if sig[64] == 27 || sig[64] == 28 {
-		sig[64] -= 27
+		return api.CheckInfo{}, err
 	}
-	ci.Sign = sig
 	err = c.verifySign(ctx, "space", ci)
 	if err != nil {
 		return api.CheckInfo{}, err
@@ -39,11 +33,10 @@ func (c *Controller) canRead(ctx context.Context, address, sign string, size uin
 		return api.CheckInfo{}, err
 	}
 
-	sig := hexutil.MustDecode(sign)
-	if sig[64] == 27 || sig[64] == 28 {
-		sig[64] -= 27
+	ci.Sign, err = decodeSign(sign)
+	if err != nil {
+		return api.CheckInfo{}, err
 	}
-	ci.Sign = sig
 	err = c.verifySign(ctx, "traffic", ci)
 	if err != nil {
 		return api.CheckInfo{}, err
@@ -51,6 +44,27 @@ func (c *Controller) canRead(ctx context.Context, address, sign string, size uin
 	return ci, nil
 }
 
+// decodeSign returns the signature in hex, with or without 0x, with its
+// recovery id as 0 or 1
+func decodeSign(sign string) ([]byte, error) {
+	if !strings.HasPrefix(sign, "0x") {
+		sign = "0x" + sign
+	}
+	sig, err := hexutil.Decode(sign)
+	if err == nil && len(sig) != 65 {
+		err = fmt.Errorf("sign should have 65 bytes, got %d", len(sig))
+	}
+	if err != nil {
+		lerr := logs.ControllerError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+	if sig[64] == 27 || sig[64] == 28 {
+		sig[64] -= 27
+	}
+	return sig, nil
+}
+
 func (c *Controller) verifySign(ctx context.Context, ct string, ci api.CheckInfo) error {
 	var hash api.Check
 	if ct == "space" {
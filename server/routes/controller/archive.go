@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/envelope"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+)
+
+const maxArchiveFiles = 10000
+
+// ArchiveRequest selects the objects of an archive, the objects IDs or
+// every object under the folder Path. Format is "zip", the default, or "tar".
+type ArchiveRequest struct {
+	IDs    []int  `json:"ids"`
+	Path   string `json:"path"`
+	Format string `json:"format"`
+}
+
+// Archive is an archive whose traffic is checked, it is written once
+type Archive struct {
+	Name   string
+	Format string
+	// Size is the size of the objects archived
+	Size  int64
+	files []api.FileInfo
+	names []string
+	ci    api.CheckInfo
+}
+
+// PrepareArchive selects the objects of req and checks the traffic of them
+// all against sign, nothing is read from the storage yet
+func (c *Controller) PrepareArchive(ctx context.Context, address, sign string, req ArchiveRequest) (*Archive, error) {
+	a := &Archive{Name: "archive", Format: req.Format}
+	if a.Format == "" {
+		a.Format = "zip"
+	}
+	if a.Format != "zip" && a.Format != "tar" {
+		lerr := logs.ControllerError{Message: utils.ErrArchiveFormat.Error()}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	if len(req.IDs) > maxArchiveFiles {
+		return nil, tooManyFiles()
+	}
+
+	// names are kept from the folder archived, or from the root
+	root := "/"
+	switch {
+	case len(req.IDs) > 0:
+		for _, id := range req.IDs {
+			fi, err := c.getOwnedObject(ctx, address, id)
+			if err != nil {
+				return nil, err
+			}
+			a.files = append(a.files, fi)
+		}
+	case req.Path != "":
+		p := cleanPath(req.Path)
+		files, err := c.database.ListObjectsByPath(ctx, address, c.store.GetStoreType(ctx), p)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, notExist(nil)
+		}
+		if len(files) > maxArchiveFiles {
+			return nil, tooManyFiles()
+		}
+		a.files = files
+		if p != "/" {
+			a.Name = path.Base(p)
+			root = cleanPath(path.Dir(strings.TrimSuffix(p, "/")))
+		}
+	default:
+		lerr := logs.ControllerError{Message: "no object to archive"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	names := make(utils.ArchiveNames)
+	for _, fi := range a.files {
+		a.Size += fi.Size
+		a.names = append(a.names, names.Unique(strings.TrimPrefix(fi.Path, root)+fi.Name))
+	}
+	a.Name += "." + a.Format
+
+	ci, err := c.canRead(ctx, address, sign, uint64(a.Size))
+	if err != nil {
+		return nil, err
+	}
+	a.ci = ci
+
+	return a, nil
+}
+
+func tooManyFiles() error {
+	lerr := logs.ControllerError{Message: "an archive holds at most 10000 objects"}
+	logger.Error(lerr)
+	return lerr
+}
+
+// WriteArchive streams the objects of a into w, pulled one by one from the
+// storage. The traffic is charged once they are all written.
+func (c *Controller) WriteArchive(ctx context.Context, a *Archive, w io.Writer) error {
+	aw, err := utils.NewArchiveWriter(w, a.Format)
+	if err != nil {
+		return logs.ControllerError{Message: err.Error()}
+	}
+
+	for i, fi := range a.files {
+		ew, err := aw.Create(a.names[i], fi.Size, fi.ModTime)
+		if err != nil {
+			lerr := logs.ControllerError{Message: err.Error()}
+			logger.Error(lerr)
+			return lerr
+		}
+		err = envelope.GetObject(ctx, c.store, fi, ew, api.ObjectOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = aw.Close()
+	if err != nil {
+		lerr := logs.ControllerError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	err = c.datastore.Download(ctx, a.ci)
+	if err != nil {
+		return err
+	}
+	for _, fi := range a.files {
+		c.recordLedger(ctx, api.LedgerDownload, fi, fi.Size)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+const maxBatch = 1000
+
+const (
+	BatchDelete = "delete"
+	BatchMeta   = "meta"
+	BatchShare  = "share"
+)
+
+var errBatchFailed = errors.New("batch failed")
+
+// BatchRequest applies the operation Op to every object of IDs. The delete
+// and meta operations run in one database transaction, an object failing is
+// rolled back alone unless Atomic is set, which rolls back them all.
+type BatchRequest struct {
+	Op  string `json:"op"`
+	IDs []int  `json:"ids"`
+	// Patch is the change of the meta operation
+	Patch MetaPatch `json:"patch"`
+	// Expire is the lifetime in seconds of the links of the share
+	// operation, they never expire when it is 0
+	Expire int64 `json:"expire"`
+	Atomic bool  `json:"atomic"`
+}
+
+// ShareFunc makes the share link of a file, its lifetime in seconds
+type ShareFunc func(fi api.FileInfo, expire int64) (string, error)
+
+// BatchObjects applies the operation of req to its objects and reports the
+// result of each one, share makes the links of the share operation
+func (c *Controller) BatchObjects(ctx context.Context, address string, req BatchRequest, share ShareFunc) (BatchResult, error) {
+	result := BatchResult{Op: req.Op, Items: []BatchItemResult{}}
+	if len(req.IDs) == 0 || len(req.IDs) > maxBatch {
+		lerr := logs.ControllerError{Message: "a batch holds 1 to 1000 objects"}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	var do func(*Controller, int) error
+	switch req.Op {
+	case BatchDelete:
+		do = func(tc *Controller, id int) error {
+			return tc.DeleteObject(ctx, address, id)
+		}
+	case BatchMeta:
+		do = func(tc *Controller, id int) error {
+			_, err := tc.PatchObjectMeta(ctx, address, id, req.Patch)
+			return err
+		}
+	case BatchShare:
+		if share == nil {
+			break
+		}
+		// shares are kept outside the file database, they are made one by one
+		for _, id := range req.IDs {
+			item := BatchItemResult{ID: id}
+			fi, err := c.getOwnedObject(ctx, address, id)
+			if err == nil {
+				item.Link, err = share(fi, req.Expire)
+			}
+			result.add(item, err)
+		}
+		return result, nil
+	}
+	if do == nil {
+		lerr := logs.ControllerError{Message: "batch operation " + req.Op + " is not supported"}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	err := c.database.WithTransaction(ctx, func(db api.IDataBase) error {
+		for _, id := range req.IDs {
+			item := BatchItemResult{ID: id}
+			// every object runs in a nested transaction, a failed one
+			// leaves the others as they are
+			err := db.WithTransaction(ctx, func(db api.IDataBase) error {
+				tc := *c
+				tc.database = db
+				return do(&tc, id)
+			})
+			result.add(item, err)
+			if err != nil && req.Atomic {
+				return errBatchFailed
+			}
+		}
+		return nil
+	})
+	if err == errBatchFailed {
+		result.rollback()
+		return result, nil
+	}
+	if err != nil {
+		lerr := logs.DataBaseError{Message: err.Error()}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	return result, nil
+}
+
+func (r *BatchResult) add(item BatchItemResult, err error) {
+	if err != nil {
+		item.Error = err.Error()
+		r.Failed++
+	} else {
+		item.OK = true
+		r.Succeeded++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// rollback marks the objects done before an atomic batch failed as undone
+func (r *BatchResult) rollback() {
+	for i := range r.Items {
+		if r.Items[i].OK {
+			r.Items[i].OK = false
+			r.Items[i].Error = "rolled back"
+			r.Succeeded--
+			r.Failed++
+		}
+	}
+}
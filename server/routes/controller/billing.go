@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// recordPurchase records the space or traffic bought by address in the
+// confirmed transaction hash, the price is left out when it could not be
+// read. A transaction checked again is not recorded twice.
+func (c *Controller) recordPurchase(ctx context.Context, address, hash string) {
+	purchase, err := c.contract.GetPurchase(ctx, hash)
+	if err != nil || purchase.Kind == "" || purchase.Buyer != common.HexToAddress(address) {
+		return
+	}
+
+	var price uint64
+	if purchase.Kind == api.BillingBuySpace {
+		price, err = c.GetSpacePrice(ctx)
+	} else {
+		price, err = c.GetTrafficPrice(ctx)
+	}
+	entry := api.BillingEntry{
+		Address: address,
+		Kind:    purchase.Kind,
+		Size:    int64(purchase.Size),
+		TxHash:  hash,
+		Time:    time.Now(),
+	}
+	if err == nil {
+		entry.Price = strconv.FormatUint(price, 10)
+	}
+	err = c.database.AppendBilling(ctx, entry)
+	if err != nil {
+		logger.Error("record purchase error:", err)
+	}
+}
+
+// recordCash records the check of buyer cashed out by the transaction hash
+func (c *Controller) recordCash(ctx context.Context, kind api.BillingKind, buyer string, check api.CheckInfo, hash string) {
+	err := c.database.AppendBilling(ctx, api.BillingEntry{
+		Address: buyer,
+		Kind:    kind,
+		Size:    check.FileSize.Int64(),
+		Nonce:   check.Nonce.String(),
+		TxHash:  hash,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		logger.Error("record cash error:", err)
+	}
+}
+
+// Statements makes the statements of the period from from to before to, of
+// address or of every address with a purchase, a cash-out or a transfer in
+// the period when address is empty
+func (c *Controller) Statements(ctx context.Context, address string, from, to time.Time) ([]Statement, error) {
+	if !from.Before(to) {
+		lerr := logs.ControllerError{Message: "the period of a statement should end after it starts"}
+		logger.Error(lerr)
+		return nil, lerr
+	}
+
+	entries, err := c.database.ListBilling(ctx, address, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sums, err := c.database.SumLedger(ctx, api.LedgerQuery{
+		Address:   address,
+		From:      from,
+		To:        to,
+		Period:    "month",
+		ByAddress: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make(map[string]*Statement)
+	get := func(address string) *Statement {
+		s, ok := statements[address]
+		if !ok {
+			s = &Statement{Address: address, From: from, To: to}
+			statements[address] = s
+		}
+		return s
+	}
+	if address != "" {
+		get(address)
+	}
+
+	for _, e := range entries {
+		s := get(e.Address)
+		s.Entries = append(s.Entries, e)
+		switch e.Kind {
+		case api.BillingBuySpace:
+			s.BoughtSpace += e.Size
+		case api.BillingBuyTraffic:
+			s.BoughtTraffic += e.Size
+		case api.BillingCashSpace:
+			s.CashedSpace += e.Size
+		case api.BillingCashTraffic:
+			s.CashedTraffic += e.Size
+		}
+	}
+	for _, sum := range sums {
+		s := get(sum.Address)
+		switch sum.Kind {
+		case api.LedgerUpload:
+			s.Uploaded += sum.Bytes
+		case api.LedgerDownload:
+			s.Downloaded += sum.Bytes
+		case api.LedgerShare:
+			s.Shared += sum.Bytes
+		}
+	}
+
+	result := make([]Statement, 0, len(statements))
+	for _, s := range statements {
+		space, err := c.datastore.GetSpaceInfo(ctx, s.Address)
+		if err != nil {
+			return nil, err
+		}
+		traffic, err := c.datastore.GetTrafficInfo(ctx, s.Address)
+		if err != nil {
+			return nil, err
+		}
+		s.PendingSpace = space.FileSize.Int64()
+		s.PendingTraffic = traffic.FileSize.Int64()
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Address < result[j].Address
+	})
+	return result, nil
+}
+
+var statementHeader = []string{
+	"address", "from", "to",
+	"bought_space", "bought_traffic", "cashed_space", "cashed_traffic",
+	"pending_space", "pending_traffic", "uploaded", "downloaded", "shared",
+}
+
+// WriteStatementsCSV writes a line of totals for each statement, the entries
+// are only in the json form
+func WriteStatementsCSV(w io.Writer, statements []Statement) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write(statementHeader)
+	if err != nil {
+		return err
+	}
+	for _, s := range statements {
+		record := []string{s.Address, s.From.UTC().Format(time.RFC3339), s.To.UTC().Format(time.RFC3339)}
+		for _, v := range []int64{
+			s.BoughtSpace, s.BoughtTraffic, s.CashedSpace, s.CashedTraffic,
+			s.PendingSpace, s.PendingTraffic, s.Uploaded, s.Downloaded, s.Shared,
+		} {
+			record = append(record, strconv.FormatInt(v, 10))
+		}
+		err = cw.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"math/big"
@@ -10,6 +12,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/envelope"
 	"github.com/memoio/backend/internal/logs"
 	"github.com/memoio/backend/utils"
 )
@@ -18,56 +21,183 @@ func (c *Controller) SetStore(store api.IGateway) {
 	c.store = store
 }
 
+// WithStore returns a controller working on store, for the callers that do
+// not set the store of the request, such as the s3 front-end
+func (c *Controller) WithStore(store api.IGateway) *Controller {
+	cc := *c
+	cc.store = store
+	return &cc
+}
+
 func (c *Controller) GetStorage(ctx context.Context) api.StorageType {
 	return c.store.GetStoreType(ctx)
 }
 
 func (c *Controller) PutObject(ctx context.Context, address, object string, r io.Reader, opts ObjectOptions) (PutObjectResult, error) {
-	result := PutObjectResult{}
 	ci, err := c.canWrite(ctx, address, opts.Sign, uint64(opts.Size))
+	if err != nil {
+		return PutObjectResult{}, err
+	}
+
+	return c.putObject(ctx, address, object, r, opts, ci)
+}
+
+// putObject stores an object whose space check ci is already verified
+func (c *Controller) putObject(ctx context.Context, address, object string, r io.Reader, opts ObjectOptions, ci api.CheckInfo) (PutObjectResult, error) {
+	result := PutObjectResult{}
+
+	folder, name, err := splitObject(opts.Path, object)
+	if err != nil {
+		return result, err
+	}
+	err = checkMeta(opts.UserDefined, opts.Tags)
+	if err != nil {
+		return result, err
+	}
+	err = c.checkEncrypt(opts)
 	if err != nil {
 		return result, err
 	}
 
 	if opts.Area != "" {
-		err = c.changeStore(ctx, opts.Area)
+		err := c.changeStore(ctx, opts.Area)
 		if err != nil {
 			return result, err
 		}
 	}
 
-	oi, err := c.store.PutObject(ctx, address, object, r, api.ObjectOptions(opts))
+	key, err := c.uniqueKey(ctx, address, objectKey(folder, name))
 	if err != nil {
 		return result, err
 	}
 
-	userdefine, err := json.Marshal(oi.UserDefined)
+	// the type is sniffed from the first bytes, the media info is read from
+	// the head of the plaintext as it is stored
+	br := bufio.NewReaderSize(r, utils.SniffSize)
+	sniff, _ := br.Peek(utils.SniffSize)
+	ctype := opts.UserDefined["content-type"]
+	if ctype == "" {
+		ctype = utils.DetectContentType(sniff, name)
+		// the storage only sees the ciphertext of an encrypted file
+		if !opts.Encrypt {
+			meta := make(map[string]string, len(opts.UserDefined)+1)
+			for k, v := range opts.UserDefined {
+				meta[k] = v
+			}
+			meta["content-type"] = ctype
+			opts.UserDefined = meta
+		}
+	}
+	head := utils.NewHeadReader(br, utils.MediaHeadSize)
+	r = head
+
+	var sealed *envelope.Reader
+	var dataKey, ownerKey string
+	if opts.Encrypt {
+		sealed, dataKey, ownerKey, err = sealObject(r, opts.OwnerKey)
+		if err != nil {
+			return result, err
+		}
+		r = sealed
+		opts.Size = envelope.SealedSize(opts.Size)
+	}
+
+	oi, content, err := c.writeObject(ctx, address, key, r, opts)
 	if err != nil {
 		return result, err
 	}
+	if content != nil && content.ID != 0 {
+		key = content.ObjectKey
+	}
 
-	fi := api.FileInfo{
-		Address:    address,
-		Name:       object,
-		Mid:        oi.Cid,
-		SType:      oi.SType,
-		Size:       oi.Size,
-		ModTime:    oi.ModTime,
-		UserID:     oi.USerID,
-		UserDefine: string(userdefine),
+	meta := oi.UserDefined
+	if meta == nil {
+		meta = opts.UserDefined
+	}
+	userdefine, err := joinUserDefine(meta, opts.Tags)
+	if err != nil {
+		return result, err
 	}
 
-	err = c.storeFileInfo(ctx, fi, ci)
+	fi := api.FileInfo{
+		Address:     address,
+		Name:        name,
+		Path:        folder,
+		ObjectKey:   key,
+		ContentType: ctype,
+		Mid:         oi.Cid,
+		SType:       oi.SType,
+		Size:        oi.Size,
+		ModTime:     oi.ModTime,
+		UserID:      oi.USerID,
+		UserDefine:  userdefine,
+	}
+	// the size of an encrypted file is the size of its plaintext
+	if sealed != nil {
+		fi.Size = sealed.Size()
+		fi.DataKey = dataKey
+		fi.OwnerKey = ownerKey
+	}
+	media := utils.ParseMediaInfo(ctype, head.Head(), fi.Size)
+	fi.Width, fi.Height = media.Width, media.Height
+	fi.Taken, fi.Duration = media.Taken, media.Duration
+
+	restored, err := c.recordObject(ctx, fi, oi.Replicas, content, ci)
+	// a shared content is kept for its other files
+	if (err != nil || restored) && (content == nil || content.ID == 0) {
+		c.releaseObject(ctx, c.store, address, key, oi.Cid)
+	}
 	if err != nil {
-		c.store.DeleteObject(ctx, address, oi.Name)
 		return result, err
 	}
+	if !restored && content != nil && content.ID == 0 {
+		c.releaseDuplicate(ctx, *content)
+	}
+
+	// the folders of a file are listed even once it is deleted
+	err = c.makeFolders(ctx, address, folder)
+	if err != nil {
+		logger.Error("make folders error:", err)
+	}
+
+	current, err := c.database.GetCurrentObject(ctx, address, fi.SType, folder, name)
+	if err == nil {
+		c.recordLedger(ctx, api.LedgerUpload, current, current.Size)
+		// thumbnails and previews are made in the background as well
+		if !restored {
+			c.queueDerivatives(ctx, current)
+		}
+	}
+
+	// remote pins are made in the background, the upload does not wait
+	if _, ok := api.Pinner(c.store); ok && !restored {
+		err = c.pinning.Enqueue(ctx, oi.Cid, name)
+		if err != nil {
+			logger.Error("enqueue remote pin error:", err)
+		}
+	}
 
 	result.Mid = oi.Cid
 
 	return result, nil
 }
 
+// GetObjectInfo returns what a download response needs to know before the
+// content is streamed
+func (c *Controller) GetObjectInfo(ctx context.Context, address, mid string) (GetObjectResult, error) {
+	ob, err := c.getObjectInfo(ctx, address, mid)
+	if err != nil {
+		return GetObjectResult{}, err
+	}
+
+	return GetObjectResult{
+		Name:    ob.Name,
+		Size:    ob.Size,
+		CType:   utils.FileContentType(ob),
+		ModTime: ob.ModTime,
+	}, nil
+}
+
 func (c *Controller) GetObject(ctx context.Context, address, mid string, w io.Writer, opts ObjectOptions) (GetObjectResult, error) {
 	result := GetObjectResult{}
 
@@ -76,64 +206,205 @@ func (c *Controller) GetObject(ctx context.Context, address, mid string, w io.Wr
 		return result, err
 	}
 
-	ci, err := c.canRead(ctx, address, opts.Sign, uint64(ob.Size))
+	// only the bytes served are charged
+	size := ob.Size
+	if opts.Length > 0 {
+		size = opts.Length
+	}
+
+	ci, err := c.canRead(ctx, address, opts.Sign, uint64(size))
 	if err != nil {
 		return result, err
 	}
 
-	err = c.store.GetObject(ctx, mid, w, api.ObjectOptions(opts))
+	err = envelope.GetObject(ctx, c.store, ob, w, api.ObjectOptions(opts))
 	if err != nil {
 		return result, err
 	}
 
 	result.Name = ob.Name
-	result.CType = utils.TypeByExtension(ob.Name)
-	result.Size = ob.Size
+	result.CType = utils.FileContentType(ob)
+	result.Size = size
+	result.ModTime = ob.ModTime
 
 	err = c.datastore.Download(ctx, ci)
 	if err != nil {
 		return result, err
 	}
+	c.recordLedger(ctx, api.LedgerDownload, ob, size)
 
 	return result, nil
 }
 
-func (c *Controller) ListObjects(ctx context.Context, address string) (ListObjectsResult, error) {
+// ListObjects lists a page of the objects of address, the prefix and
+// delimiter work as in s3 on the path of the objects without its leading slash
+func (c *Controller) ListObjects(ctx context.Context, address string, opts ListObjectsOptions) (ListObjectsResult, error) {
 	result := ListObjectsResult{}
 
 	st := c.store.GetStoreType(ctx)
-	loi, err := c.database.ListObjects(ctx, address, st)
+	result.Address = address
+	result.Storage = st.String()
+	result.Prefix = opts.Prefix
+	result.Delimiter = opts.Delimiter
+
+	lo := api.ListOptions{
+		Prefix:       strings.TrimPrefix(opts.Prefix, "/"),
+		Delimiter:    opts.Delimiter,
+		NameContains: opts.NameContains,
+		ContentType:  opts.ContentType,
+		Public:       opts.Public,
+		MinSize:      opts.MinSize,
+		MaxSize:      opts.MaxSize,
+		MinWidth:     opts.MinWidth,
+		MinHeight:    opts.MinHeight,
+		MinDuration:  opts.MinDuration,
+		MaxDuration:  opts.MaxDuration,
+		TakenAfter:   opts.TakenAfter,
+		TakenBefore:  opts.TakenBefore,
+		Tags:         opts.Tags,
+		Sort:         opts.Sort,
+		Desc:         opts.Desc,
+		Limit:        opts.Limit,
+	}
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return result, err
+		}
+		lo.After = &after
+	}
+	// one more object tells if there is a next page
+	if lo.Limit > 0 {
+		lo.Limit++
+	}
+
+	files, total, err := c.database.ListObjectsPage(ctx, address, st, lo)
 	if err != nil {
 		return result, err
 	}
+	result.Total = total
 
-	result.Address = address
-	result.Storage = st.String()
+	if opts.Limit > 0 && len(files) > opts.Limit {
+		files = files[:opts.Limit]
+		last := files[len(files)-1]
+		result.NextCursor = encodeCursor(api.Cursor{ID: last.ID, Name: last.Name, Size: last.Size, ModTime: last.ModTime})
+	}
+
+	if opts.Delimiter != "" && opts.Cursor == "" {
+		result.CommonPrefixes, err = c.database.ListCommonPrefixes(ctx, address, st, lo.Prefix, opts.Delimiter)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Objects, err = c.toObjectInfoResults(ctx, files)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func encodeCursor(cur api.Cursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (api.Cursor, error) {
+	var cur api.Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &cur)
+	}
+	if err != nil {
+		lerr := logs.ControllerError{Message: "invalid cursor"}
+		logger.Error(lerr)
+		return cur, lerr
+	}
+	return cur, nil
+}
+
+// toObjectInfoResults adds the replicas and remote pins of the files
+func (c *Controller) toObjectInfoResults(ctx context.Context, files []api.FileInfo) ([]ObjectInfoResult, error) {
+	ids := make([]int, 0, len(files))
+	mids := make([]string, 0, len(files))
+	for _, fi := range files {
+		ids = append(ids, fi.ID)
+		mids = append(mids, fi.Mid)
+	}
+	replicas, err := c.database.ListObjectReplicas(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	remotePins, err := c.pinning.Status(ctx, mids)
+	if err != nil {
+		return nil, err
+	}
+
+	replicaMap := make(map[int][]ReplicaResult)
+	for _, r := range replicas {
+		replicaMap[r.FileID] = append(replicaMap[r.FileID], ReplicaResult{
+			Backend: r.Backend,
+			Storage: r.SType.String(),
+			Mid:     r.Mid,
+			Primary: r.Primary,
+			Status:  string(r.Status),
+			ModTime: r.ModTime,
+		})
+	}
+
+	derivatives, err := c.database.ListDerivatives(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	derivedMap := make(map[int][]string)
+	for _, d := range derivatives {
+		if d.Status == api.DerivativeDone {
+			derivedMap[d.FileID] = append(derivedMap[d.FileID], d.Kind)
+		}
+	}
 
-	for _, ioi := range loi {
-		// userdefine := make(map[string]string)
-		oi := ioi.(api.FileInfo)
-		// err = json.Unmarshal([]byte(oi.UserDefine), &userdefine)
-		// if err != nil {
-		// 	lerr := logs.ControllerError{Message: fmt.Sprint("unmarshal userdefine error, ", err)}
-		// 	logger.Error(lerr)
-		// 	return result, lerr
-		// }
-
-		result.Objects = append(result.Objects, ObjectInfoResult{
-			ID:      oi.ID,
-			Name:    oi.Name,
-			Size:    oi.Size,
-			Mid:     oi.Mid,
-			ModTime: oi.ModTime,
-			Public:  oi.Public,
-			// UserDefined: userdefine,
+	result := make([]ObjectInfoResult, 0, len(files))
+	for _, oi := range files {
+		meta, tags := splitUserDefine(oi.UserDefine)
+		result = append(result, ObjectInfoResult{
+			ID:          oi.ID,
+			Name:        oi.Name,
+			Path:        oi.Path,
+			Size:        oi.Size,
+			Mid:         oi.Mid,
+			Version:     oi.Version,
+			ContentType: oi.ContentType,
+			ModTime:     oi.ModTime,
+			Public:      oi.Public,
+			Encrypted:   oi.DataKey != "",
+			OwnerKey:    oi.OwnerKey,
+			Derived:     derivedMap[oi.ID],
+			Media:       toMediaResult(oi),
+			UserDefined: meta,
+			Tags:        tags,
+			Replicas:    replicaMap[oi.ID],
+			RemotePins:  toRemotePinResults(remotePins[oi.Mid]),
 		})
 	}
 
 	return result, nil
 }
 
+func toMediaResult(fi api.FileInfo) *MediaResult {
+	if fi.Width == 0 && fi.Height == 0 && fi.Duration == 0 {
+		return nil
+	}
+	return &MediaResult{
+		Width:    fi.Width,
+		Height:   fi.Height,
+		Taken:    fi.Taken,
+		Duration: fi.Duration,
+	}
+}
+
+// DeleteObject moves the object id into the trash, it is purged from the
+// storage once the trash retention is over
 func (c *Controller) DeleteObject(ctx context.Context, address string, id int) error {
 	oi, err := c.getObjectInfoById(ctx, id)
 	if err != nil {
@@ -146,15 +417,7 @@ func (c *Controller) DeleteObject(ctx context.Context, address string, id int) e
 		return lerr
 	}
 
-	err = c.store.DeleteObject(ctx, address, oi.Name)
-	if err != nil {
-		if strings.Contains(err.Error(), "not exist") {
-			return c.database.DeleteObject(ctx, id)
-		}
-		return err
-	}
-
-	return c.database.DeleteObject(ctx, id)
+	return c.database.TrashObject(ctx, id)
 }
 
 func (c *Controller) GetSpaceCheckHash(ctx context.Context, address string, size uint64) (api.Check, error) {
@@ -175,6 +438,23 @@ func (c *Controller) GetTrafficCheckHash(ctx context.Context, address string, si
 	return c.contract.GetTrafficCheckHash(ctx, ci.FileSize.Uint64(), ci.Nonce), nil
 }
 
+// QuotaCheck fails if address has not bought size more bytes of space,
+// nothing is charged
+func (c *Controller) QuotaCheck(ctx context.Context, address string, size uint64) error {
+	_, err := c.getSpaceCheckInfo(ctx, address, size)
+	return err
+}
+
+// ReadCheck verifies the traffic check of size more bytes signed by address
+func (c *Controller) ReadCheck(ctx context.Context, address, sign string, size uint64) (api.CheckInfo, error) {
+	return c.canRead(ctx, address, sign, size)
+}
+
+// ChargeTraffic records the traffic check of a served object
+func (c *Controller) ChargeTraffic(ctx context.Context, ci api.CheckInfo) error {
+	return c.datastore.Download(ctx, ci)
+}
+
 func (c *Controller) GetSpacePrice(ctx context.Context) (uint64, error) {
 	out, err := c.contract.Call(ctx, "proxy", "spacePrice")
 	if err != nil {
@@ -246,7 +526,12 @@ func (c *Controller) CashSpace(ctx context.Context, buyer string) (string, error
 	if err != nil {
 		return "", err
 	}
-	return c.contract.CashSpaceCheck(ctx, check)
+	hash, err := c.contract.CashSpaceCheck(ctx, check)
+	if err != nil {
+		return "", err
+	}
+	c.recordCash(ctx, api.BillingCashSpace, buyer, check, hash)
+	return hash, nil
 }
 
 func (c *Controller) CashTraffic(ctx context.Context, buyer string) (string, error) {
@@ -258,13 +543,25 @@ func (c *Controller) CashTraffic(ctx context.Context, buyer string) (string, err
 	if err != nil {
 		return "", err
 	}
-	return c.contract.CashTrafficCheck(ctx, check)
+	hash, err := c.contract.CashTrafficCheck(ctx, check)
+	if err != nil {
+		return "", err
+	}
+	c.recordCash(ctx, api.BillingCashTraffic, buyer, check, hash)
+	return hash, nil
 }
 
 func (c *Controller) Allowance(ctx context.Context, pt api.PayType, address string) (*big.Int, error) {
 	return c.contract.Allowance(ctx, pt, address)
 }
 
-func (c *Controller) CheckReceipt(ctx context.Context, receipt string) error {
-	return c.contract.CheckTrsaction(ctx, receipt)
+// CheckReceipt checks the transaction receipt of address succeeded, a
+// purchase is recorded once confirmed
+func (c *Controller) CheckReceipt(ctx context.Context, address, receipt string) error {
+	err := c.contract.CheckTrsaction(ctx, receipt)
+	if err != nil {
+		return err
+	}
+	c.recordPurchase(ctx, address, receipt)
+	return nil
 }
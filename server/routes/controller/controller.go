@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/memoio/backend/api"
 	"github.com/memoio/backend/config"
 	"github.com/memoio/backend/internal/contract"
@@ -8,6 +10,7 @@ import (
 	"github.com/memoio/backend/internal/datastore"
 	"github.com/memoio/backend/internal/kzg"
 	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/internal/pinning"
 )
 
 var logger = logs.Logger("controller")
@@ -18,6 +21,14 @@ type Controller struct {
 	database  api.IDataBase
 	datastore api.IDataStore
 	publickey api.IPublicKey
+	pinning   *pinning.Service
+	// retention is how long the deleted files are kept in the trash
+	retention  time.Duration
+	versioning config.VersioningConfig
+	encryption config.EncryptionConfig
+	thumbnail  config.ThumbnailConfig
+	// derive wakes the pipeline making the derivatives
+	derive chan struct{}
 }
 
 func NewController() (*Controller, error) {
@@ -37,9 +48,15 @@ func NewController() (*Controller, error) {
 		return nil, err
 	}
 	return &Controller{
-		contract:  contract,
-		database:  database,
-		datastore: datastore, // datastore used by cashcheck
-		publickey: publickey,
+		contract:   contract,
+		database:   database,
+		datastore:  datastore, // datastore used by cashcheck
+		publickey:  publickey,
+		pinning:    pinning.NewService(database.DB, config.Cfg.Storage.Ipfs),
+		retention:  trashRetention(config.Cfg.Storage.Trash),
+		versioning: config.Cfg.Storage.Versioning,
+		encryption: config.Cfg.Storage.Encryption,
+		thumbnail:  config.Cfg.Storage.Thumbnail,
+		derive:     make(chan struct{}, 1),
 	}, nil
 }
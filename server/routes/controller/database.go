@@ -5,6 +5,7 @@ import (
 
 	"github.com/memoio/backend/api"
 	"github.com/memoio/backend/internal/gateway/mefs"
+	"github.com/memoio/backend/internal/gateway/replica"
 	"github.com/memoio/backend/internal/logs"
 )
 
@@ -36,16 +37,31 @@ func (c *Controller) changeStore(ctx context.Context, area string) error {
 			return err
 		}
 
+		// a replicated upload keeps its policy in the other area
+		if rs, ok := c.store.(*replica.Replica); ok {
+			c.store = rs.WithPrimary(store, area)
+			return nil
+		}
 		c.store = store
 	}
 
 	return nil
 }
 
-func (c *Controller) storeFileInfo(ctx context.Context, fi api.FileInfo, ci api.CheckInfo) error {
-	err := c.datastore.Upload(ctx, ci)
-	if err != nil {
-		return err
+// storeFileInfo charges the space of a new file and records it, an empty
+// file or one sharing a content already stored is not charged
+func (c *Controller) storeFileInfo(ctx context.Context, fi api.FileInfo, replicas []api.ObjectReplica, content *api.Content, ci api.CheckInfo) error {
+	if (content == nil || content.ID == 0) && fi.Size > 0 {
+		err := c.datastore.Upload(ctx, ci)
+		if err != nil {
+			return err
+		}
+	}
+	if content != nil {
+		return c.database.PutObjectContent(ctx, fi, replicas, *content)
+	}
+	if len(replicas) > 0 {
+		return c.database.PutObjectReplicas(ctx, fi, replicas)
 	}
 	return c.database.PutObject(ctx, fi)
 }
@@ -66,3 +82,26 @@ func (c *Controller) getObjectInfo(ctx context.Context, address, mid string) (ap
 	}
 	return fi, nil
 }
+
+// releaseObject deletes an object of store no longer recorded, the cid of a
+// pinning store is unpinned when no file of any address refers to it anymore
+func (c *Controller) releaseObject(ctx context.Context, store api.IGateway, address, name, mid string) error {
+	p, ok := api.Pinner(store)
+	if !ok {
+		return store.DeleteObject(ctx, address, name)
+	}
+
+	count, err := c.database.CountObjectsByMid(ctx, store.GetStoreType(ctx), mid)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	err = c.pinning.Remove(ctx, mid)
+	if err != nil {
+		return err
+	}
+	return p.Unpin(ctx, mid)
+}
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/memoio/backend/api"
+)
+
+// writeObject puts the object on the store and hashes it on the way, an
+// object whose content the store already holds is deleted again and the
+// content is shared. The content returned has an ID when it was found, none
+// when the object written holds it. Pinning stores are content addressed
+// already and encrypted objects never share their content, no content is
+// returned for them.
+func (c *Controller) writeObject(ctx context.Context, address, key string, r io.Reader, opts ObjectOptions) (api.ObjectInfo, *api.Content, error) {
+	if _, ok := api.Pinner(c.store); ok || opts.Encrypt {
+		oi, err := c.store.PutObject(ctx, address, key, r, api.ObjectOptions(opts))
+		return oi, nil, err
+	}
+
+	h := sha256.New()
+	oi, err := c.store.PutObject(ctx, address, key, io.TeeReader(r, h), api.ObjectOptions(opts))
+	if err != nil {
+		return oi, nil, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	st := c.store.GetStoreType(ctx)
+	content, err := c.database.GetContent(ctx, st, hash)
+	if err != nil {
+		c.store.DeleteObject(ctx, address, key)
+		return api.ObjectInfo{}, nil, err
+	}
+	if content.ID != 0 && content.Area != opts.Area {
+		// the content of the other area stays the shared one
+		return oi, nil, nil
+	}
+	if content.ID == 0 {
+		return oi, &api.Content{
+			SType:     oi.SType,
+			Hash:      hash,
+			Area:      opts.Area,
+			Mid:       oi.Cid,
+			Address:   address,
+			ObjectKey: key,
+			Size:      oi.Size,
+			Created:   time.Now(),
+		}, nil
+	}
+
+	replicas, err := c.database.ListObjectReplicasByMid(ctx, st, content.Mid)
+	if err != nil {
+		c.store.DeleteObject(ctx, address, key)
+		return api.ObjectInfo{}, nil, err
+	}
+	err = c.store.DeleteObject(ctx, address, key)
+	if err != nil {
+		logger.Errorf("delete duplicate %s/%s: %s", address, key, err)
+	}
+	return api.ObjectInfo{
+		SType:       st,
+		Bucket:      content.Address,
+		Name:        content.ObjectKey,
+		Size:        content.Size,
+		Cid:         content.Mid,
+		ModTime:     time.Now(),
+		UserDefined: opts.UserDefined,
+		Replicas:    replicas,
+	}, &content, nil
+}
+
+// releaseDuplicate deletes the object written for content when the same
+// content was recorded by another upload meanwhile, the file refers to that
+// one instead
+func (c *Controller) releaseDuplicate(ctx context.Context, content api.Content) {
+	shared, err := c.database.GetContent(ctx, content.SType, content.Hash)
+	if err != nil || shared.ID == 0 || shared.Area != content.Area || shared.ObjectKey == content.ObjectKey {
+		return
+	}
+	err = c.store.DeleteObject(ctx, content.Address, content.ObjectKey)
+	if err != nil {
+		logger.Errorf("delete duplicate %s/%s: %s", content.Address, content.ObjectKey, err)
+	}
+}
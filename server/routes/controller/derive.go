@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/envelope"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+)
+
+const (
+	DerivedThumbnail = "thumbnail"
+	DerivedPreview   = "preview"
+)
+
+const (
+	derivePoll     = time.Minute
+	deriveBatch    = 20
+	deriveAttempts = 3
+	previewSize    = 4 << 10
+)
+
+// derivedKinds are the derivatives made of a file of its content type
+func derivedKinds(fi api.FileInfo) []string {
+	ctype := utils.FileContentType(fi)
+	switch {
+	case ctype == "image/jpeg" || ctype == "image/png" || ctype == "image/gif":
+		return []string{DerivedThumbnail}
+	case strings.HasPrefix(ctype, "text/"):
+		return []string{DerivedPreview}
+	}
+	return nil
+}
+
+// queueDerivatives records the derivatives to make of fi, they are made by
+// the running pipeline. Encrypted files are left out, their derivatives
+// would be stored in plaintext.
+func (c *Controller) queueDerivatives(ctx context.Context, fi api.FileInfo) {
+	if !c.thumbnail.Enable || fi.DataKey != "" {
+		return
+	}
+
+	now := time.Now()
+	var derivatives []api.Derivative
+	for _, kind := range derivedKinds(fi) {
+		derivatives = append(derivatives, api.Derivative{
+			FileID:  fi.ID,
+			Kind:    kind,
+			Address: fi.Address,
+			SType:   fi.SType,
+			Status:  api.DerivativeQueued,
+			Created: now,
+			Updated: now,
+		})
+	}
+	if len(derivatives) == 0 {
+		return
+	}
+
+	err := c.database.QueueDerivatives(ctx, derivatives)
+	if err != nil {
+		logger.Error("queue derivatives error:", err)
+		return
+	}
+	select {
+	case c.derive <- struct{}{}:
+	default:
+	}
+}
+
+// ProcessDerivatives makes the derivatives queued, the stores of their
+// storage are given by resolve. It returns the number handled.
+func (c *Controller) ProcessDerivatives(ctx context.Context, resolve func(api.StorageType) (api.IGateway, error)) int {
+	stores := make(map[api.StorageType]api.IGateway)
+	handled, after := 0, 0
+	for ctx.Err() == nil {
+		derivatives, err := c.database.ListQueuedDerivatives(ctx, after, deriveBatch)
+		if err != nil || len(derivatives) == 0 {
+			return handled
+		}
+		after = derivatives[len(derivatives)-1].ID
+
+		for _, d := range derivatives {
+			if ctx.Err() != nil {
+				return handled
+			}
+			store, ok := stores[d.SType]
+			if !ok {
+				store, err = resolve(d.SType)
+				if err != nil {
+					logger.Errorf("derive on %s: %s", d.SType, err)
+				}
+				stores[d.SType] = store
+			}
+
+			err = nil
+			if store == nil {
+				err = fmt.Errorf("storage %s is not available", d.SType)
+			} else {
+				d, err = c.makeDerivative(ctx, store, d)
+			}
+			d.Attempts++
+			d.Updated = time.Now()
+			if err != nil {
+				d.Error = err.Error()
+				// the storage may come back, it is tried again on the
+				// next run
+				if d.Attempts >= deriveAttempts {
+					d.Status = api.DerivativeFailed
+				}
+			}
+			err = c.database.UpdateDerivative(ctx, d)
+			if err != nil {
+				return handled
+			}
+			handled++
+		}
+	}
+	return handled
+}
+
+// makeDerivative makes d of its file and stores it, a file it can not be
+// made of leaves d skipped. The error is a failure of the storage.
+func (c *Controller) makeDerivative(ctx context.Context, store api.IGateway, d api.Derivative) (api.Derivative, error) {
+	fi, err := c.getObjectInfoById(ctx, d.FileID)
+	if err != nil {
+		return skipDerivative(d, "file is deleted"), nil
+	}
+	// a preview only reads the start of the file
+	opts := api.ObjectOptions{}
+	if d.Kind == DerivedPreview {
+		opts.Length = previewSize
+	} else if fi.Size > c.thumbnail.MaxSize {
+		return skipDerivative(d, "file is too large"), nil
+	}
+	var buf bytes.Buffer
+	err = envelope.GetObject(ctx, store, fi, &buf, opts)
+	if err != nil {
+		return d, err
+	}
+
+	var data []byte
+	switch d.Kind {
+	case DerivedThumbnail:
+		data, err = utils.Thumbnail(buf.Bytes(), c.thumbnail.Size)
+		if err != nil {
+			return skipDerivative(d, err.Error()), nil
+		}
+		d.ContentType = "image/jpeg"
+	case DerivedPreview:
+		data = utils.TextPreview(buf.Bytes(), previewSize)
+		if len(data) == 0 {
+			return skipDerivative(d, "file is not text"), nil
+		}
+		d.ContentType = "text/plain; charset=utf-8"
+	default:
+		return skipDerivative(d, "unknown derivative"), nil
+	}
+
+	d.ObjectKey = fmt.Sprintf(".derived/%d/%s", d.FileID, d.Kind)
+	oi, err := store.PutObject(ctx, d.Address, d.ObjectKey, bytes.NewReader(data), api.ObjectOptions{
+		Size:        int64(len(data)),
+		UserDefined: map[string]string{"content-type": d.ContentType},
+	})
+	if err != nil {
+		return d, err
+	}
+
+	d.Mid = oi.Cid
+	d.Size = int64(len(data))
+	d.Status = api.DerivativeDone
+	d.Error = ""
+	return d, nil
+}
+
+func skipDerivative(d api.Derivative, reason string) api.Derivative {
+	d.Status = api.DerivativeSkipped
+	d.Error = reason
+	return d
+}
+
+// StartDerivatives makes the derivatives as they are queued, and checks the
+// queue every minute for the ones to try again. It stops with ctx.
+func (c *Controller) StartDerivatives(ctx context.Context, resolve func(api.StorageType) (api.IGateway, error)) {
+	go func() {
+		ticker := time.NewTicker(derivePoll)
+		defer ticker.Stop()
+		for {
+			c.ProcessDerivatives(ctx, resolve)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-c.derive:
+			}
+		}
+	}()
+}
+
+// GetDerivative returns the derivative kind of the object id of address
+func (c *Controller) GetDerivative(ctx context.Context, address string, id int, kind string) (api.Derivative, error) {
+	_, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return api.Derivative{}, err
+	}
+
+	d, err := c.database.GetDerivative(ctx, id, kind)
+	if err != nil {
+		return d, err
+	}
+	switch d.Status {
+	case api.DerivativeDone:
+		return d, nil
+	case api.DerivativeQueued:
+		lerr := logs.ControllerError{Message: "the " + kind + " is not made yet"}
+		logger.Error(lerr)
+		return d, lerr
+	default:
+		lerr := logs.ControllerError{Message: "the object has no " + kind}
+		logger.Error(lerr)
+		return d, lerr
+	}
+}
+
+// WriteDerivative streams the derivative d into w, it is not charged to the
+// traffic of the owner
+func (c *Controller) WriteDerivative(ctx context.Context, d api.Derivative, w io.Writer) error {
+	return c.store.GetObject(ctx, d.Mid, w, api.ObjectOptions{})
+}
+
+// deleteDerivatives deletes the derivatives of the file id from store
+func (c *Controller) deleteDerivatives(ctx context.Context, store api.IGateway, id int) {
+	derivatives, err := c.database.DeleteDerivatives(ctx, id)
+	if err != nil {
+		return
+	}
+
+	for _, d := range derivatives {
+		if d.Mid == "" {
+			continue
+		}
+		// derivatives of the same content are the same object on a
+		// pinning store
+		if _, ok := api.Pinner(store); ok {
+			count, err := c.database.CountDerivativesByMid(ctx, d.SType, d.Mid)
+			if err != nil || count > 0 {
+				continue
+			}
+		}
+		err = c.releaseObject(ctx, store, d.Address, d.ObjectKey, d.Mid)
+		if err != nil && !strings.Contains(err.Error(), "not exist") {
+			logger.Errorf("delete %s of file %d: %s", d.Kind, id, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"io"
+
+	"github.com/memoio/backend/internal/envelope"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// EncryptByDefault tells whether the objects are encrypted when the put does
+// not ask for it
+func (c *Controller) EncryptByDefault() bool {
+	return c.encryption.Enable && c.encryption.Default
+}
+
+// checkEncrypt verifies an encrypted put can be made, before anything is
+// stored
+func (c *Controller) checkEncrypt(opts ObjectOptions) error {
+	if !opts.Encrypt {
+		return nil
+	}
+	if !c.encryption.Enable {
+		lerr := logs.ControllerError{Message: "encryption is not enabled"}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	_, err := envelope.ParsePublicKey(opts.OwnerKey)
+	if err != nil {
+		lerr := logs.ControllerError{Message: "no public key of the owner to encrypt to: " + err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	_, err = envelope.MasterKey()
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// sealObject encrypts r with a new data key, it returns the key sealed by
+// the master key and wrapped to the owner key
+func sealObject(r io.Reader, owner string) (*envelope.Reader, string, string, error) {
+	pub, err := envelope.ParsePublicKey(owner)
+	if err != nil {
+		return nil, "", "", logs.ControllerError{Message: err.Error()}
+	}
+	mk, err := envelope.MasterKey()
+	if err != nil {
+		return nil, "", "", logs.ServerError{Message: err.Error()}
+	}
+
+	key, err := envelope.NewKey()
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, "", "", lerr
+	}
+	dataKey, err := envelope.SealKey(mk, key)
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, "", "", lerr
+	}
+	ownerKey, err := envelope.WrapKey(pub, key)
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, "", "", lerr
+	}
+
+	sealed, err := envelope.NewReader(r, key)
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return nil, "", "", lerr
+	}
+	return sealed, dataKey, ownerKey, nil
+}
@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/utils"
+)
+
+// cleanPath returns p as an absolute folder path ending with a slash
+func cleanPath(p string) string {
+	return utils.CleanPath(p)
+}
+
+// splitObject puts the folders an object name holds into its folder
+func splitObject(folder, object string) (string, string, error) {
+	folder, name, ok := utils.SplitObject(folder, object)
+	if !ok {
+		lerr := logs.ControllerError{Message: "object name is not valid"}
+		logger.Error(lerr)
+		return "", "", lerr
+	}
+	return folder, name, nil
+}
+
+// parents returns the folders from the root down to p, root excluded
+func parents(p string) []string {
+	var result []string
+	for i := 1; i < len(p); i++ {
+		if p[i] == '/' {
+			result = append(result, p[:i+1])
+		}
+	}
+	return result
+}
+
+// objectKey is the name of an object on the storage, the files of the root
+// keep their plain name
+func objectKey(folder, name string) string {
+	return strings.TrimPrefix(folder, "/") + name
+}
+
+// CreateFolder makes the folder p of address and its missing parents
+func (c *Controller) CreateFolder(ctx context.Context, address, p string) (FolderResult, error) {
+	p = cleanPath(p)
+	if p == "/" {
+		lerr := logs.ControllerError{Message: "root folder always exists"}
+		logger.Error(lerr)
+		return FolderResult{}, lerr
+	}
+
+	err := c.makeFolders(ctx, address, p)
+	if err != nil {
+		return FolderResult{}, err
+	}
+
+	return toFolderResult(p), nil
+}
+
+func (c *Controller) makeFolders(ctx context.Context, address, p string) error {
+	st := c.store.GetStoreType(ctx)
+	now := time.Now()
+	var folders []api.Folder
+	for _, f := range parents(p) {
+		folders = append(folders, api.Folder{Address: address, SType: st, Path: f, Created: now})
+	}
+	return c.database.CreateFolders(ctx, folders)
+}
+
+// ListFolder lists the folders then the objects right in folder p, sorted by
+// name, from offset on. A limit of 0 lists them all.
+func (c *Controller) ListFolder(ctx context.Context, address, p string, offset, limit int) (ListFolderResult, error) {
+	p = cleanPath(p)
+	st := c.store.GetStoreType(ctx)
+	result := ListFolderResult{
+		Address: address,
+		Storage: st.String(),
+		Path:    p,
+		Folders: []FolderResult{},
+		Objects: []ObjectInfoResult{},
+	}
+
+	folders, files, err := c.folderContent(ctx, address, p)
+	if err != nil {
+		return result, err
+	}
+	if p != "/" && len(folders) == 0 && len(files) == 0 {
+		if ok, err := c.folderExists(ctx, address, p); err != nil || !ok {
+			return result, notExist(err)
+		}
+	}
+
+	result.Total = len(folders) + len(files)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > result.Total {
+		offset = result.Total
+	}
+	end := result.Total
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+
+	for i := offset; i < end && i < len(folders); i++ {
+		result.Folders = append(result.Folders, toFolderResult(folders[i]))
+	}
+	if end > len(folders) {
+		start := offset - len(folders)
+		if start < 0 {
+			start = 0
+		}
+		objects, err := c.toObjectInfoResults(ctx, files[start:end-len(folders)])
+		if err != nil {
+			return result, err
+		}
+		result.Objects = objects
+	}
+
+	return result, nil
+}
+
+// folderContent returns the sub folders and the files right in folder p
+func (c *Controller) folderContent(ctx context.Context, address, p string) ([]string, []api.FileInfo, error) {
+	st := c.store.GetStoreType(ctx)
+	files, err := c.database.ListObjectsByPath(ctx, address, st, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	folders, err := c.database.ListFolders(ctx, address, st, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subs := make(map[string]bool)
+	child := func(f string) {
+		if f == p {
+			return
+		}
+		i := strings.IndexByte(f[len(p):], '/')
+		subs[f[:len(p)+i+1]] = true
+	}
+	for _, f := range folders {
+		child(f.Path)
+	}
+
+	var direct []api.FileInfo
+	for _, fi := range files {
+		if fi.Path == p {
+			direct = append(direct, fi)
+			continue
+		}
+		child(fi.Path)
+	}
+
+	result := make([]string, 0, len(subs))
+	for f := range subs {
+		result = append(result, f)
+	}
+	sort.Strings(result)
+	sort.SliceStable(direct, func(i, j int) bool {
+		return direct[i].Name < direct[j].Name
+	})
+
+	return result, direct, nil
+}
+
+// folderExists is true for a folder recorded or holding files
+func (c *Controller) folderExists(ctx context.Context, address, p string) (bool, error) {
+	if p == "/" {
+		return true, nil
+	}
+	st := c.store.GetStoreType(ctx)
+	folders, err := c.database.ListFolders(ctx, address, st, p)
+	if err != nil || len(folders) > 0 {
+		return len(folders) > 0, err
+	}
+	files, err := c.database.ListObjectsByPath(ctx, address, st, p)
+	return len(files) > 0, err
+}
+
+func notExist(err error) error {
+	if err != nil {
+		return err
+	}
+	lerr := logs.ControllerError{Message: "folder not exist"}
+	logger.Error(lerr)
+	return lerr
+}
+
+// MoveFolder renames the folder from to, which also moves it when its
+// parent changes. The objects are only moved in the database.
+func (c *Controller) MoveFolder(ctx context.Context, address, from, to string) (FolderResult, error) {
+	from, to = cleanPath(from), cleanPath(to)
+	if from == "/" || to == "/" {
+		lerr := logs.ControllerError{Message: "root folder can not be moved"}
+		logger.Error(lerr)
+		return FolderResult{}, lerr
+	}
+	if strings.HasPrefix(to, from) {
+		lerr := logs.ControllerError{Message: "folder can not be moved into itself"}
+		logger.Error(lerr)
+		return FolderResult{}, lerr
+	}
+
+	ok, err := c.folderExists(ctx, address, from)
+	if err != nil || !ok {
+		return FolderResult{}, notExist(err)
+	}
+	ok, err = c.folderExists(ctx, address, to)
+	if err != nil {
+		return FolderResult{}, err
+	}
+	if ok {
+		lerr := logs.ControllerError{Message: "folder already exists"}
+		logger.Error(lerr)
+		return FolderResult{}, lerr
+	}
+
+	err = c.database.MoveFolder(ctx, address, c.store.GetStoreType(ctx), from, to)
+	if err != nil {
+		return FolderResult{}, err
+	}
+
+	// the new parents are made, the folder itself moved with its rows
+	err = c.makeFolders(ctx, address, cleanPath(path.Dir(strings.TrimSuffix(to, "/"))))
+	if err != nil {
+		return FolderResult{}, err
+	}
+
+	return toFolderResult(to), nil
+}
+
+// DeleteFolder deletes the folder p, a folder not empty is only deleted with
+// everything it holds when recursive is set
+func (c *Controller) DeleteFolder(ctx context.Context, address, p string, recursive bool) error {
+	p = cleanPath(p)
+	if p == "/" {
+		lerr := logs.ControllerError{Message: "root folder can not be deleted"}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	st := c.store.GetStoreType(ctx)
+	folders, err := c.database.ListFolders(ctx, address, st, p)
+	if err != nil {
+		return err
+	}
+	files, err := c.database.ListObjectsByPath(ctx, address, st, p)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 && len(files) == 0 {
+		return notExist(nil)
+	}
+
+	empty := len(files) == 0 && (len(folders) == 0 || len(folders) == 1 && folders[0].Path == p)
+	if !empty && !recursive {
+		lerr := logs.ControllerError{Message: "folder is not empty"}
+		logger.Error(lerr)
+		return lerr
+	}
+
+	for _, fi := range files {
+		err = c.DeleteObject(ctx, address, fi.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.database.DeleteFolders(ctx, address, st, p)
+}
+
+func toFolderResult(p string) FolderResult {
+	return FolderResult{
+		Name: path.Base(p),
+		Path: p,
+	}
+}
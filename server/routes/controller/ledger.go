@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/memoio/backend/api"
+)
+
+// recordLedger appends a transfer of bytes of fi to the ledger, the transfer
+// is done so a failure is only logged
+func (c *Controller) recordLedger(ctx context.Context, kind api.LedgerKind, fi api.FileInfo, bytes int64) {
+	err := c.database.AppendLedger(ctx, api.LedgerEntry{
+		Address: fi.Address,
+		SType:   fi.SType,
+		Kind:    kind,
+		FileID:  fi.ID,
+		Mid:     fi.Mid,
+		Bytes:   bytes,
+		Time:    time.Now(),
+	})
+	if err != nil {
+		logger.Error("record ledger error:", err)
+	}
+}
+
+// Ledger sums up the transfers of the files of address on the current
+// storage by day or by month
+func (c *Controller) Ledger(ctx context.Context, address string, opts LedgerOptions) (LedgerResult, error) {
+	st := c.store.GetStoreType(ctx)
+	result := LedgerResult{
+		Address: address,
+		Storage: st.String(),
+		Period:  opts.Period,
+		From:    opts.From,
+		To:      opts.To,
+	}
+
+	sums, err := c.database.SumLedger(ctx, api.LedgerQuery{
+		Address: address,
+		SType:   &st,
+		FileID:  opts.FileID,
+		Kind:    opts.Kind,
+		From:    opts.From,
+		To:      opts.To,
+		Period:  opts.Period,
+		ByFile:  opts.ByFile,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Sums = sums
+	return result, nil
+}
+
+// SumLedger sums up the transfers of all the addresses, each address apart
+// unless q selects one
+func (c *Controller) SumLedger(ctx context.Context, q api.LedgerQuery) ([]api.LedgerSum, error) {
+	q.ByAddress = q.Address == ""
+	return c.database.SumLedger(ctx, q)
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+const (
+	maxTags        = 50
+	maxMetaKeyLen  = 128
+	maxMetaLen     = 1024
+	maxTagValueLen = 256
+)
+
+// MetaPatch changes the metadata and tags of an object, a nil value removes
+// its key
+type MetaPatch struct {
+	Meta map[string]*string `json:"meta"`
+	Tags map[string]*string `json:"tags"`
+}
+
+// splitUserDefine parses the user defined values of a file into its
+// metadata and its tags
+func splitUserDefine(userdefine string) (map[string]string, map[string]string) {
+	meta := make(map[string]string)
+	tags := make(map[string]string)
+
+	ud := make(map[string]string)
+	if userdefine != "" {
+		json.Unmarshal([]byte(userdefine), &ud)
+	}
+	for k, v := range ud {
+		if strings.HasPrefix(k, api.TagPrefix) {
+			tags[strings.TrimPrefix(k, api.TagPrefix)] = v
+		} else {
+			meta[k] = v
+		}
+	}
+	return meta, tags
+}
+
+// joinUserDefine is the opposite of splitUserDefine
+func joinUserDefine(meta, tags map[string]string) (string, error) {
+	ud := make(map[string]string, len(meta)+len(tags))
+	for k, v := range meta {
+		ud[k] = v
+	}
+	for k, v := range tags {
+		ud[api.TagPrefix+k] = v
+	}
+
+	b, err := json.Marshal(ud)
+	if err != nil {
+		lerr := logs.ControllerError{Message: err.Error()}
+		logger.Error(lerr)
+		return "", lerr
+	}
+	return string(b), nil
+}
+
+// checkMeta fails for metadata or tags too large to be kept
+func checkMeta(meta, tags map[string]string) error {
+	var msg string
+	for k, v := range meta {
+		switch {
+		case k == "" || len(k) > maxMetaKeyLen:
+			msg = fmt.Sprintf("metadata key should have 1 to %d bytes", maxMetaKeyLen)
+		case strings.HasPrefix(k, api.TagPrefix):
+			msg = fmt.Sprintf("metadata key can not start with %q", api.TagPrefix)
+		case len(v) > maxMetaLen:
+			msg = fmt.Sprintf("metadata %s is larger than %d bytes", k, maxMetaLen)
+		}
+	}
+
+	if len(tags) > maxTags {
+		msg = fmt.Sprintf("an object has at most %d tags", maxTags)
+	}
+	for k, v := range tags {
+		switch {
+		case k == "" || len(k) > maxMetaKeyLen:
+			msg = fmt.Sprintf("tag key should have 1 to %d bytes", maxMetaKeyLen)
+		case strings.ContainsAny(k, `":\`):
+			msg = "tag key can not hold quotes, colons or backslashes"
+		case len(v) > maxTagValueLen:
+			msg = fmt.Sprintf("tag %s is larger than %d bytes", k, maxTagValueLen)
+		}
+	}
+
+	if msg != "" {
+		lerr := logs.ControllerError{Message: msg}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// PatchObjectMeta changes the metadata and tags of the object id, they are
+// only changed in the database
+func (c *Controller) PatchObjectMeta(ctx context.Context, address string, id int, patch MetaPatch) (ObjectInfoResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	meta, tags := splitUserDefine(fi.UserDefine)
+	apply(meta, patch.Meta)
+	apply(tags, patch.Tags)
+	err = checkMeta(meta, tags)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	fi.UserDefine, err = joinUserDefine(meta, tags)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	err = c.database.UpdateUserDefine(ctx, fi.ID, fi.UserDefine)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	return c.toObjectInfoResult(ctx, fi)
+}
+
+func apply(m map[string]string, patch map[string]*string) {
+	for k, v := range patch {
+		if v == nil {
+			delete(m, k)
+		} else {
+			m[k] = *v
+		}
+	}
+}
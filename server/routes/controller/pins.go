@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+)
+
+// status of a pin in the pinning service api
+const (
+	PinQueued  = "queued"
+	PinPinning = "pinning"
+	PinPinned  = "pinned"
+	PinFailed  = "failed"
+)
+
+// PinQuery filters the pins listed, the zero value lists everything
+type PinQuery struct {
+	Cids   []string
+	Name   string
+	Match  string
+	Status []string
+	Before time.Time
+	After  time.Time
+	Limit  int
+	Meta   map[string]string
+}
+
+// ListPins lists the files of address on a pinning store the way the
+// pinning service api does, the newest first
+func (c *Controller) ListPins(ctx context.Context, address string, q PinQuery) (PinResults, error) {
+	result := PinResults{Results: []PinStatus{}}
+
+	pins, err := c.pins(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	st := c.store.GetStoreType(ctx)
+	loi, err := c.database.ListObjects(ctx, address, st)
+	if err != nil {
+		return result, err
+	}
+
+	for _, ioi := range loi {
+		ps := toPinStatus(ioi.(api.FileInfo), pins)
+		if q.match(ps) {
+			result.Results = append(result.Results, ps)
+		}
+	}
+
+	sort.SliceStable(result.Results, func(i, j int) bool {
+		return result.Results[i].Created.After(result.Results[j].Created)
+	})
+	result.Count = len(result.Results)
+	if q.Limit > 0 && len(result.Results) > q.Limit {
+		result.Results = result.Results[:q.Limit]
+	}
+
+	return result, nil
+}
+
+// GetPin returns the pin status of the file id of address
+func (c *Controller) GetPin(ctx context.Context, address string, id int) (PinStatus, error) {
+	pins, err := c.pins(ctx)
+	if err != nil {
+		return PinStatus{}, err
+	}
+
+	fi, err := c.getObjectInfoById(ctx, id)
+	if err != nil {
+		return PinStatus{}, err
+	}
+	if fi.Address != address || fi.SType != c.store.GetStoreType(ctx) {
+		lerr := logs.ControllerError{Message: "file not exist"}
+		logger.Error(lerr)
+		return PinStatus{}, lerr
+	}
+
+	return toPinStatus(fi, pins), nil
+}
+
+func (c *Controller) pins(ctx context.Context) (map[string]bool, error) {
+	p, ok := api.Pinner(c.store)
+	if !ok {
+		return nil, logs.StorageNotSupport{}
+	}
+	return p.Pins(ctx)
+}
+
+// toPinStatus reports a file as pinned while the node pins its cid
+func toPinStatus(fi api.FileInfo, pins map[string]bool) PinStatus {
+	meta, _ := splitUserDefine(fi.UserDefine)
+
+	status := PinFailed
+	if pins[fi.Mid] {
+		status = PinPinned
+	}
+
+	return PinStatus{
+		RequestID: strconv.Itoa(fi.ID),
+		Status:    status,
+		Created:   fi.ModTime,
+		Pin: Pin{
+			Cid:  fi.Mid,
+			Name: fi.Name,
+			Meta: meta,
+		},
+		Delegates: []string{},
+	}
+}
+
+func (q PinQuery) match(ps PinStatus) bool {
+	if len(q.Cids) > 0 && !contains(q.Cids, ps.Pin.Cid) {
+		return false
+	}
+	if len(q.Status) > 0 && !contains(q.Status, ps.Status) {
+		return false
+	}
+	if !q.Before.IsZero() && !ps.Created.Before(q.Before) {
+		return false
+	}
+	if !q.After.IsZero() && !ps.Created.After(q.After) {
+		return false
+	}
+	for k, v := range q.Meta {
+		if ps.Pin.Meta[k] != v {
+			return false
+		}
+	}
+	if q.Name == "" {
+		return true
+	}
+
+	name := ps.Pin.Name
+	switch q.Match {
+	case "iexact":
+		return strings.EqualFold(name, q.Name)
+	case "partial":
+		return strings.Contains(name, q.Name)
+	case "ipartial":
+		return strings.Contains(strings.ToLower(name), strings.ToLower(q.Name))
+	default:
+		return name == q.Name
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toRemotePinResults(pins []api.RemotePin) []RemotePinResult {
+	var result []RemotePinResult
+	for _, pin := range pins {
+		result = append(result, RemotePinResult{
+			Pinner:  pin.Pinner,
+			Status:  pin.Status,
+			Error:   pin.Error,
+			Updated: pin.Updated,
+		})
+	}
+	return result
+}
+
+// StartPinning starts pinning the uploads on the remote pinners, if any
+func (c *Controller) StartPinning(ctx context.Context) {
+	if c.pinning.Enabled() {
+		c.pinning.Start(ctx)
+	}
+}
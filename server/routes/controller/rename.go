@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/segmentio/ksuid"
+)
+
+// getOwnedObject returns the file id when address owns it on the store
+func (c *Controller) getOwnedObject(ctx context.Context, address string, id int) (api.FileInfo, error) {
+	fi, err := c.getObjectInfoById(ctx, id)
+	if err != nil {
+		return fi, err
+	}
+	if fi.Address != address || fi.SType != c.store.GetStoreType(ctx) {
+		lerr := logs.ControllerError{Message: "file not exist"}
+		logger.Error(lerr)
+		return api.FileInfo{}, lerr
+	}
+	return fi, nil
+}
+
+// checkFree fails when folder already holds a file named name
+func (c *Controller) checkFree(ctx context.Context, address, folder, name string) error {
+	count, err := c.database.CountObjectsByName(ctx, address, c.store.GetStoreType(ctx), folder, name)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		lerr := logs.ControllerError{Message: "object " + folder + name + " already exists"}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// uniqueKey returns the key an upload is stored as, a key already used by
+// a renamed or copied file gets a unique suffix so it is not overwritten
+func (c *Controller) uniqueKey(ctx context.Context, address, key string) (string, error) {
+	if _, ok := api.Pinner(c.store); ok {
+		return key, nil
+	}
+
+	count, err := c.database.CountObjectsByKey(ctx, address, c.store.GetStoreType(ctx), key)
+	if err != nil || count == 0 {
+		return key, err
+	}
+
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "-" + ksuid.New().String() + ext, nil
+}
+
+// RenameObject gives the object id a new name in its folder
+func (c *Controller) RenameObject(ctx context.Context, address string, id int, name string) (ObjectInfoResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	if strings.Contains(name, "/") {
+		lerr := logs.ControllerError{Message: "name can not hold a slash, move the object instead"}
+		logger.Error(lerr)
+		return ObjectInfoResult{}, lerr
+	}
+
+	return c.moveObject(ctx, fi, fi.Path, name)
+}
+
+// MoveObject moves the object id into folder, under a new name if name is
+// set. Only the database is changed, the object keeps its key on the storage.
+func (c *Controller) MoveObject(ctx context.Context, address string, id int, folder, name string) (ObjectInfoResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	if name == "" {
+		name = fi.Name
+	}
+
+	return c.moveObject(ctx, fi, folder, name)
+}
+
+func (c *Controller) moveObject(ctx context.Context, fi api.FileInfo, folder, name string) (ObjectInfoResult, error) {
+	if fi.Archived {
+		lerr := logs.ControllerError{Message: "an older version moves with its object, roll it back first"}
+		logger.Error(lerr)
+		return ObjectInfoResult{}, lerr
+	}
+	folder, name, err := splitObject(folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	if folder == fi.Path && name == fi.Name {
+		return c.toObjectInfoResult(ctx, fi)
+	}
+
+	err = c.checkFree(ctx, fi.Address, folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	err = c.database.RenameObject(ctx, fi.ID, folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	err = c.makeFolders(ctx, fi.Address, folder)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	fi.Path, fi.Name = folder, name
+	return c.toObjectInfoResult(ctx, fi)
+}
+
+// CopyObject records a copy of the object id in folder, named name or as
+// the original, an older version is copied as a new object. The copy shares
+// the content on the storage, so no space is charged for it; the content is
+// deleted with the last file using it.
+func (c *Controller) CopyObject(ctx context.Context, address string, id int, folder, name string) (ObjectInfoResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	if name == "" {
+		name = fi.Name
+	}
+	folder, name, err = splitObject(folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	err = c.checkFree(ctx, address, folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	cp := fi
+	cp.Path, cp.Name = folder, name
+	cp.ObjectKey = fi.Key()
+	cp.ModTime = time.Now()
+	cp.Archived = false
+	cp.Version, err = c.database.NextVersion(ctx, address, fi.SType, folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	cp, err = c.database.CopyObject(ctx, fi.ID, cp)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	err = c.makeFolders(ctx, address, folder)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	c.queueDerivatives(ctx, cp)
+
+	return c.toObjectInfoResult(ctx, cp)
+}
+
+func (c *Controller) toObjectInfoResult(ctx context.Context, fi api.FileInfo) (ObjectInfoResult, error) {
+	result, err := c.toObjectInfoResults(ctx, []api.FileInfo{fi})
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	return result[0], nil
+}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/logs"
+)
+
+const sweepBatch = 100
+
+// trashRetention is how long a deleted file stays in the trash
+func trashRetention(cfg config.TrashConfig) time.Duration {
+	retention, err := time.ParseDuration(cfg.Retention)
+	if err != nil || retention <= 0 {
+		logger.Warnf("invalid trash retention %q, use 720h", cfg.Retention)
+		retention = 720 * time.Hour
+	}
+	return retention
+}
+
+// getTrashedObject returns the file id of address in the trash of the store
+func (c *Controller) getTrashedObject(ctx context.Context, address string, id int) (api.FileInfo, error) {
+	fi, err := c.database.GetTrashedObject(ctx, id)
+	if err != nil {
+		return fi, err
+	}
+	if fi.ID == 0 || fi.Address != address || fi.SType != c.store.GetStoreType(ctx) {
+		lerr := logs.ControllerError{Message: "file not in trash"}
+		logger.Error(lerr)
+		return api.FileInfo{}, lerr
+	}
+	return fi, nil
+}
+
+// ListTrash lists the files of address in the trash, the last deleted
+// first, from offset on. A limit of 0 lists them all.
+func (c *Controller) ListTrash(ctx context.Context, address string, offset, limit int) (ListTrashResult, error) {
+	st := c.store.GetStoreType(ctx)
+	result := ListTrashResult{
+		Address: address,
+		Storage: st.String(),
+		Objects: []TrashObjectResult{},
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	files, total, err := c.database.ListTrash(ctx, address, st, offset, limit)
+	if err != nil {
+		return result, err
+	}
+	objects, err := c.toObjectInfoResults(ctx, files)
+	if err != nil {
+		return result, err
+	}
+
+	result.Total = total
+	for i, fi := range files {
+		result.Objects = append(result.Objects, TrashObjectResult{
+			ObjectInfoResult: objects[i],
+			Deleted:          fi.Deleted.Time,
+			Expire:           fi.Deleted.Time.Add(c.retention),
+		})
+	}
+	return result, nil
+}
+
+// RestoreObject takes the object id out of the trash, into folder and
+// under name when they are set, or where it was deleted from
+func (c *Controller) RestoreObject(ctx context.Context, address string, id int, folder, name string) (ObjectInfoResult, error) {
+	fi, err := c.getTrashedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	if folder == "" {
+		folder = fi.Path
+	}
+	if name == "" {
+		name = fi.Name
+	}
+	folder, name, err = splitObject(folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	err = c.checkFree(ctx, address, folder, name)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	fi.Path, fi.Name = folder, name
+	err = c.database.RestoreObject(ctx, fi)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+	err = c.makeFolders(ctx, address, folder)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	fi.Deleted.Valid = false
+	return c.toObjectInfoResult(ctx, fi)
+}
+
+// PurgeObject deletes the object id of the trash from the storage now
+func (c *Controller) PurgeObject(ctx context.Context, address string, id int) error {
+	fi, err := c.getTrashedObject(ctx, address, id)
+	if err != nil {
+		return err
+	}
+	return c.purgeTrashed(ctx, fi)
+}
+
+// EmptyTrash purges every object of address in the trash, it returns the
+// number purged
+func (c *Controller) EmptyTrash(ctx context.Context, address string) (int, error) {
+	files, _, err := c.database.ListTrash(ctx, address, c.store.GetStoreType(ctx), 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, fi := range files {
+		err = c.purgeTrashed(ctx, fi)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(files), nil
+}
+
+// purgeTrashed purges the file fi of the trash with the older versions
+// trashed with it
+func (c *Controller) purgeTrashed(ctx context.Context, fi api.FileInfo) error {
+	versions, err := c.database.ListTrashedVersions(ctx, fi)
+	if err != nil {
+		return err
+	}
+	for _, v := range append(versions, fi) {
+		err = c.purgeObject(ctx, c.store, v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeObject deletes the file fi, its derivatives and its object from
+// store, an object shared with other files is kept for them
+func (c *Controller) purgeObject(ctx context.Context, store api.IGateway, fi api.FileInfo) error {
+	c.deleteDerivatives(ctx, store, fi.ID)
+
+	// content shared by several files is only released with the last one
+	if fi.Hash != "" {
+		content, last, err := c.database.DeleteObjectRef(ctx, fi)
+		if err != nil || !last {
+			return err
+		}
+		err = store.DeleteObject(ctx, content.Address, content.ObjectKey)
+		if err != nil && !strings.Contains(err.Error(), "not exist") {
+			logger.Errorf("delete content %s of %s: %s", content.Hash, content.Address, err)
+		}
+		return nil
+	}
+	if _, ok := api.Pinner(store); ok {
+		err := c.database.DeleteObject(ctx, fi.ID)
+		if err != nil {
+			return err
+		}
+		return c.releaseObject(ctx, store, fi.Address, fi.Key(), fi.Mid)
+	}
+
+	// copies share the object on the storage, it goes with the last one
+	count, err := c.database.CountObjectsByKey(ctx, fi.Address, fi.SType, fi.Key())
+	if err != nil {
+		return err
+	}
+	if count > 1 {
+		return c.database.DeleteObject(ctx, fi.ID)
+	}
+
+	err = store.DeleteObject(ctx, fi.Address, fi.Key())
+	if err != nil && !strings.Contains(err.Error(), "not exist") {
+		return err
+	}
+
+	return c.database.DeleteObject(ctx, fi.ID)
+}
+
+// restoreTrashed brings back, instead of recording fi, the same file of the
+// trash if there is one. It returns false when there is none.
+func (c *Controller) restoreTrashed(ctx context.Context, fi api.FileInfo) (bool, error) {
+	trashed, err := c.database.FindTrashedObject(ctx, fi)
+	if err != nil || trashed.ID == 0 {
+		return false, err
+	}
+
+	fi.ID = trashed.ID
+	return true, c.database.RestoreObject(ctx, fi)
+}
+
+// SweepTrash purges the files deleted before before, the stores of their
+// storage are given by resolve. It returns the number purged.
+func (c *Controller) SweepTrash(ctx context.Context, before time.Time, resolve func(api.StorageType) (api.IGateway, error)) int {
+	stores := make(map[api.StorageType]api.IGateway)
+	purged, after := 0, 0
+	for ctx.Err() == nil {
+		files, err := c.database.ListExpiredTrash(ctx, before, after, sweepBatch)
+		if err != nil || len(files) == 0 {
+			return purged
+		}
+		after = files[len(files)-1].ID
+
+		for _, fi := range files {
+			store, ok := stores[fi.SType]
+			if !ok {
+				store, err = resolve(fi.SType)
+				if err != nil {
+					logger.Errorf("sweep trash of %s: %s", fi.SType, err)
+				}
+				stores[fi.SType] = store
+			}
+			if store == nil {
+				continue
+			}
+
+			err = c.purgeObject(ctx, store, fi)
+			if err != nil {
+				logger.Errorf("purge %s of %s: %s", fi.Name, fi.Address, err)
+				continue
+			}
+			purged++
+		}
+	}
+	return purged
+}
+
+// StartTrash purges every interval the files whose retention is over, it
+// stops with ctx
+func (c *Controller) StartTrash(ctx context.Context, interval time.Duration, resolve func(api.StorageType) (api.IGateway, error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			n := c.SweepTrash(ctx, time.Now().Add(-c.retention), resolve)
+			if n > 0 {
+				logger.Infof("purged %d files from the trash", n)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
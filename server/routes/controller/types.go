@@ -14,25 +14,213 @@ type PutObjectResult struct {
 }
 
 type GetObjectResult struct {
-	Name  string
-	Size  int64
-	CType string
+	Name    string
+	Size    int64
+	CType   string
+	ModTime time.Time
+}
+
+type UploadSessionResult struct {
+	ID       string
+	Name     string
+	Size     int64
+	Received int64
+	Storage  string
+	Expire   time.Time
+	Parts    []UploadPartResult
+}
+
+type UploadPartResult struct {
+	Number int
+	Size   int64
+	MD5    string
 }
 
 type ListObjectsResult struct {
+	Address   string
+	Storage   string
+	Prefix    string `json:",omitempty"`
+	Delimiter string `json:",omitempty"`
+	Objects   []ObjectInfoResult
+	// CommonPrefixes are the folders rolled up by the delimiter, they
+	// are only listed with the first page
+	CommonPrefixes []string `json:",omitempty"`
+	// Total is the number of objects selected on every page
+	Total int64
+	// NextCursor lists the next page, it is empty on the last one
+	NextCursor string `json:",omitempty"`
+}
+
+// ListObjectsOptions select the objects whose path+name starts with
+// Prefix, the ones having Delimiter after the prefix are rolled up
+type ListObjectsOptions struct {
+	Prefix       string
+	Delimiter    string
+	NameContains string
+	ContentType  string
+	Public       *bool
+	MinSize      int64
+	MaxSize      int64
+	MinWidth     int64
+	MinHeight    int64
+	MinDuration  int64
+	MaxDuration  int64
+	TakenAfter   time.Time
+	TakenBefore  time.Time
+	Tags         map[string]string
+	Sort         string
+	Desc         bool
+	Cursor       string
+	Limit        int
+}
+
+// LedgerOptions selects the transfers to sum up, Period is day or month,
+// the fields left empty are not checked
+type LedgerOptions struct {
+	Period string
+	From   time.Time
+	To     time.Time
+	Kind   api.LedgerKind
+	FileID int
+	ByFile bool
+}
+
+// LedgerResult sums up the transfers of an address by period and by kind
+type LedgerResult struct {
 	Address string
 	Storage string
-	Objects []ObjectInfoResult
+	Period  string
+	From    time.Time
+	To      time.Time
+	Sums    []api.LedgerSum
+}
+
+// Statement is what an address bought, cashed out and transferred in a
+// period, in bytes. Pending is the size of the checks it signed that are
+// not cashed out yet, when the statement is made.
+type Statement struct {
+	Address        string
+	From           time.Time
+	To             time.Time
+	BoughtSpace    int64
+	BoughtTraffic  int64
+	CashedSpace    int64
+	CashedTraffic  int64
+	PendingSpace   int64
+	PendingTraffic int64
+	Uploaded       int64
+	Downloaded     int64
+	Shared         int64
+	Entries        []api.BillingEntry
 }
 
 type ObjectInfoResult struct {
-	ID      int
-	Name    string
-	Size    int64
+	ID          int
+	Name        string
+	Path        string
+	Size        int64
+	Mid         string
+	Version     int
+	ContentType string
+	Public      bool
+	// Encrypted objects are stored encrypted, OwnerKey is their data key
+	// wrapped to the public key of the owner
+	Encrypted bool
+	OwnerKey  string
+	// Derived lists the derivatives made of the object, such as "thumbnail"
+	Derived []string
+	// Media is what the content tells of an image or an audio, nil for
+	// other files
+	Media       *MediaResult
+	ModTime     time.Time
+	UserDefined map[string]string
+	Tags        map[string]string
+	Replicas    []ReplicaResult
+	RemotePins  []RemotePinResult
+}
+
+// ListVersionsResult lists the versions of an object, the last one first.
+// Every version takes its own space, Size is the sum of them.
+type ListVersionsResult struct {
+	Path     string
+	Name     string
+	Current  int
+	Versions []ObjectInfoResult
+	Size     int64
+}
+
+// BatchResult reports the objects of a batch one by one
+type BatchResult struct {
+	Op        string
+	Succeeded int
+	Failed    int
+	Items     []BatchItemResult
+}
+
+// BatchItemResult is an object of a batch, Link is its share link
+type BatchItemResult struct {
+	ID    int
+	OK    bool
+	Error string `json:",omitempty"`
+	Link  string `json:",omitempty"`
+}
+
+// TrashObjectResult is an object of the trash, it is purged at Expire
+type TrashObjectResult struct {
+	ObjectInfoResult
+	Deleted time.Time
+	Expire  time.Time
+}
+
+// ListTrashResult is a page of the trash of an address
+type ListTrashResult struct {
+	Address string
+	Storage string
+	Objects []TrashObjectResult
+	Total   int64
+}
+
+type FolderResult struct {
+	Name string
+	Path string
+}
+
+// ListFolderResult is a page of a folder, the folders come before the objects
+type ListFolderResult struct {
+	Address string
+	Storage string
+	Path    string
+	Folders []FolderResult
+	Objects []ObjectInfoResult
+	// Total counts the folders and objects of the whole folder
+	Total int
+}
+
+// RemotePinResult is the pin of an ipfs object on a remote pinning service
+type RemotePinResult struct {
+	Pinner  string
+	Status  string
+	Error   string
+	Updated time.Time
+}
+
+// ReplicaResult is the status of one copy of a replicated object
+type ReplicaResult struct {
+	Backend string
+	Storage string
 	Mid     string
-	Public  bool
+	Primary bool
+	Status  string
 	ModTime time.Time
-	// UserDefined map[string]string
+}
+
+// MediaResult is the size of an image in pixels, the date a photo was
+// taken, or the length of an audio in seconds
+type MediaResult struct {
+	Width    int
+	Height   int
+	Taken    time.Time
+	Duration float64
 }
 
 type IPayPayment struct {
@@ -42,3 +230,25 @@ type IPayPayment struct {
 	FreeByte uint64
 	Expire   uint64
 }
+
+// PinStatus is a pin of the ipfs pinning service api
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    string            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+type PinResults struct {
+	Count   int         `json:"count"`
+	Results []PinStatus `json:"results"`
+}
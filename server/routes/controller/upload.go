@@ -0,0 +1,375 @@
+package controller
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	uploadExpire  = 24 * time.Hour
+	maxPartNumber = 10000
+)
+
+// parts are kept on local disk until the session is completed
+var uploadPath = filepath.Join("./", "uploads")
+
+func partFile(id string, number int) string {
+	return filepath.Join(uploadPath, id, strconv.Itoa(number))
+}
+
+// CreateUploadSession starts an upload of opts.Size bytes sent in parts, the
+// space bought is checked here and the space check is signed at complete
+func (c *Controller) CreateUploadSession(ctx context.Context, address, object string, opts ObjectOptions) (UploadSessionResult, error) {
+	result := UploadSessionResult{}
+
+	if object == "" || opts.Size <= 0 {
+		lerr := logs.ControllerError{Message: "name and size should be set"}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	_, _, err := splitObject(opts.Path, object)
+	if err != nil {
+		return result, err
+	}
+	err = checkMeta(opts.UserDefined, opts.Tags)
+	if err != nil {
+		return result, err
+	}
+	err = c.checkEncrypt(opts)
+	if err != nil {
+		return result, err
+	}
+
+	_, err = c.getSpaceCheckInfo(ctx, address, uint64(opts.Size))
+	if err != nil {
+		return result, err
+	}
+
+	c.cleanUploadSessions(ctx)
+
+	// the tags are kept with the metadata until the upload completes
+	userdefine, err := joinUserDefine(opts.UserDefined, opts.Tags)
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	us := api.UploadSession{
+		ID:         ksuid.New().String(),
+		Address:    address,
+		SType:      c.store.GetStoreType(ctx),
+		Name:       object,
+		Path:       opts.Path,
+		Size:       opts.Size,
+		Area:       opts.Area,
+		UserDefine: userdefine,
+		Encrypt:    opts.Encrypt,
+		OwnerKey:   opts.OwnerKey,
+		Created:    now,
+		Expire:     now.Add(uploadExpire),
+	}
+
+	err = os.MkdirAll(filepath.Join(uploadPath, us.ID), os.ModePerm)
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	err = c.database.CreateUploadSession(ctx, us)
+	if err != nil {
+		os.RemoveAll(filepath.Join(uploadPath, us.ID))
+		return result, err
+	}
+
+	return toUploadSessionResult(us, nil), nil
+}
+
+// PutUploadPart stores part number of the session, sending a part again
+// replaces it
+func (c *Controller) PutUploadPart(ctx context.Context, address, id string, number int, r io.Reader) (UploadPartResult, error) {
+	result := UploadPartResult{}
+
+	us, err := c.getUploadSession(ctx, address, id)
+	if err != nil {
+		return result, err
+	}
+
+	if number < 1 || number > maxPartNumber {
+		lerr := logs.ControllerError{Message: fmt.Sprintf("part number should be in [1, %d]", maxPartNumber)}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	parts, err := c.database.ListUploadParts(ctx, id)
+	if err != nil {
+		return result, err
+	}
+	remain := us.Size
+	for _, p := range parts {
+		if p.Number != number {
+			remain -= p.Size
+		}
+	}
+
+	// the part is written aside and moved into place once recorded, a part
+	// sent twice at the same time is not written into the same file
+	f, err := os.CreateTemp(filepath.Join(uploadPath, id), "part-")
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return result, lerr
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	h := md5.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, remain+1))
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return result, logs.ServerError{Message: err.Error()}
+	}
+	if n > remain {
+		lerr := logs.ControllerError{Message: fmt.Sprintf("parts are larger than the upload size %d", us.Size)}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	part := api.UploadPart{
+		SessionID: id,
+		Number:    number,
+		Size:      n,
+		MD5:       hex.EncodeToString(h.Sum(nil)),
+		ModTime:   time.Now(),
+	}
+	// parts received meanwhile are counted again with this one, they can
+	// never add up to more than the checked size
+	err = c.database.WithTransaction(ctx, func(db api.IDataBase) error {
+		err := db.PutUploadPart(ctx, part)
+		if err != nil {
+			return err
+		}
+		parts, err := db.ListUploadParts(ctx, id)
+		if err != nil {
+			return err
+		}
+		var total int64
+		for _, p := range parts {
+			total += p.Size
+		}
+		if total > us.Size {
+			lerr := logs.ControllerError{Message: fmt.Sprintf("parts are larger than the upload size %d", us.Size)}
+			logger.Error(lerr)
+			return lerr
+		}
+
+		err = os.Rename(f.Name(), partFile(id, number))
+		if err != nil {
+			lerr := logs.ServerError{Message: err.Error()}
+			logger.Error(lerr)
+			return lerr
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	return UploadPartResult{Number: part.Number, Size: part.Size, MD5: part.MD5}, nil
+}
+
+// GetUploadSession returns the session with the parts received so far
+func (c *Controller) GetUploadSession(ctx context.Context, address, id string) (UploadSessionResult, error) {
+	us, err := c.getUploadSession(ctx, address, id)
+	if err != nil {
+		return UploadSessionResult{}, err
+	}
+
+	parts, err := c.database.ListUploadParts(ctx, id)
+	if err != nil {
+		return UploadSessionResult{}, err
+	}
+
+	return toUploadSessionResult(us, parts), nil
+}
+
+// CompleteUploadSession joins the parts 1..n in order and stores them as one
+// object, the space check of its size is signed now so no charge made since
+// the session was created is lost. The session is taken before the object is
+// stored, it is completed once and put back if storing fails.
+func (c *Controller) CompleteUploadSession(ctx context.Context, address, id, sign string) (PutObjectResult, error) {
+	result := PutObjectResult{}
+
+	us, err := c.getUploadSession(ctx, address, id)
+	if err != nil {
+		return result, err
+	}
+
+	parts, err := c.database.ListUploadParts(ctx, id)
+	if err != nil {
+		return result, err
+	}
+
+	var size int64
+	readers := make([]io.Reader, 0, len(parts))
+	for i, p := range parts {
+		if p.Number != i+1 {
+			lerr := logs.ControllerError{Message: fmt.Sprintf("part %d is missing", i+1)}
+			logger.Error(lerr)
+			return result, lerr
+		}
+		size += p.Size
+
+		f, err := os.Open(partFile(id, p.Number))
+		if err != nil {
+			lerr := logs.ServerError{Message: err.Error()}
+			logger.Error(lerr)
+			return result, lerr
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if size != us.Size {
+		lerr := logs.ControllerError{Message: fmt.Sprintf("received %d bytes, upload size is %d", size, us.Size)}
+		logger.Error(lerr)
+		return result, lerr
+	}
+
+	ci, err := c.canWrite(ctx, address, sign, uint64(us.Size))
+	if err != nil {
+		return result, err
+	}
+
+	// a complete sent twice fails here, the parts opened are still read
+	err = c.database.DeleteUploadSession(ctx, id)
+	if err != nil {
+		return result, err
+	}
+
+	meta, tags := splitUserDefine(us.UserDefine)
+	opts := ObjectOptions{Size: us.Size, Area: us.Area, Path: us.Path, UserDefined: meta, Tags: tags, Encrypt: us.Encrypt, OwnerKey: us.OwnerKey}
+	result, err = c.putObject(ctx, address, us.Name, io.MultiReader(readers...), opts, ci)
+	if err != nil {
+		c.restoreUploadSession(ctx, us, parts)
+		return result, err
+	}
+
+	err = os.RemoveAll(filepath.Join(uploadPath, id))
+	if err != nil {
+		logger.Error("remove upload parts error: ", err)
+	}
+
+	return result, nil
+}
+
+// restoreUploadSession puts back a session taken by a complete that failed,
+// so it can be completed again
+func (c *Controller) restoreUploadSession(ctx context.Context, us api.UploadSession, parts []api.UploadPart) {
+	err := c.database.WithTransaction(ctx, func(db api.IDataBase) error {
+		err := db.CreateUploadSession(ctx, us)
+		if err != nil {
+			return err
+		}
+		for _, p := range parts {
+			err = db.PutUploadPart(ctx, p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("restore upload session error: ", err)
+	}
+}
+
+func (c *Controller) AbortUploadSession(ctx context.Context, address, id string) error {
+	_, err := c.getUploadSession(ctx, address, id)
+	if err != nil {
+		return err
+	}
+
+	return c.removeUploadSession(ctx, id)
+}
+
+// getUploadSession loads a live session of address made on the current store
+func (c *Controller) getUploadSession(ctx context.Context, address, id string) (api.UploadSession, error) {
+	us, err := c.database.GetUploadSession(ctx, id)
+	if err != nil {
+		return us, err
+	}
+
+	if us.Address != address || us.SType != c.store.GetStoreType(ctx) {
+		lerr := logs.ControllerError{Message: "upload session not exist"}
+		logger.Error(lerr)
+		return us, lerr
+	}
+
+	if time.Now().After(us.Expire) {
+		lerr := logs.ControllerError{Message: "upload session is expired"}
+		logger.Error(lerr)
+		return us, lerr
+	}
+
+	return us, nil
+}
+
+func (c *Controller) removeUploadSession(ctx context.Context, id string) error {
+	err := c.database.DeleteUploadSession(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = os.RemoveAll(filepath.Join(uploadPath, id))
+	if err != nil {
+		lerr := logs.ServerError{Message: err.Error()}
+		logger.Error(lerr)
+		return lerr
+	}
+	return nil
+}
+
+// cleanUploadSessions drops the expired sessions and their parts
+func (c *Controller) cleanUploadSessions(ctx context.Context) {
+	sessions, err := c.database.ListExpiredUploadSessions(ctx, time.Now())
+	if err != nil {
+		return
+	}
+
+	for _, us := range sessions {
+		err = c.removeUploadSession(ctx, us.ID)
+		if err != nil {
+			logger.Error("remove upload session error: ", err)
+		}
+	}
+}
+
+func toUploadSessionResult(us api.UploadSession, parts []api.UploadPart) UploadSessionResult {
+	result := UploadSessionResult{
+		ID:      us.ID,
+		Name:    us.Name,
+		Size:    us.Size,
+		Expire:  us.Expire,
+		Parts:   []UploadPartResult{},
+		Storage: us.SType.String(),
+	}
+	for _, p := range parts {
+		result.Received += p.Size
+		result.Parts = append(result.Parts, UploadPartResult{Number: p.Number, Size: p.Size, MD5: p.MD5})
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+)
+
+// StorageInfo reports the space and the files address holds on the current
+// storage. The space bought, with the free space given, is shared by all
+// the storages, Free is what the files on all of them leave of it.
+func (c *Controller) StorageInfo(ctx context.Context, address string) (api.StorageInfo, error) {
+	st := c.store.GetStoreType(ctx)
+	result := api.StorageInfo{Storage: st.String()}
+
+	usage, err := c.database.ListUsage(ctx, address)
+	if err != nil {
+		return result, err
+	}
+	var used int64
+	for _, u := range usage {
+		used += u.Used
+		if u.SType == st {
+			result.Used = u.Used
+			result.Files = u.Files
+		}
+	}
+
+	pi, err := c.SpacePayInfo(ctx, address)
+	if err != nil {
+		return result, err
+	}
+	result.Buysize = int64(pi.SizeByte + pi.FreeByte)
+	result.Free = result.Buysize - used
+	if result.Free < 0 {
+		result.Free = 0
+	}
+	return result, nil
+}
+
+// ListUsage returns the usage of address on each storage, or of every
+// address when address is empty
+func (c *Controller) ListUsage(ctx context.Context, address string) ([]api.Usage, error) {
+	return c.database.ListUsage(ctx, address)
+}
+
+// RebuildUsage counts the usage of every address again from the files
+func (c *Controller) RebuildUsage(ctx context.Context) error {
+	return c.database.RebuildUsage(ctx)
+}
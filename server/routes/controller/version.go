@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/utils"
+)
+
+// recordObject records fi as the current version of its name. The file it
+// replaces is kept as an older version when versioning is on, it is moved
+// into the trash otherwise. It returns true when fi was taken back from the
+// trash instead of being recorded.
+func (c *Controller) recordObject(ctx context.Context, fi api.FileInfo, replicas []api.ObjectReplica, content *api.Content, ci api.CheckInfo) (bool, error) {
+	current, err := c.database.GetCurrentObject(ctx, fi.Address, fi.SType, fi.Path, fi.Name)
+	if err != nil {
+		return false, err
+	}
+	// the same file deleted before is taken back, it is not charged again
+	if current.ID == 0 {
+		restored, err := c.restoreTrashed(ctx, fi)
+		if err != nil || restored {
+			return restored, err
+		}
+	}
+
+	fi.Version, err = c.database.NextVersion(ctx, fi.Address, fi.SType, fi.Path, fi.Name)
+	if err != nil {
+		return false, err
+	}
+
+	if current.ID != 0 {
+		err = c.replaceObject(ctx, current, true)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	err = c.storeFileInfo(ctx, fi, replicas, content, ci)
+	if err != nil {
+		if current.ID != 0 {
+			c.replaceObject(ctx, current, false)
+		}
+		return false, err
+	}
+
+	if current.ID != 0 && c.versioning.Enable && c.versioning.Keep > 0 {
+		c.pruneVersions(ctx, fi)
+	}
+	return false, nil
+}
+
+// replaceObject takes the current file away for a new version, or brings it
+// back when the new one failed
+func (c *Controller) replaceObject(ctx context.Context, current api.FileInfo, replace bool) error {
+	if c.versioning.Enable {
+		return c.database.ArchiveObject(ctx, current.ID, replace)
+	}
+	if replace {
+		return c.database.TrashObject(ctx, current.ID)
+	}
+	return c.database.RestoreObject(ctx, current)
+}
+
+// pruneVersions moves into the trash the older versions of fi beyond the
+// number kept
+func (c *Controller) pruneVersions(ctx context.Context, fi api.FileInfo) {
+	versions, err := c.database.ListVersions(ctx, fi.Address, fi.SType, fi.Path, fi.Name)
+	if err != nil {
+		return
+	}
+
+	kept := 0
+	for _, v := range versions {
+		if !v.Archived {
+			continue
+		}
+		kept++
+		if kept <= c.versioning.Keep {
+			continue
+		}
+		err = c.database.TrashObject(ctx, v.ID)
+		if err != nil {
+			logger.Errorf("prune version %d of %s: %s", v.Version, v.Name, err)
+		}
+	}
+}
+
+// ListVersions lists the versions of the object id, the last one first
+func (c *Controller) ListVersions(ctx context.Context, address string, id int) (ListVersionsResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ListVersionsResult{}, err
+	}
+
+	versions, err := c.database.ListVersions(ctx, address, fi.SType, fi.Path, fi.Name)
+	if err != nil {
+		return ListVersionsResult{}, err
+	}
+	objects, err := c.toObjectInfoResults(ctx, versions)
+	if err != nil {
+		return ListVersionsResult{}, err
+	}
+
+	result := ListVersionsResult{
+		Path:     fi.Path,
+		Name:     fi.Name,
+		Versions: objects,
+	}
+	for _, v := range versions {
+		if !v.Archived {
+			result.Current = v.ID
+		}
+		result.Size += v.Size
+	}
+	return result, nil
+}
+
+// RollbackObject makes the version id the current one of its name, the
+// current version is kept as an older one
+func (c *Controller) RollbackObject(ctx context.Context, address string, id int) (ObjectInfoResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return ObjectInfoResult{}, err
+	}
+
+	if fi.Archived {
+		err = c.database.SetCurrentVersion(ctx, id)
+		if err != nil {
+			return ObjectInfoResult{}, err
+		}
+		fi.Archived = false
+	}
+
+	return c.toObjectInfoResult(ctx, fi)
+}
+
+// GetVersionInfo returns the mid of the version id, and what a download
+// response needs to know before its content is streamed
+func (c *Controller) GetVersionInfo(ctx context.Context, address string, id int) (string, GetObjectResult, error) {
+	fi, err := c.getOwnedObject(ctx, address, id)
+	if err != nil {
+		return "", GetObjectResult{}, err
+	}
+
+	return fi.Mid, GetObjectResult{
+		Name:    fi.Name,
+		Size:    fi.Size,
+		CType:   utils.FileContentType(fi),
+		ModTime: fi.ModTime,
+	}, nil
+}
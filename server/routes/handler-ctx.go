@@ -1,15 +1,20 @@
 package routes
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gin-gonic/gin"
 	"github.com/memoio/backend/api"
+	auth "github.com/memoio/backend/internal/authentication"
 	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/internal/share"
+	"github.com/memoio/backend/internal/storage"
 	"github.com/memoio/backend/server/routes/controller"
+	"github.com/memoio/backend/utils"
 	"github.com/memoio/middleware/response"
 )
 
@@ -32,7 +37,7 @@ func (h *handler) getStore(c *gin.Context) error {
 // putOBJ godoc
 //
 //	@Summary		put object
-//	@Description	put object
+//	@Description	put object, either as a multipart form or streamed as the raw request body (chunked transfer encoding is allowed when size is given)
 //	@Tags			PutObj
 //	@Accept			json
 //	@Produce		json
@@ -40,9 +45,15 @@ func (h *handler) getStore(c *gin.Context) error {
 //	@Param			token		formData	string	true	"token"
 //	@Param			requestID	formData	uint64	true	"requestID"
 //	@Param			signature	formData	string	true	"signature"
-//	@Param			file		formData	file	true	"file"
+//	@Param			file		formData	file	false	"file"
 //	@Param			sign		formData	string	true	"sign"
 //	@Param			area		formData	string	false	"area"
+//	@Param			path		formData	string	false	"folder of the object, folders in the name are added to it"
+//	@Param			meta		formData	string	false	"json object of metadata, a query parameter for a raw body upload"
+//	@Param			tags		formData	string	false	"json object of tags, a query parameter for a raw body upload"
+//	@Param			encrypt		formData	bool	false	"store the object encrypted to the key of the did, a query parameter for a raw body upload"
+//	@Param			name		query		string	false	"object name of a raw body upload"
+//	@Param			size		query		int		false	"size of a raw body upload without Content-Length"
 //	@Success		200			{object}	string	"file id"
 //	@Failure		521			{object}	logs.APIError
 //	@Failure		400			{object}	logs.APIError
@@ -56,6 +67,11 @@ func (h handler) putObjectHandle(c *gin.Context) {
 		return
 	}
 
+	if c.ContentType() != "multipart/form-data" {
+		h.putObjectStream(c)
+		return
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
 		err = logs.ServerError{Message: err.Error()}
@@ -63,106 +79,1127 @@ func (h handler) putObjectHandle(c *gin.Context) {
 		return
 	}
 
-	if file == nil {
-		err = logs.ServerError{Message: "file is nil"}
+	if file == nil {
+		err = logs.ServerError{Message: "file is nil"}
+		c.Error(err)
+		return
+	}
+
+	size := file.Size
+
+	object := file.Filename
+	ud, err := parseMeta("meta", c.PostForm("meta"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	tags, err := parseMeta("tags", c.PostForm("tags"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	fr, err := file.Open()
+	if err != nil {
+		err = logs.ServerError{Message: "open file error"}
+		c.Error(err)
+		return
+	}
+	defer fr.Close()
+
+	sign := c.PostForm("sign")
+	area := c.PostForm("area")
+	folder := c.PostForm("path")
+
+	if sign == "" {
+		lerr := logs.ServerError{Message: "sign is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	opts := controller.ObjectOptions{Size: size, UserDefined: ud, Tags: tags, Sign: sign, Area: area, Path: folder}
+	err = h.encryptOptions(c, c.PostForm("encrypt") == "true", &opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := h.controller.PutObject(c.Request.Context(), address, object, fr, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// putObjectStream stores the raw request body without buffering it, the
+// upload is canceled when the client goes away
+func (h handler) putObjectStream(c *gin.Context) {
+	address := c.GetString("address")
+
+	object := c.Query("name")
+	sign := c.Query("sign")
+	area := c.Query("area")
+	folder := c.Query("path")
+
+	if object == "" {
+		lerr := logs.ServerError{Message: "name is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	if sign == "" {
+		lerr := logs.ServerError{Message: "sign is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	size := c.Request.ContentLength
+	if size < 0 {
+		size = toInt64(c.Query("size"))
+	}
+	if size <= 0 {
+		lerr := logs.ServerError{Message: "size is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	ud, err := parseMeta("meta", c.Query("meta"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	tags, err := parseMeta("tags", c.Query("tags"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if ct := c.GetHeader("Content-Type"); ct != "" {
+		ud["content-type"] = ct
+	}
+
+	opts := controller.ObjectOptions{Size: size, UserDefined: ud, Tags: tags, Sign: sign, Area: area, Path: folder}
+	err = h.encryptOptions(c, c.Query("encrypt") == "true", &opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	r := &sizeReader{r: c.Request.Body, remain: size}
+	result, err := h.controller.PutObject(c.Request.Context(), address, object, r, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// encryptOptions makes opts encrypt the object when encrypt is asked or by
+// default, its key is wrapped to the public key of the did of the request
+func (h handler) encryptOptions(c *gin.Context, encrypt bool, opts *controller.ObjectOptions) error {
+	if !encrypt && !h.controller.EncryptByDefault() {
+		return nil
+	}
+
+	key, err := auth.PublicKey(c.GetString("did"))
+	if err != nil {
+		return logs.ServerError{Message: err.Error()}
+	}
+	opts.Encrypt = true
+	opts.OwnerKey = key
+	return nil
+}
+
+// getObject godoc
+//
+//	@Summary		getObject
+//	@Description	getObject, the content is streamed from the storage
+//	@Tags			getObject
+//	@Accept			json
+//	@Produce		json
+//	@Param			b		body		string	true	"body"
+//	@Param			sign	query		string	true	"sign"
+//	@Param			cid		path		string	true	"cid"
+//	@Param			Range	header		string	false	"single byte range, sign the traffic check for its length"
+//	@Success		200		{object}	string	"file id"
+//	@Success		206		{object}	string	"partial content"
+//	@Success		304		{object}	string	"not modified"
+//	@Failure		416		{object}	string	"range not satisfiable"
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		400		{object}	logs.APIError
+//	@Router			/mefs/getObject/{cid} [post]
+//	@Router			/ipfs/getObject/{cid} [post]
+func (h handler) getObjectHandle(c *gin.Context) {
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	cid := c.Param("cid")
+	address := c.GetString("address")
+
+	sign := c.Query("sign")
+
+	if sign == "" {
+		lerr := logs.ServerError{Message: "sign is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	info, err := h.controller.GetObjectInfo(c.Request.Context(), address, cid)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	h.serveObject(c, address, cid, sign, info)
+}
+
+// serveObject streams the object cid described by info, the traffic is
+// checked against sign
+func (h handler) serveObject(c *gin.Context, address, cid, sign string, info controller.GetObjectResult) {
+	// the mid is the content hash, so it is a strong etag
+	header := c.Writer.Header()
+	header.Set("ETag", "\""+cid+"\"")
+	header.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+
+	if code := utils.CheckPreconditions(c.Request, cid, info.ModTime); code != 0 {
+		c.Status(code)
+		return
+	}
+
+	status := http.StatusOK
+	opts := controller.ObjectOptions{Sign: sign}
+	br, err := utils.RequestRange(c.Request, cid, info.ModTime, info.Size)
+	if err != nil {
+		header.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if br != nil {
+		status = http.StatusPartialContent
+		opts.Offset = br.Start
+		opts.Length = br.Length
+		header.Set("Content-Range", br.ContentRange(info.Size))
+		info.Size = br.Length
+	}
+
+	// headers are sent with the first written byte, so a failed sign check
+	// can still be answered with an error
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", info.Name))
+	header.Set("Content-Type", info.CType)
+	header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(status)
+
+	_, err = h.controller.GetObject(c.Request.Context(), address, cid, c.Writer, opts)
+	if err != nil {
+		if !c.Writer.Written() {
+			clearObjectHeaders(header)
+			c.Error(err)
+			return
+		}
+		logger.Error("get object error: ", err)
+	}
+}
+
+// clearObjectHeaders takes back the headers set for an object that failed
+// before its first byte, so the error is not sent as the object
+func clearObjectHeaders(header http.Header) {
+	for _, key := range []string{"Content-Disposition", "Content-Type", "Content-Length", "Content-Range", "ETag", "Last-Modified", "Cache-Control"} {
+		header.Del(key)
+	}
+}
+
+type createUploadRequest struct {
+	Name string `json:"name"`
+	// Path is the folder the object is put in
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Area string `json:"area"`
+	// ContentType is kept with the object
+	ContentType string `json:"contentType"`
+	// Meta is stored with the object, Tags only in the database
+	Meta map[string]string `json:"meta"`
+	Tags map[string]string `json:"tags"`
+	// Encrypt stores the object encrypted to the key of the did
+	Encrypt bool `json:"encrypt"`
+}
+
+// createUpload godoc
+//
+//	@Summary		create upload session
+//	@Description	start a resumable upload, the space check of the total size is signed at complete
+//	@Tags			upload
+//	@Accept			json
+//	@Produce		json
+//	@Param			b	body		createUploadRequest	true	"name, size and area"
+//	@Success		200	{object}	controller.UploadSessionResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/upload [post]
+//	@Router			/ipfs/upload [post]
+func (h handler) createUploadHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req createUploadRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	ud := req.Meta
+	if ud == nil {
+		ud = make(map[string]string)
+	}
+	if req.ContentType != "" {
+		ud["content-type"] = req.ContentType
+	}
+
+	opts := controller.ObjectOptions{Size: req.Size, Area: req.Area, Path: req.Path, UserDefined: ud, Tags: req.Tags}
+	err = h.encryptOptions(c, req.Encrypt, &opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := h.controller.CreateUploadSession(c.Request.Context(), address, req.Name, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// putUploadPart godoc
+//
+//	@Summary		put upload part
+//	@Description	store a numbered part of an upload session from the raw request body, a part sent again replaces the old one
+//	@Tags			upload
+//	@Accept			octet-stream
+//	@Produce		json
+//	@Param			id		path		string	true	"session id"
+//	@Param			number	path		int		true	"part number, from 1"
+//	@Success		200		{object}	controller.UploadPartResult
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/upload/{id}/{number} [put]
+//	@Router			/ipfs/upload/{id}/{number} [put]
+func (h handler) putUploadPartHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.Error(logs.ServerError{Message: "part number is not a number"})
+		return
+	}
+
+	result, err := h.controller.PutUploadPart(c.Request.Context(), address, c.Param("id"), number, c.Request.Body)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getUpload godoc
+//
+//	@Summary		get upload session
+//	@Description	list the parts of an upload session received so far
+//	@Tags			upload
+//	@Produce		json
+//	@Param			id	path		string	true	"session id"
+//	@Success		200	{object}	controller.UploadSessionResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/upload/{id} [get]
+//	@Router			/ipfs/upload/{id} [get]
+func (h handler) getUploadHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	result, err := h.controller.GetUploadSession(c.Request.Context(), address, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// completeUpload godoc
+//
+//	@Summary		complete upload session
+//	@Description	join parts 1..n and store them as one object, the space check of the upload size is signed now
+//	@Tags			upload
+//	@Produce		json
+//	@Param			id		path		string	true	"session id"
+//	@Param			sign	query		string	true	"sign"
+//	@Success		200		{object}	controller.PutObjectResult
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/upload/{id}/complete [post]
+//	@Router			/ipfs/upload/{id}/complete [post]
+func (h handler) completeUploadHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	sign := c.Query("sign")
+	if sign == "" {
+		lerr := logs.ServerError{Message: "sign is empty"}
+		c.Error(lerr)
+		return
+	}
+
+	result, err := h.controller.CompleteUploadSession(c.Request.Context(), address, c.Param("id"), sign)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// abortUpload godoc
+//
+//	@Summary		abort upload session
+//	@Description	drop an upload session and the parts received
+//	@Tags			upload
+//	@Produce		json
+//	@Param			id	path		string	true	"session id"
+//	@Success		200	{object}	string
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/upload/{id} [delete]
+//	@Router			/ipfs/upload/{id} [delete]
+func (h handler) abortUploadHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	err = h.controller.AbortUploadSession(c.Request.Context(), address, c.Param("id"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": "success"})
+}
+
+// listObjects godoc
+//
+//	@Summary		listObjects
+//	@Description	listObjects
+//	@Tags			listObjects
+//	@Accept			json
+//	@Produce		json
+//	@Param			b			body		string	true	"body"
+//	@Param			prefix		query		string	false	"only the objects whose path starts with prefix"
+//	@Param			delimiter	query		string	false	"objects with the delimiter after the prefix are rolled up"
+//	@Param			cursor		query		string	false	"NextCursor of the previous page"
+//	@Param			limit		query		int		false	"objects of a page, 100 by default"
+//	@Param			sort		query		string	false	"name, size or modtime, upload order by default"
+//	@Param			order		query		string	false	"asc or desc"
+//	@Param			name		query		string	false	"part of the name"
+//	@Param			ctype		query		string	false	"content type, or its first part like image/"
+//	@Param			public		query		bool	false	"public objects only, or private ones"
+//	@Param			minSize		query		int		false	"smallest size"
+//	@Param			maxSize		query		int		false	"largest size"
+//	@Param			minWidth	query		int		false	"images at least this wide"
+//	@Param			minHeight	query		int		false	"images at least this high"
+//	@Param			minDuration	query		int		false	"audios at least this long, in seconds"
+//	@Param			maxDuration	query		int		false	"audios at most this long, in seconds"
+//	@Param			takenAfter	query		string	false	"photos taken from this RFC 3339 time"
+//	@Param			takenBefore	query		string	false	"photos taken before this RFC 3339 time"
+//	@Param			tag			query		string	false	"key or key:value of a tag, may be repeated"
+//	@Success		200			{object}	controller.ListObjectsResult
+//	@Failure		521			{object}	logs.APIError
+//	@Failure		400			{object}	logs.APIError
+//	@Router			/mefs/listObject/ [post]
+//	@Router			/ipfs/listObject/ [post]
+func (h handler) listObjectsHandle(c *gin.Context) {
+	address := c.GetString("address")
+
+	opts, err := parseListQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	result, err := h.controller.ListObjects(c.Request.Context(), address, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type folderRequest struct {
+	Path string `json:"path"`
+}
+
+type moveFolderRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// createFolder godoc
+//
+//	@Summary		create folder
+//	@Description	create a folder and its missing parents
+//	@Tags			folder
+//	@Accept			json
+//	@Produce		json
+//	@Param			b	body		folderRequest	true	"path"
+//	@Success		200	{object}	controller.FolderResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/folder [post]
+//	@Router			/ipfs/folder [post]
+func (h handler) createFolderHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req folderRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.controller.CreateFolder(c.Request.Context(), address, req.Path)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// listFolder godoc
+//
+//	@Summary		list folder
+//	@Description	list the folders then the objects right in a folder, sorted by name
+//	@Tags			folder
+//	@Produce		json
+//	@Param			path	query		string	false	"folder, the root by default"
+//	@Param			offset	query		int		false	"entries skipped"
+//	@Param			limit	query		int		false	"entries listed, 100 by default"
+//	@Success		200		{object}	controller.ListFolderResult
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/folder [get]
+//	@Router			/ipfs/folder [get]
+func (h handler) listFolderHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	offset := int(toInt64(c.Query("offset")))
+	limit := int(toInt64(c.DefaultQuery("limit", "100")))
+	if offset < 0 || limit < 1 || limit > 1000 {
+		c.Error(logs.ServerError{Message: "limit should be between 1 and 1000"})
+		return
+	}
+
+	result, err := h.controller.ListFolder(c.Request.Context(), address, c.DefaultQuery("path", "/"), offset, limit)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// moveFolder godoc
+//
+//	@Summary		move folder
+//	@Description	rename a folder or move it under another one, with everything it holds
+//	@Tags			folder
+//	@Accept			json
+//	@Produce		json
+//	@Param			b	body		moveFolderRequest	true	"from and to"
+//	@Success		200	{object}	controller.FolderResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/folder/move [post]
+//	@Router			/ipfs/folder/move [post]
+func (h handler) moveFolderHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req moveFolderRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.controller.MoveFolder(c.Request.Context(), address, req.From, req.To)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// deleteFolder godoc
+//
+//	@Summary		delete folder
+//	@Description	delete a folder, a folder not empty is deleted with its objects when recursive is set
+//	@Tags			folder
+//	@Produce		json
+//	@Param			path		query		string	true	"folder"
+//	@Param			recursive	query		bool	false	"delete what the folder holds"
+//	@Success		200			{object}	string
+//	@Failure		521			{object}	logs.APIError
+//	@Failure		525			{object}	logs.APIError
+//	@Router			/mefs/folder [delete]
+//	@Router			/ipfs/folder [delete]
+func (h handler) deleteFolderHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	recursive, _ := strconv.ParseBool(c.Query("recursive"))
+	err = h.controller.DeleteFolder(c.Request.Context(), address, c.Query("path"), recursive)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": "success"})
+}
+
+// deleteObjec godoc
+//
+//	@Summary		deleteObjec
+//	@Description	move an object into the trash, it is purged once the trash retention is over
+//	@Tags			deleteObjec
+//	@Accept			json
+//	@Produce		json
+//	@Param			b	body		string	true	"body"
+//	@Param			id	query		string	true	"id"
+//	@Success		200	{object}	string	"file id"
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		400	{object}	logs.APIError
+//	@Router			/mefs/deleteObject [post]
+//	@Router			/ipfs/deleteObject [post]
+func (h handler) deleteObjectHandle(c *gin.Context) {
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	address := c.GetString("address")
+	id := c.Query("id")
+
+	err = h.controller.DeleteObject(c.Request.Context(), address, int(toInt64(id)))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": "success"})
+}
+
+// patchObject godoc
+//
+//	@Summary		patch object metadata
+//	@Description	change the metadata and tags of an object, a null value removes its key
+//	@Tags			objectMeta
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int						true	"file id"
+//	@Param			b	body		controller.MetaPatch	true	"meta and tags"
+//	@Success		200	{object}	controller.ObjectInfoResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id} [patch]
+//	@Router			/ipfs/object/{id} [patch]
+func (h handler) patchObjectHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var patch controller.MetaPatch
+	err = c.ShouldBindJSON(&patch)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.controller.PatchObjectMeta(c.Request.Context(), address, int(toInt64(c.Param("id"))), patch)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+type objectTargetRequest struct {
+	// Path is the target folder, the current one when renaming
+	Path string `json:"path"`
+	// Name is the target name, the current one when empty on move or copy
+	Name string `json:"name"`
+}
+
+// renameObject godoc
+//
+//	@Summary		rename object
+//	@Description	give an object a new name in its folder
+//	@Tags			objectName
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int					true	"file id"
+//	@Param			b	body		objectTargetRequest	true	"name"
+//	@Success		200	{object}	controller.ObjectInfoResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/rename [post]
+//	@Router			/ipfs/object/{id}/rename [post]
+func (h handler) renameObjectHandle(c *gin.Context) {
+	h.objectTargetHandle(c, func(ctx context.Context, address string, id int, req objectTargetRequest) (controller.ObjectInfoResult, error) {
+		return h.controller.RenameObject(ctx, address, id, req.Name)
+	})
+}
+
+// moveObject godoc
+//
+//	@Summary		move object
+//	@Description	move an object into another folder, renaming it when a name is given
+//	@Tags			objectName
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int					true	"file id"
+//	@Param			b	body		objectTargetRequest	true	"path and name"
+//	@Success		200	{object}	controller.ObjectInfoResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/move [post]
+//	@Router			/ipfs/object/{id}/move [post]
+func (h handler) moveObjectHandle(c *gin.Context) {
+	h.objectTargetHandle(c, func(ctx context.Context, address string, id int, req objectTargetRequest) (controller.ObjectInfoResult, error) {
+		return h.controller.MoveObject(ctx, address, id, req.Path, req.Name)
+	})
+}
+
+// copyObject godoc
+//
+//	@Summary		copy object
+//	@Description	copy an object to another folder or name, the copy shares the stored content and is not charged
+//	@Tags			objectName
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int					true	"file id"
+//	@Param			b	body		objectTargetRequest	true	"path and name"
+//	@Success		200	{object}	controller.ObjectInfoResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/copy [post]
+//	@Router			/ipfs/object/{id}/copy [post]
+func (h handler) copyObjectHandle(c *gin.Context) {
+	h.objectTargetHandle(c, func(ctx context.Context, address string, id int, req objectTargetRequest) (controller.ObjectInfoResult, error) {
+		return h.controller.CopyObject(ctx, address, id, req.Path, req.Name)
+	})
+}
+
+func (h handler) objectTargetHandle(c *gin.Context, do func(context.Context, string, int, objectTargetRequest) (controller.ObjectInfoResult, error)) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req objectTargetRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	result, err := do(c.Request.Context(), address, int(toInt64(c.Param("id"))), req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getArchive godoc
+//
+//	@Summary		get archive
+//	@Description	download objects, by ids or under a folder, as one zip or tar archive; the traffic of them all is checked at once
+//	@Tags			getObject
+//	@Accept			json
+//	@Produce		octet-stream
+//	@Param			sign	query		string						true	"sign of the traffic check of the objects size"
+//	@Param			b		body		controller.ArchiveRequest	true	"objects and format"
+//	@Success		200		{object}	string
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/archive [post]
+//	@Router			/ipfs/archive [post]
+func (h handler) getArchiveHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	sign := c.Query("sign")
+	if sign == "" {
+		c.Error(logs.ServerError{Message: "sign is empty"})
+		return
+	}
+
+	var req controller.ArchiveRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	archive, err := h.controller.PrepareArchive(c.Request.Context(), address, sign, req)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", archive.Name))
+	header.Set("Content-Type", utils.ArchiveType(archive.Format))
+	c.Status(http.StatusOK)
+
+	err = h.controller.WriteArchive(c.Request.Context(), archive, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			clearObjectHeaders(header)
+			c.Error(err)
+			return
+		}
+		logger.Error("get archive error: ", err)
+	}
+}
+
+// batch
+
+// batchObjects godoc
+//
+//	@Summary		batch objects
+//	@Description	delete, share or change the metadata of many objects at once, the result of each one is reported
+//	@Tags			batch
+//	@Accept			json
+//	@Produce		json
+//	@Param			b	body		controller.BatchRequest	true	"operation and file ids"
+//	@Success		200	{object}	controller.BatchResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/batch [post]
+//	@Router			/ipfs/batch [post]
+func (h handler) batchObjectsHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req controller.BatchRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		c.Error(logs.ServerError{Message: err.Error()})
+		return
+	}
+
+	result, err := h.controller.BatchObjects(c.Request.Context(), address, req, shareObject)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// shareObject makes the share link of a file as the share api does
+func shareObject(fi api.FileInfo, expire int64) (string, error) {
+	return share.CreateShare(fi.Address, fi.ChainID, share.CreateShareRequest{
+		MID:         fi.Mid,
+		SType:       storage.StorageType(fi.SType),
+		ExpiredTime: expire,
+	})
+}
+
+// versions
+
+// listVersions godoc
+//
+//	@Summary		list versions
+//	@Description	list the versions of an object, the last one first
+//	@Tags			version
+//	@Produce		json
+//	@Param			id	path		int	true	"file id of any version"
+//	@Success		200	{object}	controller.ListVersionsResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/versions [get]
+//	@Router			/ipfs/object/{id}/versions [get]
+func (h handler) listVersionsHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	result, err := h.controller.ListVersions(c.Request.Context(), address, int(toInt64(c.Param("id"))))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// rollbackObject godoc
+//
+//	@Summary		roll back object
+//	@Description	make a version the current one of its object, the current one is kept as an older version
+//	@Tags			version
+//	@Produce		json
+//	@Param			id	path		int	true	"file id of the version"
+//	@Success		200	{object}	controller.ObjectInfoResult
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/rollback [post]
+//	@Router			/ipfs/object/{id}/rollback [post]
+func (h handler) rollbackObjectHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	result, err := h.controller.RollbackObject(c.Request.Context(), address, int(toInt64(c.Param("id"))))
+	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	size := file.Size
+	c.JSON(http.StatusOK, result)
+}
 
-	object := file.Filename
-	ud := make(map[string]string)
+// getVersion godoc
+//
+//	@Summary		get version
+//	@Description	download a version of an object by its file id, as getObject does
+//	@Tags			version
+//	@Produce		octet-stream
+//	@Param			id		path		int		true	"file id of the version"
+//	@Param			sign	query		string	true	"sign"
+//	@Param			Range	header		string	false	"single byte range, sign the traffic check for its length"
+//	@Success		200		{object}	string
+//	@Success		206		{object}	string	"partial content"
+//	@Failure		416		{object}	string	"range not satisfiable"
+//	@Failure		521		{object}	logs.APIError
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/object/{id}/getObject [post]
+//	@Router			/ipfs/object/{id}/getObject [post]
+func (h handler) getVersionHandle(c *gin.Context) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
 
-	fr, err := file.Open()
+	sign := c.Query("sign")
+	if sign == "" {
+		c.Error(logs.ServerError{Message: "sign is empty"})
+		return
+	}
+
+	cid, info, err := h.controller.GetVersionInfo(c.Request.Context(), address, int(toInt64(c.Param("id"))))
 	if err != nil {
-		err = logs.ServerError{Message: "open file error"}
 		c.Error(err)
 		return
 	}
 
-	sign := c.PostForm("sign")
-	area := c.PostForm("area")
+	h.serveObject(c, address, cid, sign, info)
+}
 
-	if sign == "" {
-		lerr := logs.ServerError{Message: "sign is empty"}
-		c.Error(lerr)
+// derivatives
+
+// getThumbnail godoc
+//
+//	@Summary		get thumbnail
+//	@Description	get the jpeg thumbnail of an image, it is made in the background after the upload and is not charged to the traffic
+//	@Tags			derivative
+//	@Produce		jpeg
+//	@Param			id	path		int	true	"file id"
+//	@Success		200	{object}	string
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/thumbnail [get]
+//	@Router			/ipfs/object/{id}/thumbnail [get]
+func (h handler) getThumbnailHandle(c *gin.Context) {
+	h.serveDerivative(c, controller.DerivedThumbnail)
+}
+
+// getPreview godoc
+//
+//	@Summary		get preview
+//	@Description	get the start of a text file, it is made in the background after the upload and is not charged to the traffic
+//	@Tags			derivative
+//	@Produce		plain
+//	@Param			id	path		int	true	"file id"
+//	@Success		200	{object}	string
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/object/{id}/preview [get]
+//	@Router			/ipfs/object/{id}/preview [get]
+func (h handler) getPreviewHandle(c *gin.Context) {
+	h.serveDerivative(c, controller.DerivedPreview)
+}
+
+// serveDerivative streams the derivative kind of the object of the request
+func (h handler) serveDerivative(c *gin.Context, kind string) {
+	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
 		return
 	}
 
-	result, err := h.controller.PutObject(c.Request.Context(), address, object, fr, controller.ObjectOptions{Size: size, UserDefined: ud, Sign: sign, Area: area})
+	d, err := h.controller.GetDerivative(c.Request.Context(), address, int(toInt64(c.Param("id"))), kind)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	header := c.Writer.Header()
+	header.Set("ETag", "\""+d.Mid+"\"")
+	header.Set("Cache-Control", "private, max-age=86400")
+	if code := utils.CheckPreconditions(c.Request, d.Mid, d.Updated); code != 0 {
+		c.Status(code)
+		return
+	}
+	header.Set("Content-Type", d.ContentType)
+	header.Set("Content-Length", strconv.FormatInt(d.Size, 10))
+	c.Status(http.StatusOK)
+
+	err = h.controller.WriteDerivative(c.Request.Context(), d, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			clearObjectHeaders(header)
+			c.Error(err)
+			return
+		}
+		logger.Error("get "+kind+" error: ", err)
+	}
 }
 
-// getObject godoc
+// trash
+
+// listTrash godoc
 //
-//	@Summary		getObject
-//	@Description	getObject
-//	@Tags			getObject
-//	@Accept			json
+//	@Summary		list trash
+//	@Description	list the deleted objects kept in the trash, the last deleted first
+//	@Tags			trash
 //	@Produce		json
-//	@Param			b		body		string	true	"body"
-//	@Param			sign	query		string	true	"sign"
-//	@Param			cid		path		string	true	"cid"
-//	@Success		200		{object}	string	"file id"
+//	@Param			offset	query		int	false	"objects skipped"
+//	@Param			limit	query		int	false	"objects listed, 100 by default"
+//	@Success		200		{object}	controller.ListTrashResult
 //	@Failure		521		{object}	logs.APIError
-//	@Failure		400		{object}	logs.APIError
-//	@Router			/mefs/getObject/{cid} [post]
-//	@Router			/ipfs/getObject/{cid} [post]
-func (h handler) getObjectHandle(c *gin.Context) {
+//	@Failure		525		{object}	logs.APIError
+//	@Router			/mefs/trash [get]
+//	@Router			/ipfs/trash [get]
+func (h handler) listTrashHandle(c *gin.Context) {
+	address := c.GetString("address")
 	err := h.getStore(c)
 	if err != nil {
 		return
 	}
 
-	cid := c.Param("cid")
-	address := c.GetString("address")
-
-	sign := c.Query("sign")
-
-	if sign == "" {
-		lerr := logs.ServerError{Message: "sign is empty"}
-		c.Error(lerr)
+	offset := int(toInt64(c.Query("offset")))
+	limit := int(toInt64(c.DefaultQuery("limit", "100")))
+	if offset < 0 || limit < 1 || limit > 1000 {
+		c.Error(logs.ServerError{Message: "limit should be between 1 and 1000"})
 		return
 	}
 
-	var w bytes.Buffer
-	result, err := h.controller.GetObject(c.Request.Context(), address, cid, &w, controller.ObjectOptions{Sign: sign})
+	result, err := h.controller.ListTrash(c.Request.Context(), address, offset, limit)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	head := fmt.Sprintf("attachment; filename=\"%s\"", result.Name)
-	extraHeaders := map[string]string{
-		"Content-Disposition": head,
-	}
-
-	c.DataFromReader(http.StatusOK, result.Size, result.CType, &w, extraHeaders)
+	c.JSON(http.StatusOK, result)
 }
 
-// listObjects godoc
+// restoreObject godoc
 //
-//	@Summary		listObjects
-//	@Description	listObjects
-//	@Tags			listObjects
+//	@Summary		restore object
+//	@Description	take an object out of the trash, where it was deleted from unless a path or a name is given
+//	@Tags			trash
 //	@Accept			json
 //	@Produce		json
-//	@Param			b	body		string	true	"body"
-//	@Success		200	{object}	string	"objs"
+//	@Param			id	path		int					true	"file id"
+//	@Param			b	body		objectTargetRequest	false	"path and name"
+//	@Success		200	{object}	controller.ObjectInfoResult
 //	@Failure		521	{object}	logs.APIError
-//	@Failure		400	{object}	logs.APIError
-//	@Router			/mefs/listObject/ [post]
-//	@Router			/ipfs/listObject/ [post]
-func (h handler) listObjectsHandle(c *gin.Context) {
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/trash/{id}/restore [post]
+//	@Router			/ipfs/trash/{id}/restore [post]
+func (h handler) restoreObjectHandle(c *gin.Context) {
 	address := c.GetString("address")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	var req objectTargetRequest
+	if c.Request.ContentLength != 0 {
+		err = c.ShouldBindJSON(&req)
+		if err != nil {
+			c.Error(logs.ServerError{Message: err.Error()})
+			return
+		}
+	}
 
-	result, err := h.controller.ListObjects(c.Request.Context(), address)
+	result, err := h.controller.RestoreObject(c.Request.Context(), address, int(toInt64(c.Param("id"))), req.Path, req.Name)
 	if err != nil {
 		c.Error(err)
 		return
@@ -171,36 +1208,59 @@ func (h handler) listObjectsHandle(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
-// deleteObjec godoc
+// purgeObject godoc
 //
-//	@Summary		deleteObjec
-//	@Description	deleteObjec
-//	@Tags			deleteObjec
-//	@Accept			json
+//	@Summary		purge object
+//	@Description	delete an object of the trash from the storage now
+//	@Tags			trash
 //	@Produce		json
-//	@Param			b	body		string	true	"body"
-//	@Param			id	query		string	true	"id"
-//	@Success		200	{object}	string	"file id"
+//	@Param			id	path		int	true	"file id"
+//	@Success		200	{object}	string
 //	@Failure		521	{object}	logs.APIError
-//	@Failure		400	{object}	logs.APIError
-//	@Router			/mefs/deleteObject [post]
-//	@Router			/ipfs/deleteObject [post]
-func (h handler) deleteObjectHandle(c *gin.Context) {
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/trash/{id} [delete]
+//	@Router			/ipfs/trash/{id} [delete]
+func (h handler) purgeObjectHandle(c *gin.Context) {
+	address := c.GetString("address")
 	err := h.getStore(c)
 	if err != nil {
 		return
 	}
 
+	err = h.controller.PurgeObject(c.Request.Context(), address, int(toInt64(c.Param("id"))))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"state": "success"})
+}
+
+// emptyTrash godoc
+//
+//	@Summary		empty trash
+//	@Description	delete every object of the trash from the storage now
+//	@Tags			trash
+//	@Produce		json
+//	@Success		200	{object}	string	"number of objects purged"
+//	@Failure		521	{object}	logs.APIError
+//	@Failure		525	{object}	logs.APIError
+//	@Router			/mefs/trash [delete]
+//	@Router			/ipfs/trash [delete]
+func (h handler) emptyTrashHandle(c *gin.Context) {
 	address := c.GetString("address")
-	id := c.Query("id")
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
 
-	err = h.controller.DeleteObject(c.Request.Context(), address, int(toInt64(id)))
+	n, err := h.controller.EmptyTrash(c.Request.Context(), address)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"state": "success"})
+	c.JSON(http.StatusOK, gin.H{"state": "success", "purged": n})
 }
 
 // account
@@ -226,6 +1286,108 @@ func (h handler) getBalanceHandle(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"Address": address, "Balance": balance.String()})
 }
 
+// storageInfo godoc
+//
+//	@Summary		storage info
+//	@Description	the space and the files of the address on the storage, with the space it bought and what is left of it on all the storages
+//	@Tags			storageInfo
+//	@Produce		json
+//	@Success		200	{object}	api.StorageInfo
+//	@Failure		521	{object}	logs.APIError
+//	@Router			/mefs/storageInfo [get]
+//	@Router			/ipfs/storageInfo [get]
+func (h handler) storageInfoHandle(c *gin.Context) {
+	address := c.GetString("address")
+	info, err := h.controller.StorageInfo(c.Request.Context(), address)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// ledger godoc
+//
+//	@Summary		ledger
+//	@Description	the uploads, downloads and share downloads of the files of the address on the storage, summed up by day or by month
+//	@Tags			ledger
+//	@Produce		json
+//	@Param			period	query		string	false	"day or month, day by default"
+//	@Param			from	query		string	false	"RFC 3339 time of the first transfer"
+//	@Param			to		query		string	false	"RFC 3339 time the transfers are before"
+//	@Param			kind	query		string	false	"upload, download or share"
+//	@Param			file	query		int		false	"only this file id"
+//	@Param			by		query		string	false	"file to sum up each file apart"
+//	@Success		200		{object}	controller.LedgerResult
+//	@Failure		521		{object}	logs.APIError
+//	@Router			/mefs/ledger [get]
+//	@Router			/ipfs/ledger [get]
+func (h handler) ledgerHandle(c *gin.Context) {
+	address := c.GetString("address")
+	opts, err := parseLedgerQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	result, err := h.controller.Ledger(c.Request.Context(), address, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// statement godoc
+//
+//	@Summary		statement
+//	@Description	what the address bought, cashed out and transferred in a month or a period, the csv has a line of totals
+//	@Tags			statement
+//	@Produce		json,text/csv
+//	@Param			month	query		string	false	"month like 2006-01, the current one by default"
+//	@Param			from	query		string	false	"RFC 3339 start of the period, instead of a month"
+//	@Param			to		query		string	false	"RFC 3339 end of the period, instead of a month"
+//	@Param			format	query		string	false	"json or csv, json by default"
+//	@Success		200		{object}	controller.Statement
+//	@Failure		521		{object}	logs.APIError
+//	@Router			/mefs/statement [get]
+//	@Router			/ipfs/statement [get]
+func (h handler) statementHandle(c *gin.Context) {
+	address := c.GetString("address")
+	from, to, format, err := parseStatementQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	statements, err := h.controller.Statements(c.Request.Context(), address, from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, statements[0])
+		return
+	}
+	writeStatementsCSV(c, statements)
+}
+
+// writeStatementsCSV sends the statements as a csv file named by their
+// period
+func writeStatementsCSV(c *gin.Context, statements []controller.Statement) {
+	name := "statement.csv"
+	if len(statements) > 0 {
+		name = fmt.Sprintf("statement-%s.csv", statements[0].From.Format("2006-01-02"))
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", name))
+	c.Status(http.StatusOK)
+	err := controller.WriteStatementsCSV(c.Writer, statements)
+	if err != nil {
+		logger.Error("write statements error:", err)
+	}
+}
+
 // getSpaceInfo godoc
 //
 //	@Summary		getSpaceInfo
@@ -493,9 +1655,10 @@ func (h handler) getAllowanceHandle(c *gin.Context) {
 //	@Failure		521		{object}	logs.APIError
 //	@Router			/mefs/getReceipt [get]
 func (h handler) checkReceiptHandle(c *gin.Context) {
+	address := c.GetString("address")
 	receipt := c.Query("receipt")
 
-	err := h.controller.CheckReceipt(c.Request.Context(), receipt)
+	err := h.controller.CheckReceipt(c.Request.Context(), address, receipt)
 	if err != nil {
 		c.Error(err)
 		return
@@ -546,3 +1709,189 @@ func (h handler) cashTrafficHandle(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, res)
 }
+
+// listPins godoc
+//
+//	@Summary		list pins
+//	@Description	list the pins of the ipfs files as the ipfs pinning service api does
+//	@Tags			pins
+//	@Produce		json
+//	@Param			cid		query		string	false	"comma separated cids, at most 10"
+//	@Param			name	query		string	false	"pin name"
+//	@Param			match	query		string	false	"exact, iexact, partial or ipartial"
+//	@Param			status	query		string	false	"comma separated statuses"
+//	@Param			before	query		string	false	"RFC 3339 time"
+//	@Param			after	query		string	false	"RFC 3339 time"
+//	@Param			limit	query		int		false	"max results, 10 by default"
+//	@Param			meta	query		string	false	"json object the pin meta must match"
+//	@Success		200		{object}	controller.PinResults
+//	@Failure		400		{object}	logs.APIError
+//	@Router			/ipfs/pins [get]
+func (h handler) listPinsHandle(c *gin.Context) {
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	q, err := parsePinQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	address := c.GetString("address")
+	result, err := h.controller.ListPins(c.Request.Context(), address, q)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getPin godoc
+//
+//	@Summary		get pin
+//	@Description	get the pin status of an ipfs file, the request id is the file id
+//	@Tags			pins
+//	@Produce		json
+//	@Param			requestid	path		string	true	"request id"
+//	@Success		200			{object}	controller.PinStatus
+//	@Failure		400			{object}	logs.APIError
+//	@Router			/ipfs/pins/{requestid} [get]
+func (h handler) getPinHandle(c *gin.Context) {
+	err := h.getStore(c)
+	if err != nil {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("requestid"))
+	if err != nil {
+		c.Error(logs.ControllerError{Message: "invalid request id"})
+		return
+	}
+
+	address := c.GetString("address")
+	result, err := h.controller.GetPin(c.Request.Context(), address, id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// admin
+
+// listUsage godoc
+//
+//	@Summary		list usage
+//	@Description	the space and the files of each address on each storage, it needs the admin token
+//	@Tags			admin
+//	@Produce		json
+//	@Param			address	query		string	false	"only this address"
+//	@Success		200		{array}		api.Usage
+//	@Failure		401		{object}	logs.APIError
+//	@Router			/admin/usage [get]
+func (h handler) listUsageHandle(c *gin.Context) {
+	usage, err := h.controller.ListUsage(c.Request.Context(), c.Query("address"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// rebuildUsage godoc
+//
+//	@Summary		rebuild usage
+//	@Description	count the usage of every address again from all the files, it needs the admin token
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		api.Usage
+//	@Failure		401	{object}	logs.APIError
+//	@Router			/admin/usage/rebuild [post]
+func (h handler) rebuildUsageHandle(c *gin.Context) {
+	ctx := c.Request.Context()
+	err := h.controller.RebuildUsage(ctx)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	usage, err := h.controller.ListUsage(ctx, "")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// sumLedger godoc
+//
+//	@Summary		sum ledger
+//	@Description	the transfers of each address, or of one, summed up by day or by month, the most bytes first in a period, it needs the admin token
+//	@Tags			admin
+//	@Produce		json
+//	@Param			address	query		string	false	"only this address"
+//	@Param			period	query		string	false	"day or month, day by default"
+//	@Param			from	query		string	false	"RFC 3339 time of the first transfer"
+//	@Param			to		query		string	false	"RFC 3339 time the transfers are before"
+//	@Param			kind	query		string	false	"upload, download or share"
+//	@Success		200		{array}		api.LedgerSum
+//	@Failure		401		{object}	logs.APIError
+//	@Router			/admin/ledger [get]
+func (h handler) sumLedgerHandle(c *gin.Context) {
+	opts, err := parseLedgerQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	sums, err := h.controller.SumLedger(c.Request.Context(), api.LedgerQuery{
+		Address: c.Query("address"),
+		FileID:  opts.FileID,
+		Kind:    opts.Kind,
+		From:    opts.From,
+		To:      opts.To,
+		Period:  opts.Period,
+		ByFile:  opts.ByFile,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, sums)
+}
+
+// listStatements godoc
+//
+//	@Summary		list statements
+//	@Description	the statements of each address with a purchase, a cash-out or a transfer in a month or a period, it needs the admin token
+//	@Tags			admin
+//	@Produce		json,text/csv
+//	@Param			address	query		string	false	"only this address"
+//	@Param			month	query		string	false	"month like 2006-01, the current one by default"
+//	@Param			from	query		string	false	"RFC 3339 start of the period, instead of a month"
+//	@Param			to		query		string	false	"RFC 3339 end of the period, instead of a month"
+//	@Param			format	query		string	false	"json or csv, json by default"
+//	@Success		200		{array}		controller.Statement
+//	@Failure		401		{object}	logs.APIError
+//	@Router			/admin/statements [get]
+func (h handler) listStatementsHandle(c *gin.Context) {
+	from, to, format, err := parseStatementQuery(c)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	statements, err := h.controller.Statements(c.Request.Context(), c.Query("address"), from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if format == "json" {
+		c.JSON(http.StatusOK, statements)
+		return
+	}
+	writeStatementsCSV(c, statements)
+}
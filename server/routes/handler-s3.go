@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"context"
+	"io"
+
+	"github.com/memoio/backend/api"
+	auth "github.com/memoio/backend/internal/authentication"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/server/routes/controller"
+)
+
+// putS3Object stores an object sent to the s3 front-end through the
+// controller on the storage st, so it is handled as the objects put through
+// the api. The key of an encrypted object is wrapped to the key of did.
+func (h handler) putS3Object(ctx context.Context, address, did string, st api.StorageType, object string, r io.Reader, opts api.ObjectOptions) (string, error) {
+	store, err := loadStore(st)
+	if err != nil {
+		return "", err
+	}
+	ctl := h.controller.WithStore(store)
+
+	if opts.Encrypt || ctl.EncryptByDefault() {
+		key, err := auth.PublicKey(did)
+		if err != nil {
+			return "", logs.ServerError{Message: err.Error()}
+		}
+		opts.Encrypt = true
+		opts.OwnerKey = key
+	}
+
+	result, err := ctl.PutObject(ctx, address, object, r, controller.ObjectOptions(opts))
+	return result.Mid, err
+}
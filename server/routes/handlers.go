@@ -1,8 +1,14 @@
 package routes
 
 import (
+	"context"
+	"sync"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/config"
 	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/internal/repair"
 	"github.com/memoio/backend/server/routes/controller"
 )
 
@@ -22,14 +28,114 @@ func newHandler() *handler {
 	}
 }
 
+var (
+	handlerOnce   sync.Once
+	sharedHandler *handler
+)
+
+// loadHandler returns the handler shared by the api and the s3 server,
+// the controller owns the datastore so it is created only once
+func loadHandler() *handler {
+	handlerOnce.Do(func() {
+		sharedHandler = newHandler()
+	})
+	return sharedHandler
+}
+
+var (
+	repairOnce   sync.Once
+	repairWorker *repair.Worker
+)
+
+// LoadRepairWorker returns the worker checking the replicas, it is started
+// by the daemon and reported on by the admin api
+func LoadRepairWorker() *repair.Worker {
+	repairOnce.Do(func() {
+		interval, err := time.ParseDuration(config.Cfg.Storage.Repair.Interval)
+		if err != nil || interval <= 0 {
+			logger.Warnf("invalid repair interval %q, use 1h", config.Cfg.Storage.Repair.Interval)
+			interval = time.Hour
+		}
+		repairWorker = repair.NewWorker(resolveReplica, interval)
+	})
+	return repairWorker
+}
+
+// StartPinning starts the remote pinning of the ipfs uploads
+func StartPinning(ctx context.Context) {
+	loadHandler().controller.StartPinning(ctx)
+}
+
+// StartTrash starts purging the deleted files whose trash retention is over
+func StartTrash(ctx context.Context) {
+	interval, err := time.ParseDuration(config.Cfg.Storage.Trash.Interval)
+	if err != nil || interval <= 0 {
+		logger.Warnf("invalid trash interval %q, use 1h", config.Cfg.Storage.Trash.Interval)
+		interval = time.Hour
+	}
+	loadHandler().controller.StartTrash(ctx, interval, loadStore)
+}
+
+// StartDerivatives starts making the thumbnails and previews of the uploads
+func StartDerivatives(ctx context.Context) {
+	loadHandler().controller.StartDerivatives(ctx, loadStore)
+}
+
+// handlePins registers the pinning service api of a pinning store
+func (h *handler) handlePins(r *gin.RouterGroup) {
+	r.GET("/pins", h.listPinsHandle)
+	r.GET("/pins/:requestid", h.getPinHandle)
+}
+
+// handleAdmin registers the admin api of the files of all the addresses
+func (h *handler) handleAdmin(r *gin.RouterGroup) {
+	r.GET("/usage", h.listUsageHandle)
+	r.POST("/usage/rebuild", h.rebuildUsageHandle)
+	r.GET("/ledger", h.sumLedgerHandle)
+	r.GET("/statements", h.listStatementsHandle)
+}
+
 func (h *handler) handleStorage(r *gin.RouterGroup) {
 	// OBJ
 	r.POST("/putObject/", h.putObjectHandle)
 	r.POST("/getObject/:cid", h.getObjectHandle)
+	r.POST("/archive", h.getArchiveHandle)
 	r.POST("/listObject", h.listObjectsHandle)
 	r.POST("/deleteObject", h.deleteObjectHandle)
+	r.PATCH("/object/:id", h.patchObjectHandle)
+	r.POST("/object/:id/rename", h.renameObjectHandle)
+	r.POST("/object/:id/move", h.moveObjectHandle)
+	r.POST("/object/:id/copy", h.copyObjectHandle)
+	r.GET("/object/:id/versions", h.listVersionsHandle)
+	r.POST("/object/:id/rollback", h.rollbackObjectHandle)
+	r.POST("/object/:id/getObject", h.getVersionHandle)
+	r.GET("/object/:id/thumbnail", h.getThumbnailHandle)
+	r.GET("/object/:id/preview", h.getPreviewHandle)
+	r.POST("/batch", h.batchObjectsHandle)
+
+	// folder
+	r.POST("/folder", h.createFolderHandle)
+	r.GET("/folder", h.listFolderHandle)
+	r.POST("/folder/move", h.moveFolderHandle)
+	r.DELETE("/folder", h.deleteFolderHandle)
+
+	// trash
+	r.GET("/trash", h.listTrashHandle)
+	r.POST("/trash/:id/restore", h.restoreObjectHandle)
+	r.DELETE("/trash/:id", h.purgeObjectHandle)
+	r.DELETE("/trash", h.emptyTrashHandle)
+
+	// resumable upload
+	r.POST("/upload", h.createUploadHandle)
+	r.GET("/upload/:id", h.getUploadHandle)
+	r.PUT("/upload/:id/:number", h.putUploadPartHandle)
+	r.POST("/upload/:id/complete", h.completeUploadHandle)
+	r.DELETE("/upload/:id", h.abortUploadHandle)
 
 	r.POST("/getBalance", h.getBalanceHandle)
+	r.GET("/storageInfo", h.storageInfoHandle)
+	r.GET("/ledger", h.ledgerHandle)
+	r.GET("/statement", h.statementHandle)
 
 	// package
 	r.POST("/getSpaceInfo", h.getSpaceInfoHandle)
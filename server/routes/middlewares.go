@@ -1,13 +1,20 @@
 package routes
 
 import (
+	"context"
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/memoio/backend/api"
 	"github.com/memoio/backend/config"
+	"github.com/memoio/backend/internal/database"
 	"github.com/memoio/backend/internal/gateway/ipfs"
+	"github.com/memoio/backend/internal/gateway/local"
 	"github.com/memoio/backend/internal/gateway/mefs"
+	"github.com/memoio/backend/internal/gateway/qiniu"
+	"github.com/memoio/backend/internal/gateway/replica"
 	"github.com/memoio/backend/internal/logs"
 )
 
@@ -43,6 +50,19 @@ func ErrorHandler() gin.HandlerFunc {
 	}
 }
 
+// VerifyAdminHandler lets through the requests carrying the admin token of
+// the config as bearer token
+func VerifyAdminHandler(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	admin := config.Cfg.AdminToken
+	if admin == "" || subtle.ConstantTimeCompare([]byte(token), []byte(admin)) != 1 {
+		errRes := logs.ToAPIErrorCode(logs.AuthenticationFailed{Message: "admin token is not right"})
+		c.AbortWithStatusJSON(errRes.HTTPStatusCode, errRes)
+		return
+	}
+	c.Next()
+}
+
 func LoadMefsHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ui := api.USerInfo{
@@ -52,6 +72,8 @@ func LoadMefsHandler() gin.HandlerFunc {
 		store, err := mefs.NewGatewayWith(ui)
 		if err != nil {
 			logger.Error("init mefs error:", err)
+		} else {
+			store = withReplicas(c.Request.Context(), store)
 		}
 		c.Set("store", store)
 	}
@@ -62,7 +84,130 @@ func LoadIpfsHandler() gin.HandlerFunc {
 		store, err := ipfs.NewGateway()
 		if err != nil {
 			logger.Error("init ipfs error:", err)
+		} else {
+			store = withReplicas(c.Request.Context(), store)
+		}
+		c.Set("store", store)
+	}
+}
+
+func LoadLocalHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := local.NewGateway()
+		if err != nil {
+			logger.Error("init local error:", err)
+		} else {
+			store = withReplicas(c.Request.Context(), store)
+		}
+		c.Set("store", store)
+	}
+}
+
+func LoadQiniuHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store, err := qiniu.NewGateway()
+		if err != nil {
+			logger.Error("init qiniu error:", err)
+		} else {
+			store = withReplicas(c.Request.Context(), store)
 		}
 		c.Set("store", store)
 	}
 }
+
+// newStore returns the gateway of storage type st
+func newStore(st api.StorageType) (api.IGateway, error) {
+	switch st {
+	case api.MEFS:
+		ui := api.USerInfo{
+			Api:   config.Cfg.Storage.Mefs.Api,
+			Token: config.Cfg.Storage.Mefs.Token,
+		}
+		return mefs.NewGatewayWith(ui)
+	case api.IPFS:
+		return ipfs.NewGateway()
+	case api.LOCAL:
+		if !config.Cfg.Storage.Local.Enable {
+			return nil, logs.StorageNotSupport{}
+		}
+		return local.NewGateway()
+	case api.QINIU:
+		if !config.Cfg.Storage.Qiniu.Enable {
+			return nil, logs.StorageNotSupport{}
+		}
+		return qiniu.NewGateway()
+	default:
+		return nil, logs.StorageNotSupport{}
+	}
+}
+
+// loadStore returns the gateway of storage type st with its replicas
+func loadStore(st api.StorageType) (api.IGateway, error) {
+	store, err := newStore(st)
+	if err != nil {
+		return nil, err
+	}
+	return withReplicas(context.Background(), store), nil
+}
+
+// withReplicas wraps store in the replication policy of its storage, store
+// is returned as is when there is none or a replica cannot be loaded
+func withReplicas(ctx context.Context, store api.IGateway) api.IGateway {
+	rc := config.Cfg.Storage.Replica
+	if !rc.Enable {
+		return store
+	}
+	st := store.GetStoreType(ctx)
+	policy := rc.Policies[st.String()]
+	if len(policy) == 0 {
+		return store
+	}
+
+	others := make([]replica.Backend, 0, len(policy))
+	for _, rb := range policy {
+		b, err := newReplicaBackend(ctx, rb)
+		if err != nil {
+			logger.Error("init replica error:", err)
+			return store
+		}
+		others = append(others, b)
+	}
+
+	db := database.NewDataBase()
+	primary := replica.Backend{Name: st.String(), G: store}
+	return replica.NewGateway(primary, others, db.ListObjectReplicasByMid)
+}
+
+func newReplicaBackend(ctx context.Context, rb config.ReplicaBackend) (replica.Backend, error) {
+	st, ok := api.ParseStorageType(rb.Storage)
+	if !ok {
+		return replica.Backend{}, logs.StorageNotSupport{}
+	}
+
+	if rb.Area != "" && st == api.MEFS {
+		ui, err := database.NewDataBase().SelectUser(ctx, rb.Area)
+		if err != nil {
+			return replica.Backend{}, err
+		}
+		g, err := mefs.NewGatewayWith(ui)
+		if err != nil {
+			return replica.Backend{}, err
+		}
+		return replica.Backend{Name: rb.Storage + ":" + rb.Area, Area: rb.Area, G: g}, nil
+	}
+
+	g, err := newStore(st)
+	if err != nil {
+		return replica.Backend{}, err
+	}
+	return replica.Backend{Name: rb.Storage, G: g}, nil
+}
+
+// resolveReplica returns the gateway holding replica
+func resolveReplica(ctx context.Context, r api.ObjectReplica) (api.IGateway, error) {
+	b, err := newReplicaBackend(ctx, config.ReplicaBackend{Storage: r.SType.String(), Area: r.Area})
+	if err != nil {
+		return nil, err
+	}
+	return b.G, nil
+}
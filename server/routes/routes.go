@@ -8,6 +8,8 @@ import (
 	"github.com/memoio/backend/docs"
 	auth "github.com/memoio/backend/internal/authentication"
 	"github.com/memoio/backend/internal/filedns"
+	"github.com/memoio/backend/internal/repair"
+	"github.com/memoio/backend/internal/s3"
 	"github.com/memoio/backend/internal/share"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -35,6 +37,8 @@ func RegistRoutes() Routes {
 	r.registLoginRoute()
 	r.registShareRoute()
 	r.registFileDnsRoute()
+	r.registS3Route()
+	r.registAdminRoute()
 	// r.registAccount()
 	r.registStorageRoute()
 	return r
@@ -61,15 +65,54 @@ func (r Routes) registFileDnsRoute() {
 	filedns.LoadFileDnsModule(r.Group("/"))
 }
 
+func (r Routes) registS3Route() {
+	s3.LoadCredentialModule(r.Group("/"))
+}
+
+func (r Routes) registAdminRoute() {
+	admin := r.Group("/admin", VerifyAdminHandler)
+	repair.LoadRepairModule(admin, LoadRepairWorker())
+	loadHandler().handleAdmin(admin)
+}
+
+// RegistS3Routes returns the routes of the s3 compatible api, it is served
+// on its own endpoint because s3 clients address buckets from the root path
+func RegistS3Routes() Routes {
+	router := gin.New()
+	router.Use(gin.Logger(), gin.Recovery())
+
+	r := Routes{
+		router,
+	}
+
+	h := loadHandler()
+	s3.LoadS3Module(r.Group("/"), s3.Options{
+		Store:         loadStore,
+		QuotaCheck:    h.controller.QuotaCheck,
+		Put:           h.putS3Object,
+		ReadCheck:     h.controller.ReadCheck,
+		ChargeTraffic: h.controller.ChargeTraffic,
+	})
+	return r
+}
+
 // func (r Routes) registAccount() {
 // 	account.LoadAccountModule(r.Group("/account"))
 // }
 
 func (r Routes) registStorageRoute() {
-	h := newHandler()
+	h := loadHandler()
 	h.handleStorage(r.Group("/mefs", auth.VerifyAccessTokenHandler, LoadMefsHandler()))
 	// h.handleStorage(r.Group("/mefs", testLoadAddress(), LoadMefsHandler()))
-	h.handleStorage(r.Group("/ipfs", auth.VerifyAccessTokenHandler, LoadIpfsHandler()))
+	ipfs := r.Group("/ipfs", auth.VerifyAccessTokenHandler, LoadIpfsHandler())
+	h.handleStorage(ipfs)
+	h.handlePins(ipfs)
+	if config.Cfg.Storage.Local.Enable {
+		h.handleStorage(r.Group("/local", auth.VerifyAccessTokenHandler, LoadLocalHandler()))
+	}
+	if config.Cfg.Storage.Qiniu.Enable {
+		h.handleStorage(r.Group("/qiniu", auth.VerifyAccessTokenHandler, LoadQiniuHandler()))
+	}
 }
 
 // func testLoadAddress() gin.HandlerFunc {
@@ -1,6 +1,18 @@
 package routes
 
-import "math/big"
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/api"
+	"github.com/memoio/backend/internal/logs"
+	"github.com/memoio/backend/server/routes/controller"
+)
 
 type IPayPayment struct {
 	Nonce    *big.Int
@@ -27,3 +39,267 @@ func toBigInt(s string) *big.Int {
 	b.SetString(s, 10)
 	return b
 }
+
+// sizeReader fails unless r holds exactly remain bytes, so a streamed body
+// cannot store more than the size its space was checked for
+type sizeReader struct {
+	r      io.Reader
+	remain int64
+}
+
+func (s *sizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > s.remain+1 {
+		p = p[:s.remain+1]
+	}
+	n, err := s.r.Read(p)
+	s.remain -= int64(n)
+	if s.remain < 0 {
+		return n, logs.ServerError{Message: "body is larger than size"}
+	}
+	if err == io.EOF && s.remain > 0 {
+		return n, logs.ServerError{Message: "body is smaller than size"}
+	}
+	return n, err
+}
+
+// parsePinQuery reads the filters of the pinning service api
+func parsePinQuery(c *gin.Context) (controller.PinQuery, error) {
+	q := controller.PinQuery{
+		Name:  c.Query("name"),
+		Match: c.DefaultQuery("match", "exact"),
+		Limit: 10,
+	}
+
+	if cids := c.Query("cid"); cids != "" {
+		q.Cids = strings.Split(cids, ",")
+		if len(q.Cids) > 10 {
+			return q, logs.ControllerError{Message: "at most 10 cids can be queried"}
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		q.Status = strings.Split(status, ",")
+	}
+
+	for _, t := range []struct {
+		key string
+		v   *time.Time
+	}{{"before", &q.Before}, {"after", &q.After}} {
+		s := c.Query(t.key)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, logs.ControllerError{Message: "invalid " + t.key + " time"}
+		}
+		*t.v = v
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil || v < 1 || v > 1000 {
+			return q, logs.ControllerError{Message: "limit should be between 1 and 1000"}
+		}
+		q.Limit = v
+	}
+
+	if meta := c.Query("meta"); meta != "" {
+		err := json.Unmarshal([]byte(meta), &q.Meta)
+		if err != nil {
+			return q, logs.ControllerError{Message: "invalid meta"}
+		}
+	}
+
+	return q, nil
+}
+
+// parseListQuery reads the page, sort order and filters of an object listing
+func parseListQuery(c *gin.Context) (controller.ListObjectsOptions, error) {
+	opts := controller.ListObjectsOptions{
+		Prefix:       c.Query("prefix"),
+		Delimiter:    c.Query("delimiter"),
+		NameContains: c.Query("name"),
+		ContentType:  c.Query("ctype"),
+		Sort:         c.Query("sort"),
+		Cursor:       c.Query("cursor"),
+		Limit:        100,
+	}
+
+	switch opts.Sort {
+	case "", "name", "size", "modtime":
+	default:
+		return opts, logs.ControllerError{Message: "sort should be name, size or modtime"}
+	}
+
+	switch c.DefaultQuery("order", "asc") {
+	case "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, logs.ControllerError{Message: "order should be asc or desc"}
+	}
+
+	if public := c.Query("public"); public != "" {
+		v, err := strconv.ParseBool(public)
+		if err != nil {
+			return opts, logs.ControllerError{Message: "invalid public"}
+		}
+		opts.Public = &v
+	}
+
+	for _, t := range []struct {
+		key string
+		v   *int64
+	}{
+		{"minSize", &opts.MinSize}, {"maxSize", &opts.MaxSize},
+		{"minWidth", &opts.MinWidth}, {"minHeight", &opts.MinHeight},
+		{"minDuration", &opts.MinDuration}, {"maxDuration", &opts.MaxDuration},
+	} {
+		s := c.Query(t.key)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			return opts, logs.ControllerError{Message: "invalid " + t.key}
+		}
+		*t.v = v
+	}
+
+	for _, t := range []struct {
+		key string
+		v   *time.Time
+	}{{"takenAfter", &opts.TakenAfter}, {"takenBefore", &opts.TakenBefore}} {
+		s := c.Query(t.key)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return opts, logs.ControllerError{Message: "invalid " + t.key + ", it should be an RFC 3339 time"}
+		}
+		*t.v = v
+	}
+
+	// tag=key matches any value of the tag, tag=key:value only that value
+	for _, tag := range c.QueryArray("tag") {
+		if opts.Tags == nil {
+			opts.Tags = make(map[string]string)
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		if k == "" {
+			return opts, logs.ControllerError{Message: "invalid tag"}
+		}
+		opts.Tags[k] = v
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		v, err := strconv.Atoi(limit)
+		if err != nil || v < 1 || v > 1000 {
+			return opts, logs.ControllerError{Message: "limit should be between 1 and 1000"}
+		}
+		opts.Limit = v
+	}
+
+	return opts, nil
+}
+
+// parseLedgerQuery reads the query of a ledger request, the sums are made
+// by day unless period is month
+func parseLedgerQuery(c *gin.Context) (controller.LedgerOptions, error) {
+	opts := controller.LedgerOptions{
+		Period: c.DefaultQuery("period", "day"),
+		Kind:   api.LedgerKind(c.Query("kind")),
+		ByFile: c.Query("by") == "file",
+	}
+
+	switch opts.Period {
+	case "day", "month":
+	default:
+		return opts, logs.ControllerError{Message: "period should be day or month"}
+	}
+
+	switch opts.Kind {
+	case "", api.LedgerUpload, api.LedgerDownload, api.LedgerShare:
+	default:
+		return opts, logs.ControllerError{Message: "kind should be upload, download or share"}
+	}
+
+	if by := c.Query("by"); by != "" && by != "file" {
+		return opts, logs.ControllerError{Message: "by should be file"}
+	}
+
+	if file := c.Query("file"); file != "" {
+		v, err := strconv.Atoi(file)
+		if err != nil || v <= 0 {
+			return opts, logs.ControllerError{Message: "invalid file"}
+		}
+		opts.FileID = v
+	}
+
+	for _, t := range []struct {
+		key string
+		v   *time.Time
+	}{{"from", &opts.From}, {"to", &opts.To}} {
+		s := c.Query(t.key)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return opts, logs.ControllerError{Message: "invalid " + t.key + ", it should be an RFC 3339 time"}
+		}
+		*t.v = v
+	}
+
+	return opts, nil
+}
+
+// parseStatementQuery reads the period and the format of a statement, the
+// period is a month, the current one by default, or from and to
+func parseStatementQuery(c *gin.Context) (from, to time.Time, format string, err error) {
+	format = c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		return from, to, format, logs.ControllerError{Message: "format should be json or csv"}
+	}
+
+	if month := c.Query("month"); month != "" {
+		from, err = time.Parse("2006-01", month)
+		if err != nil {
+			return from, to, format, logs.ControllerError{Message: "invalid month, it should be like 2006-01"}
+		}
+		return from, from.AddDate(0, 1, 0), format, nil
+	}
+
+	now := time.Now().UTC()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to = from.AddDate(0, 1, 0)
+	for _, t := range []struct {
+		key string
+		v   *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		s := c.Query(t.key)
+		if s == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return from, to, format, logs.ControllerError{Message: "invalid " + t.key + ", it should be an RFC 3339 time"}
+		}
+		*t.v = v
+	}
+	return from, to, format, nil
+}
+
+// parseMeta reads a json object of metadata or tags, which may be empty
+func parseMeta(name, s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	err := json.Unmarshal([]byte(s), &m)
+	if err != nil {
+		return nil, logs.ServerError{Message: "invalid " + name + ", it should be a json object of strings"}
+	}
+	return m, nil
+}
@@ -1,10 +1,12 @@
 package server
 
 import (
+	"context"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/memoio/backend/config"
 	"github.com/memoio/backend/internal/filedns"
 	"github.com/memoio/backend/server/routes"
 )
@@ -37,3 +39,55 @@ func NewServer(opt ServerOption) *http.Server {
 
 	return srv
 }
+
+// NewS3Server returns the server of the s3 compatible api
+func NewS3Server(opt ServerOption) *http.Server {
+	log.Println("S3 Server Start")
+	gin.SetMode(gin.ReleaseMode)
+
+	router := routes.RegistS3Routes()
+
+	srv := &http.Server{
+		Addr:    opt.Endpoint,
+		Handler: router,
+	}
+
+	return srv
+}
+
+// StartRepair starts the worker checking the replicas if it is enabled, it
+// stops with ctx
+func StartRepair(ctx context.Context) {
+	if !config.Cfg.Storage.Repair.Enable {
+		return
+	}
+	log.Println("Repair Worker Start")
+	routes.LoadRepairWorker().Start(ctx)
+}
+
+// StartPinning starts pinning the ipfs uploads on the remote pinners of
+// the config, it stops with ctx
+func StartPinning(ctx context.Context) {
+	if len(config.Cfg.Storage.Ipfs.Pinners) == 0 {
+		return
+	}
+	log.Println("Remote Pinning Start")
+	routes.StartPinning(ctx)
+}
+
+// StartDerivatives starts making the thumbnails of the images and the
+// previews of the text files uploaded if it is enabled, it stops with ctx
+func StartDerivatives(ctx context.Context) {
+	if !config.Cfg.Storage.Thumbnail.Enable {
+		return
+	}
+	log.Println("Thumbnail Pipeline Start")
+	routes.StartDerivatives(ctx)
+}
+
+// StartTrash starts the sweep purging the files deleted longer ago than the
+// trash retention, it stops with ctx
+func StartTrash(ctx context.Context) {
+	log.Println("Trash Sweep Start")
+	routes.StartTrash(ctx)
+}
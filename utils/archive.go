@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var ErrArchiveFormat = errors.New("archive format should be zip or tar")
+
+// ArchiveWriter streams files into a zip or tar archive, the content of a
+// file is written to the writer Create returns before the next one is made
+type ArchiveWriter interface {
+	Create(name string, size int64, modtime time.Time) (io.Writer, error)
+	Close() error
+}
+
+// NewArchiveWriter returns an archive writer of format, "zip" or "tar"
+func NewArchiveWriter(w io.Writer, format string) (ArchiveWriter, error) {
+	switch format {
+	case "zip":
+		return &zipWriter{zip.NewWriter(w)}, nil
+	case "tar":
+		return &tarWriter{tar.NewWriter(w)}, nil
+	default:
+		return nil, ErrArchiveFormat
+	}
+}
+
+// ArchiveType is the content type of an archive of format
+func ArchiveType(format string) string {
+	if format == "tar" {
+		return "application/x-tar"
+	}
+	return "application/zip"
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (z *zipWriter) Create(name string, size int64, modtime time.Time) (io.Writer, error) {
+	return z.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modtime,
+	})
+}
+
+type tarWriter struct {
+	*tar.Writer
+}
+
+func (t *tarWriter) Create(name string, size int64, modtime time.Time) (io.Writer, error) {
+	err := t.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modtime,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.Writer, nil
+}
+
+// ArchiveNames makes the names of an archive unique, a name already used
+// gets a counter before its extension
+type ArchiveNames map[string]bool
+
+func (n ArchiveNames) Unique(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	unique := name
+	ext := path.Ext(name)
+	for i := 1; n[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	n[unique] = true
+	return unique
+}
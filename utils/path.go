@@ -0,0 +1,22 @@
+package utils
+
+import "path"
+
+// CleanPath returns p as an absolute folder path ending with a slash
+func CleanPath(p string) string {
+	p = path.Clean("/" + p)
+	if p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+// SplitObject puts the folders an object name holds into its folder, it is
+// false when no valid name is left
+func SplitObject(folder, object string) (string, string, bool) {
+	dir, name := path.Split(object)
+	if name == "" || name == "." || name == ".." {
+		return "", "", false
+	}
+	return CleanPath(folder + "/" + dir), name, true
+}
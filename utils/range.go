@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRange = errors.New("invalid range")
+
+// ByteRange is the single byte range a download asked for
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// CheckPreconditions evaluates the conditional headers of a read request
+// against the etag and modtime of the object. It returns
+// http.StatusNotModified or http.StatusPreconditionFailed when the content
+// must not be sent, 0 otherwise.
+func CheckPreconditions(r *http.Request, etag string, modtime time.Time) int {
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !etagMatch(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" {
+		t, err := http.ParseTime(ius)
+		if err == nil && modtime.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etagMatch(inm, etag, true) {
+			return http.StatusNotModified
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err == nil && !modtime.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// RequestRange returns the byte range of the request, or nil if the whole
+// object is to be sent. Multiple ranges are not supported and, as RFC 7233
+// allows, answered with the whole object. A range that does not overlap
+// the object returns ErrInvalidRange.
+func RequestRange(r *http.Request, etag string, modtime time.Time, size int64) (*ByteRange, error) {
+	s := r.Header.Get("Range")
+	if s == "" || strings.Contains(s, ",") {
+		return nil, nil
+	}
+
+	// a stale If-Range asks for the whole object
+	if ir := r.Header.Get("If-Range"); ir != "" {
+		if strings.HasPrefix(ir, "\"") || strings.HasPrefix(ir, "W/") {
+			if !etagMatch(ir, etag, false) {
+				return nil, nil
+			}
+		} else {
+			t, err := http.ParseTime(ir)
+			if err != nil || !modtime.Truncate(time.Second).Equal(t) {
+				return nil, nil
+			}
+		}
+	}
+
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, ErrInvalidRange
+	}
+	spec := textproto.TrimString(s[len(b):])
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return nil, ErrInvalidRange
+	}
+	first, last := textproto.TrimString(spec[:i]), textproto.TrimString(spec[i+1:])
+
+	var br ByteRange
+	if first == "" {
+		// suffix range, the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return nil, ErrInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		br.Start = size - n
+		br.Length = n
+		return &br, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return nil, ErrInvalidRange
+	}
+	br.Start = start
+	br.Length = size - start
+	if last != "" {
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, ErrInvalidRange
+		}
+		if end < size-1 {
+			br.Length = end - start + 1
+		}
+	}
+	return &br, nil
+}
+
+// etagMatch reports whether the etag list of a conditional header contains
+// etag, weak comparison ignores the W/ prefix
+func etagMatch(list, etag string, weak bool) bool {
+	for _, v := range strings.Split(list, ",") {
+		v = textproto.TrimString(v)
+		if v == "*" {
+			return true
+		}
+		if strings.HasPrefix(v, "W/") {
+			if !weak {
+				continue
+			}
+			v = v[2:]
+		}
+		if strings.Trim(v, "\"") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var modtime = time.Date(2023, 3, 4, 5, 6, 7, 500, time.UTC)
+
+func request(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/object", nil)
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func TestRequestRange(t *testing.T) {
+	lastModified := modtime.Format(http.TimeFormat)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		size    int64
+		want    *ByteRange
+		err     error
+	}{
+		{"no range", nil, 100, nil, nil},
+		{"first bytes", map[string]string{"Range": "bytes=0-9"}, 100, &ByteRange{0, 10}, nil},
+		{"middle", map[string]string{"Range": "bytes=10-19"}, 100, &ByteRange{10, 10}, nil},
+		{"spaces", map[string]string{"Range": "bytes= 10 - 19 "}, 100, &ByteRange{10, 10}, nil},
+		{"open ended", map[string]string{"Range": "bytes=90-"}, 100, &ByteRange{90, 10}, nil},
+		{"end past size", map[string]string{"Range": "bytes=90-500"}, 100, &ByteRange{90, 10}, nil},
+		{"last byte", map[string]string{"Range": "bytes=99-99"}, 100, &ByteRange{99, 1}, nil},
+		{"suffix", map[string]string{"Range": "bytes=-10"}, 100, &ByteRange{90, 10}, nil},
+		{"suffix past size", map[string]string{"Range": "bytes=-500"}, 100, &ByteRange{0, 100}, nil},
+		{"start past size", map[string]string{"Range": "bytes=100-"}, 100, nil, ErrInvalidRange},
+		{"start past size closed", map[string]string{"Range": "bytes=200-300"}, 100, nil, ErrInvalidRange},
+		{"empty suffix", map[string]string{"Range": "bytes=-0"}, 100, nil, ErrInvalidRange},
+		{"suffix of empty object", map[string]string{"Range": "bytes=-10"}, 0, nil, ErrInvalidRange},
+		{"range of empty object", map[string]string{"Range": "bytes=0-"}, 0, nil, ErrInvalidRange},
+		{"end before start", map[string]string{"Range": "bytes=20-10"}, 100, nil, ErrInvalidRange},
+		{"no dash", map[string]string{"Range": "bytes=10"}, 100, nil, ErrInvalidRange},
+		{"not a number", map[string]string{"Range": "bytes=a-b"}, 100, nil, ErrInvalidRange},
+		{"other unit", map[string]string{"Range": "items=0-9"}, 100, nil, ErrInvalidRange},
+		{"multiple ranges", map[string]string{"Range": "bytes=0-9,20-29"}, 100, nil, nil},
+		{"if-range etag", map[string]string{"Range": "bytes=0-9", "If-Range": `"abc"`}, 100, &ByteRange{0, 10}, nil},
+		{"if-range stale etag", map[string]string{"Range": "bytes=0-9", "If-Range": `"old"`}, 100, nil, nil},
+		{"if-range weak etag", map[string]string{"Range": "bytes=0-9", "If-Range": `W/"abc"`}, 100, nil, nil},
+		{"if-range date", map[string]string{"Range": "bytes=0-9", "If-Range": lastModified}, 100, &ByteRange{0, 10}, nil},
+		{"if-range stale date", map[string]string{"Range": "bytes=0-9", "If-Range": before}, 100, nil, nil},
+		{"if-range bad date", map[string]string{"Range": "bytes=0-9", "If-Range": "yesterday"}, 100, nil, nil},
+		{"if-range stale invalid range", map[string]string{"Range": "bytes=200-", "If-Range": `"old"`}, 100, nil, nil},
+	}
+	for _, c := range cases {
+		got, err := RequestRange(request(c.headers), "abc", modtime, c.size)
+		if err != c.err {
+			t.Errorf("%s: error %v, want %v", c.name, err, c.err)
+			continue
+		}
+		if (got == nil) != (c.want == nil) || got != nil && *got != *c.want {
+			t.Errorf("%s: range %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestContentRange(t *testing.T) {
+	if got := (ByteRange{Start: 90, Length: 10}).ContentRange(100); got != "bytes 90-99/100" {
+		t.Fatalf("content range %q", got)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	lastModified := modtime.Format(http.TimeFormat)
+	before := modtime.Add(-time.Hour).Format(http.TimeFormat)
+	after := modtime.Add(time.Hour).Format(http.TimeFormat)
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"none", nil, 0},
+		{"if-match", map[string]string{"If-Match": `"abc"`}, 0},
+		{"if-match list", map[string]string{"If-Match": `"x", "abc"`}, 0},
+		{"if-match any", map[string]string{"If-Match": "*"}, 0},
+		{"if-match other", map[string]string{"If-Match": `"x"`}, http.StatusPreconditionFailed},
+		{"if-match weak", map[string]string{"If-Match": `W/"abc"`}, http.StatusPreconditionFailed},
+		{"if-unmodified-since later", map[string]string{"If-Unmodified-Since": after}, 0},
+		{"if-unmodified-since same second", map[string]string{"If-Unmodified-Since": lastModified}, 0},
+		{"if-unmodified-since earlier", map[string]string{"If-Unmodified-Since": before}, http.StatusPreconditionFailed},
+		{"if-match before if-unmodified-since", map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before}, 0},
+		{"if-none-match", map[string]string{"If-None-Match": `"abc"`}, http.StatusNotModified},
+		{"if-none-match weak", map[string]string{"If-None-Match": `W/"abc"`}, http.StatusNotModified},
+		{"if-none-match any", map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"if-none-match other", map[string]string{"If-None-Match": `"x"`}, 0},
+		{"if-modified-since same second", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"if-modified-since earlier", map[string]string{"If-Modified-Since": before}, 0},
+		{"if-none-match before if-modified-since", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": after}, 0},
+		{"bad date", map[string]string{"If-Modified-Since": "yesterday"}, 0},
+		{"failed match first", map[string]string{"If-Match": `"x"`, "If-None-Match": `"abc"`}, http.StatusPreconditionFailed},
+	}
+	for _, c := range cases {
+		got := CheckPreconditions(request(c.headers), "abc", modtime)
+		if got != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/memoio/backend/api"
+)
+
+const (
+	// SniffSize is the start of a file its content type is found in
+	SniffSize = 512
+	// MediaHeadSize is the start of a file its media info is found in, the
+	// exif of a jpeg may hold a thumbnail before the size of the image
+	MediaHeadSize = 256 << 10
+)
+
+// FileContentType is the type recorded for fi, the older files are typed by
+// the extension of their name
+func FileContentType(fi api.FileInfo) string {
+	if fi.ContentType != "" {
+		return fi.ContentType
+	}
+	return TypeByExtension(path.Ext(fi.Name))
+}
+
+// DetectContentType types a file by the magic bytes of head, its start. The
+// extension of name is more precise for generic content such as text or zip,
+// a docx is a zip and a css is text.
+func DetectContentType(head []byte, name string) string {
+	sniffed := http.DetectContentType(head)
+	if bytes.HasPrefix(head, []byte("fLaC")) {
+		sniffed = "audio/flac"
+	}
+
+	ext := TypeByExtension(path.Ext(name))
+	if ext == "application/octet-stream" {
+		return sniffed
+	}
+	for _, generic := range []string{"application/octet-stream", "application/zip", "text/plain", "text/xml"} {
+		if strings.HasPrefix(sniffed, generic) {
+			return ext
+		}
+	}
+	return sniffed
+}
+
+// HeadReader keeps the first bytes read through it
+type HeadReader struct {
+	r    io.Reader
+	head []byte
+	max  int
+}
+
+func NewHeadReader(r io.Reader, max int) *HeadReader {
+	return &HeadReader{r: r, max: max}
+}
+
+func (h *HeadReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if room := h.max - len(h.head); room > 0 {
+		if room > n {
+			room = n
+		}
+		h.head = append(h.head, p[:room]...)
+	}
+	return n, err
+}
+
+// Head is the start of what was read
+func (h *HeadReader) Head() []byte {
+	return h.head
+}
+
+// MediaInfo is what the header of an image or an audio file tells, Taken is
+// when a photo was taken, Duration is in seconds
+type MediaInfo struct {
+	Width    int
+	Height   int
+	Taken    time.Time
+	Duration float64
+}
+
+// ParseMediaInfo reads the media info of a file of content type ctype and
+// size bytes from head, its start. Formats it does not know give an empty
+// info.
+func ParseMediaInfo(ctype string, head []byte, size int64) MediaInfo {
+	info := MediaInfo{}
+	switch {
+	case strings.HasPrefix(ctype, "image/"):
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+		if err == nil {
+			info.Width, info.Height = cfg.Width, cfg.Height
+			info.Taken = jpegTaken(head)
+		}
+	case !strings.HasPrefix(ctype, "audio/"):
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		info.Duration = wavDuration(head)
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		info.Duration = flacDuration(head)
+	default:
+		info.Duration = mp3Duration(head, size)
+	}
+	return info
+}
+
+// jpegTaken is the date the exif of a jpeg gives to the photo, the original
+// one or the one of the file. Exif dates have no time zone, they are UTC.
+func jpegTaken(d []byte) time.Time {
+	if len(d) < 4 || d[0] != 0xFF || d[1] != 0xD8 {
+		return time.Time{}
+	}
+	for i := 2; i+4 <= len(d); {
+		if d[i] != 0xFF {
+			return time.Time{}
+		}
+		marker := d[i+1]
+		// the image data starts, the exif is before it
+		if marker == 0xDA || marker == 0xD9 {
+			return time.Time{}
+		}
+		n := int(binary.BigEndian.Uint16(d[i+2:]))
+		end := i + 2 + n
+		if n < 2 || end > len(d) {
+			return time.Time{}
+		}
+		seg := d[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifTaken(seg[6:])
+		}
+		i = end
+	}
+	return time.Time{}
+}
+
+func exifTaken(tiff []byte) time.Time {
+	if len(tiff) < 8 {
+		return time.Time{}
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return time.Time{}
+	}
+
+	ifd0 := int(bo.Uint32(tiff[4:]))
+	var value []byte
+	if ptr, ok := ifdValue(tiff, bo, ifd0, 0x8769); ok && len(ptr) == 4 {
+		value, _ = ifdValue(tiff, bo, int(bo.Uint32(ptr)), 0x9003)
+	}
+	if value == nil {
+		value, _ = ifdValue(tiff, bo, ifd0, 0x0132)
+	}
+
+	taken, err := time.Parse("2006:01:02 15:04:05", strings.TrimRight(string(value), "\x00 "))
+	if err != nil {
+		return time.Time{}
+	}
+	return taken
+}
+
+// ifdValue is the value of the entry tag of the tiff ifd at off
+func ifdValue(tiff []byte, bo binary.ByteOrder, off int, tag uint16) ([]byte, bool) {
+	if off < 8 || off+2 > len(tiff) {
+		return nil, false
+	}
+	n := int(bo.Uint16(tiff[off:]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(tiff) {
+			return nil, false
+		}
+		if bo.Uint16(tiff[e:]) != tag {
+			continue
+		}
+
+		unit := 1
+		switch bo.Uint16(tiff[e+2:]) {
+		case 3, 8:
+			unit = 2
+		case 4, 9, 11:
+			unit = 4
+		case 5, 10, 12:
+			unit = 8
+		}
+		count := int(bo.Uint32(tiff[e+4:]))
+		if count > len(tiff) {
+			return nil, false
+		}
+		size := count * unit
+		// values of 4 bytes at most are in the entry
+		if size <= 4 {
+			return tiff[e+8 : e+8+size], true
+		}
+		p := int(bo.Uint32(tiff[e+8:]))
+		if p < 0 || p+size > len(tiff) {
+			return nil, false
+		}
+		return tiff[p : p+size], true
+	}
+	return nil, false
+}
+
+func wavDuration(d []byte) float64 {
+	var byteRate uint32
+	for i := 12; i+8 <= len(d); {
+		n := int64(binary.LittleEndian.Uint32(d[i+4:]))
+		switch string(d[i : i+4]) {
+		case "fmt ":
+			if i+20 <= len(d) {
+				byteRate = binary.LittleEndian.Uint32(d[i+16:])
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0
+			}
+			return float64(n) / float64(byteRate)
+		}
+		next := int64(i) + 8 + n + n&1
+		if next > int64(len(d)) {
+			return 0
+		}
+		i = int(next)
+	}
+	return 0
+}
+
+func flacDuration(d []byte) float64 {
+	// the streaminfo block comes first, its sample rate and sample count
+	// are packed in 8 bytes
+	if len(d) < 26 || d[4]&0x7F != 0 {
+		return 0
+	}
+	v := binary.BigEndian.Uint64(d[18:26])
+	rate := v >> 44
+	samples := v & (1<<36 - 1)
+	if rate == 0 {
+		return 0
+	}
+	return float64(samples) / float64(rate)
+}
+
+var (
+	mp3Bitrates = [2][15]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3Rates = [3][3]int{
+		{44100, 48000, 32000},
+		{22050, 24000, 16000},
+		{11025, 12000, 8000},
+	}
+)
+
+// mp3Duration reads the frame count of a vbr header when there is one, a
+// constant bitrate is assumed otherwise
+func mp3Duration(d []byte, size int64) float64 {
+	off := 0
+	if len(d) >= 10 && string(d[:3]) == "ID3" {
+		off = 10 + (int(d[6])<<21 | int(d[7])<<14 | int(d[8])<<7 | int(d[9]))
+		if d[5]&0x10 != 0 {
+			off += 10
+		}
+	}
+	if off+4 > len(d) || d[off] != 0xFF || d[off+1]&0xE0 != 0xE0 {
+		return 0
+	}
+
+	h := binary.BigEndian.Uint32(d[off:])
+	version := (h >> 19) & 3
+	layer := (h >> 17) & 3
+	bitrate := int((h >> 12) & 0xF)
+	rateIndex := int((h >> 10) & 3)
+	mono := (h>>6)&3 == 3
+	// layer III only
+	if version == 1 || layer != 1 || bitrate == 0 || bitrate == 15 || rateIndex == 3 {
+		return 0
+	}
+
+	// the side info before a vbr header depends on the version and the
+	// channels
+	kind, spf, side := 1, 576, 17
+	if mono {
+		side = 9
+	}
+	if version == 3 {
+		kind, spf, side = 0, 1152, 32
+		if mono {
+			side = 17
+		}
+	}
+	rates := mp3Rates[0]
+	switch version {
+	case 2:
+		rates = mp3Rates[1]
+	case 0:
+		rates = mp3Rates[2]
+	}
+	rate := rates[rateIndex]
+
+	var frames uint32
+	if x := off + 4 + side; x+12 <= len(d) && (string(d[x:x+4]) == "Xing" || string(d[x:x+4]) == "Info") {
+		if binary.BigEndian.Uint32(d[x+4:])&1 != 0 {
+			frames = binary.BigEndian.Uint32(d[x+8:])
+		}
+	} else if v := off + 36; v+18 <= len(d) && string(d[v:v+4]) == "VBRI" {
+		frames = binary.BigEndian.Uint32(d[v+14:])
+	}
+	if frames > 0 {
+		return float64(frames) * float64(spf) / float64(rate)
+	}
+
+	return float64(size-int64(off)) * 8 / float64(mp3Bitrates[kind][bitrate]*1000)
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+var taken = time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+
+const exifDate = "2021:05:06 07:08:09\x00"
+
+// exifOriginal is a tiff whose ifd0 points to an exif ifd holding the date
+// the photo was taken, exifPtr is where the pointer leads
+func exifOriginal(bo binary.ByteOrder, exifPtr uint32) []byte {
+	tiff := make([]byte, 64)
+	if bo == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	bo.PutUint16(tiff[2:], 42)
+	bo.PutUint32(tiff[4:], 8)
+	// ifd0: the exif pointer
+	bo.PutUint16(tiff[8:], 1)
+	bo.PutUint16(tiff[10:], 0x8769)
+	bo.PutUint16(tiff[12:], 4)
+	bo.PutUint32(tiff[14:], 1)
+	bo.PutUint32(tiff[18:], exifPtr)
+	// exif ifd: DateTimeOriginal
+	bo.PutUint16(tiff[26:], 1)
+	bo.PutUint16(tiff[28:], 0x9003)
+	bo.PutUint16(tiff[30:], 2)
+	bo.PutUint32(tiff[32:], 20)
+	bo.PutUint32(tiff[36:], 44)
+	copy(tiff[44:], exifDate)
+	return tiff
+}
+
+// exifDateTime is a tiff whose ifd0 only holds the date of the file, its
+// string is at valuePtr
+func exifDateTime(bo binary.ByteOrder, valuePtr uint32) []byte {
+	tiff := make([]byte, 46)
+	if bo == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	bo.PutUint16(tiff[2:], 42)
+	bo.PutUint32(tiff[4:], 8)
+	bo.PutUint16(tiff[8:], 1)
+	bo.PutUint16(tiff[10:], 0x0132)
+	bo.PutUint16(tiff[12:], 2)
+	bo.PutUint32(tiff[14:], 20)
+	bo.PutUint32(tiff[18:], valuePtr)
+	copy(tiff[26:], exifDate)
+	return tiff
+}
+
+// jpegWith is a 40x30 jpeg with the tiff in an exif segment, none if tiff
+// is nil
+func jpegWith(t *testing.T, tiff []byte) []byte {
+	var b bytes.Buffer
+	err := jpeg.Encode(&b, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := b.Bytes()
+	if tiff == nil {
+		return d
+	}
+
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	app := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app[2:], uint16(len(seg)+2))
+	out := append([]byte{}, d[:2]...)
+	out = append(out, app...)
+	out = append(out, seg...)
+	return append(out, d[2:]...)
+}
+
+func pngOf(t *testing.T, w, h int) []byte {
+	var b bytes.Buffer
+	err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, w, h)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// wavOf is a pcm wav of data bytes, a LIST chunk of odd size comes first
+// when list is true
+func wavOf(byteRate uint32, data int, list bool) []byte {
+	le := binary.LittleEndian
+	b := make([]byte, 36)
+	copy(b, "RIFF")
+	copy(b[8:], "WAVEfmt ")
+	le.PutUint32(b[16:], 16)
+	le.PutUint16(b[20:], 1)
+	le.PutUint16(b[22:], 1)
+	le.PutUint32(b[24:], byteRate/2)
+	le.PutUint32(b[28:], byteRate)
+	le.PutUint16(b[32:], 2)
+	le.PutUint16(b[34:], 16)
+	if list {
+		b = append(b, "LIST\x05\x00\x00\x00INFOx\x00"...)
+	}
+	chunk := make([]byte, 8+data)
+	copy(chunk, "data")
+	le.PutUint32(chunk[4:], uint32(data))
+	b = append(b, chunk...)
+	le.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+func flacOf(rate, samples uint64) []byte {
+	b := make([]byte, 42)
+	copy(b, "fLaC")
+	// streaminfo, not the last block, 34 bytes
+	b[7] = 34
+	binary.BigEndian.PutUint64(b[18:], rate<<44|1<<41|15<<36|samples)
+	return b
+}
+
+const (
+	// mpeg1 layer III, 128 kbps, 44100 Hz, stereo
+	mp3Stereo = 0xFFFB9000
+	// mpeg1 layer III, 128 kbps, 44100 Hz, mono
+	mp3Mono = 0xFFFB90C0
+	// mpeg2 layer III, 64 kbps, 22050 Hz, stereo
+	mp3Mpeg2 = 0xFFF38000
+	// mpeg1 layer II
+	mp2 = 0xFFFD9000
+)
+
+// mp3Of is the first frame of an mp3 with header h, n bytes long, a vbr
+// header is written at vbr when tag is not empty
+func mp3Of(h uint32, n int, vbr int, tag string, frames uint32) []byte {
+	b := make([]byte, n)
+	binary.BigEndian.PutUint32(b, h)
+	if tag != "" {
+		copy(b[vbr:], tag)
+		if tag == "VBRI" {
+			binary.BigEndian.PutUint32(b[vbr+14:], frames)
+		} else {
+			binary.BigEndian.PutUint32(b[vbr+4:], 1)
+			binary.BigEndian.PutUint32(b[vbr+8:], frames)
+		}
+	}
+	return b
+}
+
+func withID3(d []byte, size int) []byte {
+	tag := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(size)}
+	tag = append(tag, make([]byte, size)...)
+	return append(tag, d...)
+}
+
+func TestParseMediaInfo(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	jpg := jpegWith(t, exifOriginal(le, 26))
+
+	cases := []struct {
+		name  string
+		ctype string
+		head  []byte
+		size  int64
+		want  MediaInfo
+	}{
+		{"jpeg exif le", "image/jpeg", jpg, 0, MediaInfo{Width: 40, Height: 30, Taken: taken}},
+		{"jpeg exif be", "image/jpeg", jpegWith(t, exifOriginal(be, 26)), 0, MediaInfo{Width: 40, Height: 30, Taken: taken}},
+		{"jpeg datetime", "image/jpeg", jpegWith(t, exifDateTime(be, 26)), 0, MediaInfo{Width: 40, Height: 30, Taken: taken}},
+		{"jpeg no exif", "image/jpeg", jpegWith(t, nil), 0, MediaInfo{Width: 40, Height: 30}},
+		{"jpeg exif pointer out", "image/jpeg", jpegWith(t, exifOriginal(le, 1000)), 0, MediaInfo{Width: 40, Height: 30}},
+		{"jpeg exif value out", "image/jpeg", jpegWith(t, exifDateTime(le, 40)), 0, MediaInfo{Width: 40, Height: 30}},
+		{"jpeg exif bad order", "image/jpeg", jpegWith(t, append([]byte("XX"), exifOriginal(le, 26)[2:]...)), 0, MediaInfo{Width: 40, Height: 30}},
+		{"jpeg truncated", "image/jpeg", jpg[:40], 0, MediaInfo{}},
+		{"png", "image/png", pngOf(t, 10, 20), 0, MediaInfo{Width: 10, Height: 20}},
+		{"not an image", "image/png", []byte("hello"), 0, MediaInfo{}},
+		{"wav", "audio/wav", wavOf(16000, 48000, false), 0, MediaInfo{Duration: 3}},
+		{"wav list chunk", "audio/wav", wavOf(16000, 8000, true), 0, MediaInfo{Duration: 0.5}},
+		{"wav no byte rate", "audio/wav", wavOf(0, 100, false), 0, MediaInfo{}},
+		{"wav truncated", "audio/wav", wavOf(16000, 48000, false)[:30], 0, MediaInfo{}},
+		{"flac", "audio/flac", flacOf(44100, 441000), 0, MediaInfo{Duration: 10}},
+		{"flac truncated", "audio/flac", flacOf(44100, 441000)[:20], 0, MediaInfo{}},
+		{"flac no rate", "audio/flac", flacOf(0, 441000), 0, MediaInfo{}},
+		{"mp3 cbr", "audio/mpeg", mp3Of(mp3Stereo, 417, 0, "", 0), 160000, MediaInfo{Duration: 10}},
+		{"mp3 id3", "audio/mpeg", withID3(mp3Of(mp3Stereo, 417, 0, "", 0), 20), 160030, MediaInfo{Duration: 10}},
+		{"mp3 xing", "audio/mpeg", mp3Of(mp3Stereo, 417, 36, "Xing", 3828), 1 << 20, MediaInfo{Duration: 3828 * 1152 / 44100.0}},
+		{"mp3 info mono", "audio/mpeg", mp3Of(mp3Mono, 417, 21, "Info", 1000), 1 << 20, MediaInfo{Duration: 1000 * 1152 / 44100.0}},
+		{"mp3 vbri", "audio/mpeg", mp3Of(mp3Stereo, 417, 36, "VBRI", 500), 1 << 20, MediaInfo{Duration: 500 * 1152 / 44100.0}},
+		{"mp3 mpeg2", "audio/mpeg", mp3Of(mp3Mpeg2, 208, 0, "", 0), 80000, MediaInfo{Duration: 10}},
+		{"mp3 layer II", "audio/mpeg", mp3Of(mp2, 417, 0, "", 0), 160000, MediaInfo{}},
+		{"mp3 no sync", "audio/mpeg", make([]byte, 417), 160000, MediaInfo{}},
+		{"mp3 id3 truncated", "audio/mpeg", withID3(nil, 20)[:15], 160000, MediaInfo{}},
+		{"text", "text/plain", []byte("RIFF....WAVE"), 12, MediaInfo{}},
+	}
+	for _, c := range cases {
+		got := ParseMediaInfo(c.ctype, c.head, c.size)
+		if got.Width != c.want.Width || got.Height != c.want.Height || !got.Taken.Equal(c.want.Taken) ||
+			math.Abs(got.Duration-c.want.Duration) > 1e-9 {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	cases := []struct {
+		name string
+		head []byte
+		file string
+		want string
+	}{
+		{"png magic wins", pngOf(t, 1, 1), "a.txt", "image/png"},
+		{"jpeg no extension", jpegWith(t, nil), "photo", "image/jpeg"},
+		{"flac", flacOf(44100, 1), "a.bin", "audio/flac"},
+		{"text by extension", []byte("body { color: red }"), "style.css", "text/css"},
+		{"zip by extension", []byte("PK\x03\x04rest"), "a.docx", TypeByExtension(".docx")},
+		{"unknown", []byte{0, 1, 2, 3}, "data", "application/octet-stream"},
+	}
+	for _, c := range cases {
+		got := DetectContentType(c.head, c.file)
+		if !strings.HasPrefix(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestHeadReader(t *testing.T) {
+	h := NewHeadReader(strings.NewReader("abcdefghij"), 4)
+	var out bytes.Buffer
+	_, err := out.ReadFrom(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "abcdefghij" || string(h.Head()) != "abcd" {
+		t.Fatalf("read %q, head %q", out.String(), h.Head())
+	}
+}
@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"unicode/utf8"
+
+	// the formats the thumbnails are made of
+	_ "image/gif"
+	_ "image/png"
+)
+
+// maxPixels bounds the images decoded, a small file can hold a huge image
+const maxPixels = 64 << 20
+
+var ErrImageTooLarge = errors.New("image is too large to make a thumbnail of")
+
+// Thumbnail scales the image data, a jpeg, png or gif, down to fit in size
+// by size pixels. The thumbnail is a jpeg, transparent parts are white.
+func Thumbnail(data []byte, size int) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, scaleDown(img, size), &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown averages the pixels of img into an image fitting in size by
+// size, keeping its aspect ratio. A smaller image keeps its size.
+func scaleDown(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	w, h := sw, sh
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, sh*size/sw
+		} else {
+			w, h = sw*size/sh, size
+		}
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	type sum struct{ r, g, b, n uint64 }
+	sums := make([]sum, w*h)
+	for y := 0; y < sh; y++ {
+		dy := y * h / sh
+		for x := 0; x < sw; x++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			// the colors are premultiplied, adding the rest of the alpha
+			// lays them on white
+			s := &sums[dy*w+x*w/sw]
+			s.r += uint64(r + 0xffff - a)
+			s.g += uint64(g + 0xffff - a)
+			s.b += uint64(bl + 0xffff - a)
+			s.n++
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i, s := range sums {
+		if s.n == 0 {
+			continue
+		}
+		dst.SetRGBA(i%w, i/w, color.RGBA{
+			R: uint8(s.r / s.n >> 8),
+			G: uint8(s.g / s.n >> 8),
+			B: uint8(s.b / s.n >> 8),
+			A: 0xff,
+		})
+	}
+	return dst
+}
+
+// TextPreview is the start of the text data, at most size bytes cut on a
+// character. It is empty when data is not utf-8 text.
+func TextPreview(data []byte, size int) []byte {
+	if len(data) > size {
+		data = data[:size]
+	}
+	// a character cut by the read is dropped
+	for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+		r, n := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError || n > 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil
+	}
+	return data
+}